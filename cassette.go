@@ -0,0 +1,354 @@
+package gwda
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrCassetteMismatch is returned while replaying a cassette if the requests
+// differ from the recorded ones, or not all of them were made.
+var ErrCassetteMismatch = errors.New("cassette mismatch")
+
+// Cassette records the requests of a driver and the responses of WDA to a file,
+// and replays them later without a device, e.g.
+//
+//	cassette := gwda.RecordCassette("testdata/login.json")
+//	driver, err := gwda.NewUSBDriver(nil, gwda.WithCassette(cassette))
+//	...
+//	err = cassette.Close()
+//
+// and in the regression test
+//
+//	cassette, err := gwda.ReplayCassette("testdata/login.json")
+//	driver, err := gwda.NewDriverWithOptions(nil, "http://localhost:8100", gwda.WithCassette(cassette))
+//	...
+//	err = cassette.Close() // ErrCassetteMismatch unless the same requests were made
+//
+// Screenshots are stored as side files in the directory "<name>_files" next to the cassette.
+// The requests of the health checks, e.g. by the keep-alive, are neither recorded nor matched.
+type Cassette struct {
+	path   string
+	replay bool
+
+	mu           sync.Mutex
+	interactions []cassetteInteraction
+	// next is the index of the next interaction to replay
+	next    int
+	err     error
+	clients map[*http.Client]*http.Client
+}
+
+type cassetteFile struct {
+	Version      int                   `json:"version"`
+	Interactions []cassetteInteraction `json:"interactions"`
+}
+
+type cassetteInteraction struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Query  string          `json:"query,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+
+	Status      int             `json:"status"`
+	ContentType string          `json:"contentType,omitempty"`
+	Response    json.RawMessage `json:"response,omitempty"`
+	// ResponseFile holds a response which is not JSON, e.g. of ScreenshotUUSense
+	ResponseFile string `json:"responseFile,omitempty"`
+	// ValueFile holds the decoded base64 value of the response, e.g. of Screenshot
+	ValueFile string `json:"valueFile,omitempty"`
+
+	// sideFiles are the contents of ResponseFile and ValueFile while recording
+	sideFiles map[string][]byte
+}
+
+const cassetteVersion = 1
+
+// RecordCassette creates a cassette recording to path, which is written by Close.
+func RecordCassette(path string) *Cassette {
+	return &Cassette{path: path}
+}
+
+// ReplayCassette loads a cassette recorded to path for replay.
+func ReplayCassette(path string) (*Cassette, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file cassetteFile
+	if err = json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("cassette %s: %w", path, err)
+	}
+	if file.Version != cassetteVersion {
+		return nil, fmt.Errorf("cassette %s: unsupported version %d", path, file.Version)
+	}
+	return &Cassette{path: path, replay: true, interactions: file.Interactions}, nil
+}
+
+// WithCassette records the requests of the driver to cassette or replays them from it.
+// A driver replaying a cassette does not connect to WDA, so it has to be created with NewDriverWithOptions.
+func WithCassette(cassette *Cassette) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.cassette = cassette
+	})
+}
+
+// Wrap returns a transport recording the requests sent through next, or replaying them,
+// in which case next is not used.
+func (c *Cassette) Wrap(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return cassetteTransport{cassette: c, next: next}
+}
+
+// client returns a client using the transport of base wrapped by the cassette.
+func (c *Cassette) client(base *http.Client) *http.Client {
+	if base == nil {
+		base = HTTPClient
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clients == nil {
+		c.clients = make(map[*http.Client]*http.Client)
+	}
+	if client, ok := c.clients[base]; ok {
+		return client
+	}
+	client := *base
+	client.Transport = c.Wrap(base.Transport)
+	c.clients[base] = &client
+	return &client
+}
+
+// Close writes a recorded cassette, or reports whether the replay diverged from the cassette.
+func (c *Cassette) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.replay {
+		if c.err == nil && c.next < len(c.interactions) {
+			recorded := c.interactions[c.next]
+			c.err = fmt.Errorf("%w: %d of %d requests made, next recorded %s %s",
+				ErrCassetteMismatch, c.next, len(c.interactions), recorded.Method, recorded.Path)
+		}
+		return c.err
+	}
+	return c.write()
+}
+
+func (c *Cassette) write() (err error) {
+	dir := c.filesDir()
+	for _, interaction := range c.interactions {
+		for name, data := range interaction.sideFiles {
+			if err = os.MkdirAll(dir, 0o755); err != nil {
+				return err
+			}
+			if err = ioutil.WriteFile(filepath.Join(dir, filepath.Base(name)), data, 0o644); err != nil {
+				return err
+			}
+		}
+	}
+	var raw []byte
+	if raw, err = json.MarshalIndent(cassetteFile{Version: cassetteVersion, Interactions: c.interactions}, "", "  "); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, raw, 0o644)
+}
+
+// filesDir is the directory of the side files, e.g. "testdata/login_files" for "testdata/login.json".
+func (c *Cassette) filesDir() string {
+	return strings.TrimSuffix(c.path, filepath.Ext(c.path)) + "_files"
+}
+
+// isHealthCheck reports whether a request is sent by health checks rather than the test,
+// these vary in number and are neither recorded nor matched.
+func isHealthCheck(req *http.Request) bool {
+	return req.Method == http.MethodGet && (req.URL.Path == "/health" || req.URL.Path == "/wda/healthcheck")
+}
+
+type cassetteTransport struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+func (t cassetteTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	var body []byte
+	if req.Body != nil {
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.cassette.replay {
+		return t.cassette.play(req, body)
+	}
+	if resp, err = t.next.RoundTrip(req); err != nil || isHealthCheck(req) {
+		return resp, err
+	}
+	var respBody []byte
+	respBody, err = ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+	t.cassette.record(req, body, resp, respBody)
+	return resp, nil
+}
+
+func (c *Cassette) record(req *http.Request, body []byte, resp *http.Response, respBody []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	interaction := cassetteInteraction{
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		Query:       req.URL.RawQuery,
+		Body:        jsonOrString(body),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	prefix := fmt.Sprintf("%s/%04d", filepath.Base(c.filesDir()), len(c.interactions))
+
+	var reply map[string]json.RawMessage
+	switch {
+	case len(respBody) == 0:
+	case json.Unmarshal(respBody, &reply) != nil:
+		if json.Valid(respBody) {
+			interaction.Response = respBody
+			break
+		}
+		interaction.ResponseFile = prefix + sideFileExt(respBody)
+		interaction.sideFiles = map[string][]byte{interaction.ResponseFile: respBody}
+	default:
+		interaction.Response = respBody
+		var value string
+		if json.Unmarshal(reply["value"], &value) != nil || len(value) < 1024 {
+			break
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || !strings.HasPrefix(http.DetectContentType(decoded), "image/") {
+			break
+		}
+		interaction.ValueFile = prefix + sideFileExt(decoded)
+		interaction.sideFiles = map[string][]byte{interaction.ValueFile: decoded}
+		reply["value"] = json.RawMessage("null")
+		interaction.Response, _ = json.Marshal(reply)
+	}
+	c.interactions = append(c.interactions, interaction)
+}
+
+func (c *Cassette) play(req *http.Request, body []byte) (*http.Response, error) {
+	if isHealthCheck(req) {
+		if req.URL.Path == "/health" {
+			return newCassetteResponse(req, http.StatusOK, "text/plain", []byte("I-AM-ALIVE")), nil
+		}
+		return newCassetteResponse(req, http.StatusOK, "application/json", []byte(`{"value":null}`)), nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	if c.next >= len(c.interactions) {
+		c.err = fmt.Errorf("%w: request %d %s %s was not recorded, the cassette has %d requests",
+			ErrCassetteMismatch, c.next+1, req.Method, req.URL.Path, len(c.interactions))
+		return nil, c.err
+	}
+	interaction := c.interactions[c.next]
+	if !interaction.matches(req, body) {
+		c.err = fmt.Errorf("%w: request %d is %s %s %s, recorded %s %s %s",
+			ErrCassetteMismatch, c.next+1, req.Method, req.URL.Path, body, interaction.Method, interaction.Path, interaction.Body)
+		return nil, c.err
+	}
+	c.next++
+
+	respBody := []byte(interaction.Response)
+	switch {
+	case interaction.ResponseFile != "":
+		raw, err := ioutil.ReadFile(filepath.Join(filepath.Dir(c.path), interaction.ResponseFile))
+		if err != nil {
+			return nil, err
+		}
+		respBody = raw
+	case interaction.ValueFile != "":
+		raw, err := ioutil.ReadFile(filepath.Join(filepath.Dir(c.path), interaction.ValueFile))
+		if err != nil {
+			return nil, err
+		}
+		var reply map[string]json.RawMessage
+		if err = json.Unmarshal(respBody, &reply); err != nil {
+			return nil, err
+		}
+		reply["value"], _ = json.Marshal(base64.StdEncoding.EncodeToString(raw))
+		if respBody, err = json.Marshal(reply); err != nil {
+			return nil, err
+		}
+	}
+	return newCassetteResponse(req, interaction.Status, interaction.ContentType, respBody), nil
+}
+
+// matches compares the request with the recorded one, JSON bodies are compared by their content.
+func (interaction cassetteInteraction) matches(req *http.Request, body []byte) bool {
+	if req.Method != interaction.Method || req.URL.Path != interaction.Path || req.URL.RawQuery != interaction.Query {
+		return false
+	}
+	var recorded, actual interface{}
+	if len(interaction.Body) == 0 || len(body) == 0 {
+		return len(interaction.Body) == 0 && len(body) == 0
+	}
+	if json.Unmarshal(interaction.Body, &recorded) != nil || json.Unmarshal(jsonOrString(body), &actual) != nil {
+		return false
+	}
+	return reflect.DeepEqual(recorded, actual)
+}
+
+func newCassetteResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	header := make(http.Header)
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// jsonOrString keeps a JSON body as it is, anything else is stored as JSON string.
+func jsonOrString(body []byte) json.RawMessage {
+	if len(body) == 0 || json.Valid(body) {
+		return body
+	}
+	raw, _ := json.Marshal(string(body))
+	return raw
+}
+
+func sideFileExt(data []byte) string {
+	switch http.DetectContentType(data) {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	default:
+		return ".bin"
+	}
+}
@@ -0,0 +1,114 @@
+package gwda
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func TestCassette(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+	fake.SetUI(&wdatest.Element{Type: "Application", Name: "Demo", Width: 390, Height: 844, Children: []*wdatest.Element{
+		{Type: "Button", Name: "Login", X: 20, Y: 100, Width: 350, Height: 44},
+	}})
+	var screen bytes.Buffer
+	if err := png.Encode(&screen, newNoiseImage(64, 64, 1)); err != nil {
+		t.Fatal(err)
+	}
+	fake.SetScreenshot(screen.Bytes())
+
+	session := func(driver WebDriver) (screenshot, uusense []byte) {
+		t.Helper()
+		element, err := driver.FindElement(BySelector{Name: "Login"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = element.Click(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = driver.IsWdaHealthy(); err != nil {
+			t.Fatal(err)
+		}
+		raw, err := driver.Screenshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rawUUSense, err := driver.ScreenshotUUSense(0, 0, 0, 0, 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw.Bytes(), rawUUSense.Bytes()
+	}
+
+	path := filepath.Join(t.TempDir(), "login.json")
+	recorder := RecordCassette(path)
+	driver, err := NewDriverWithOptions(nil, fake.URL, WithCassette(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	session(driver)
+	if _, err = driver.IsWdaHealthy(); err != nil {
+		t.Fatal(err)
+	}
+	if err = recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "login_files", "*.png"))
+	if len(files) != 2 {
+		t.Fatalf("got side files %q, want the two screenshots", files)
+	}
+	if raw, _ := os.ReadFile(path); bytes.Contains(raw, []byte("iVBOR")) {
+		t.Fatal("the screenshot is stored inline")
+	}
+
+	// the replay does not reach the fake
+	fake.ResetRequests()
+	player, err := ReplayCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if driver, err = NewDriverWithOptions(nil, "http://127.0.0.1:1", WithCassette(player)); err != nil {
+		t.Fatal(err)
+	}
+	screenshot, uusense := session(driver)
+	if !bytes.Equal(screenshot, screen.Bytes()) || !bytes.Equal(uusense, screen.Bytes()) {
+		t.Fatal("the replayed screenshots differ")
+	}
+	if err = player.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if requests := fake.Requests(); len(requests) != 0 {
+		t.Fatalf("the replay sent %d requests", len(requests))
+	}
+
+	// a diverging request fails the replay
+	if player, err = ReplayCassette(path); err != nil {
+		t.Fatal(err)
+	}
+	if driver, err = NewDriverWithOptions(nil, "http://127.0.0.1:1", WithCassette(player)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = driver.FindElement(BySelector{Name: "Logout"}); !errors.Is(err, ErrCassetteMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrCassetteMismatch)
+	}
+	if err = player.Close(); !errors.Is(err, ErrCassetteMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrCassetteMismatch)
+	}
+
+	// so do missing requests
+	if player, err = ReplayCassette(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewDriverWithOptions(nil, "http://127.0.0.1:1", WithCassette(player)); err != nil {
+		t.Fatal(err)
+	}
+	if err = player.Close(); !errors.Is(err, ErrCassetteMismatch) {
+		t.Fatalf("got %v, want %v", err, ErrCassetteMismatch)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/electricbubble/gwda"
+)
+
+func runDevices(c *cli, args []string) error {
+	if _, err := c.parse(c.flagSet("devices"), args, 0, 0); err != nil {
+		return err
+	}
+	devices, err := gwda.DeviceList()
+	if err != nil {
+		return err
+	}
+
+	type device struct {
+		SerialNumber string `json:"serialNumber"`
+		DeviceID     int    `json:"deviceId"`
+	}
+	list := make([]device, len(devices))
+	for i, d := range devices {
+		list[i] = device{SerialNumber: d.SerialNumber(), DeviceID: d.DeviceID()}
+	}
+	if c.json {
+		return c.printIndented(list)
+	}
+	for _, d := range list {
+		fmt.Fprintf(c.stdout, "%s\t%d\n", d.SerialNumber, d.DeviceID)
+	}
+	return nil
+}
+
+func runStatus(c *cli, args []string) error {
+	if _, err := c.parse(c.flagSet("status"), args, 0, 0); err != nil {
+		return err
+	}
+	return c.withDriver(func(driver gwda.WebDriver) error {
+		status, err := driver.Status()
+		if err != nil {
+			return err
+		}
+		return c.printIndented(status)
+	})
+}
+
+func runInfo(c *cli, args []string) error {
+	if _, err := c.parse(c.flagSet("info"), args, 0, 0); err != nil {
+		return err
+	}
+	return c.withDriver(func(driver gwda.WebDriver) (err error) {
+		var info struct {
+			Device  gwda.DeviceInfo  `json:"device"`
+			Battery gwda.BatteryInfo `json:"battery"`
+			Screen  gwda.Screen      `json:"screen"`
+			Size    gwda.Size        `json:"windowSize"`
+		}
+		if info.Device, err = driver.DeviceInfo(); err != nil {
+			return err
+		}
+		if info.Battery, err = driver.BatteryInfo(); err != nil {
+			return err
+		}
+		if info.Screen, err = driver.Screen(); err != nil {
+			return err
+		}
+		if info.Size, err = driver.WindowSize(); err != nil {
+			return err
+		}
+		if c.json {
+			return c.printIndented(info)
+		}
+
+		w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Name:\t%s\n", info.Device.Name)
+		fmt.Fprintf(w, "Model:\t%s\n", info.Device.Model)
+		fmt.Fprintf(w, "UUID:\t%s\n", info.Device.UUID)
+		fmt.Fprintf(w, "Locale:\t%s\n", info.Device.CurrentLocale)
+		fmt.Fprintf(w, "Time zone:\t%s\n", info.Device.TimeZone)
+		fmt.Fprintf(w, "Battery:\t%.0f%% (%s)\n", info.Battery.Level*100, info.Battery.State)
+		fmt.Fprintf(w, "Window size:\t%dx%d points\n", info.Size.Width, info.Size.Height)
+		fmt.Fprintf(w, "Scale:\t%g\n", info.Screen.Scale)
+		return w.Flush()
+	})
+}
+
+func runScreenshot(c *cli, args []string) error {
+	fs := c.flagSet("screenshot")
+	output := fs.String("o", "screenshot.png", "file to write, \"-\" for stdout")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	return c.withDriver(func(driver gwda.WebDriver) error {
+		raw, err := driver.Screenshot()
+		if err != nil {
+			return err
+		}
+		if *output == "-" {
+			_, err = raw.WriteTo(c.stdout)
+			return err
+		}
+		size := raw.Len()
+		if err = os.WriteFile(*output, raw.Bytes(), 0o644); err != nil {
+			return err
+		}
+		return c.print(map[string]interface{}{"path": *output, "bytes": size}, *output)
+	})
+}
+
+func runSource(c *cli, args []string) error {
+	fs := c.flagSet("source")
+	format := fs.String("format", "xml", "xml, json or description")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	srcOpt := gwda.NewSourceOption()
+	switch *format {
+	case "xml":
+		srcOpt = srcOpt.WithFormatAsXml()
+	case "json":
+		srcOpt = srcOpt.WithFormatAsJson()
+	case "description":
+		srcOpt = srcOpt.WithFormatAsDescription()
+	default:
+		fs.Usage()
+		return errUsage
+	}
+	return c.withDriver(func(driver gwda.WebDriver) error {
+		source, err := driver.Source(srcOpt)
+		if err != nil {
+			return err
+		}
+		// the JSON tree is printed as is rather than as a string
+		var value interface{} = source
+		if *format == "json" {
+			value = json.RawMessage(source)
+		}
+		return c.print(value, source)
+	})
+}
+
+func runTap(c *cli, args []string) error {
+	args, err := c.parse(c.flagSet("tap"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	coordinates, err := parseFloats(args)
+	if err != nil {
+		return err
+	}
+	return c.withDriver(func(driver gwda.WebDriver) error {
+		return driver.TapFloat(coordinates[0], coordinates[1])
+	})
+}
+
+func runSwipe(c *cli, args []string) error {
+	args, err := c.parse(c.flagSet("swipe"), args, 4, 4)
+	if err != nil {
+		return err
+	}
+	coordinates, err := parseFloats(args)
+	if err != nil {
+		return err
+	}
+	return c.withDriver(func(driver gwda.WebDriver) error {
+		return driver.SwipeFloat(coordinates[0], coordinates[1], coordinates[2], coordinates[3])
+	})
+}
+
+func runType(c *cli, args []string) error {
+	fs := c.flagSet("type")
+	frequency := fs.Int("frequency", 60, "keys typed per second")
+	args, err := c.parse(fs, args, 1, 1<<16)
+	if err != nil {
+		return err
+	}
+	return c.withDriver(func(driver gwda.WebDriver) error {
+		return driver.SendKeys(strings.Join(args, " "), *frequency)
+	})
+}
+
+func runApp(c *cli, args []string) error {
+	fs := c.flagSet("app")
+	args, err := c.parse(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	action := args[0]
+	switch {
+	case action == "list" && len(args) == 1:
+	case (action == "launch" || action == "terminate" || action == "state") && len(args) == 2:
+	default:
+		fs.Usage()
+		return errUsage
+	}
+
+	return c.withDriver(func(driver gwda.WebDriver) error {
+		switch action {
+		case "list":
+			apps, err := driver.ActiveAppsList()
+			if err != nil {
+				return err
+			}
+			if c.json {
+				return c.printIndented(apps)
+			}
+			for _, app := range apps {
+				fmt.Fprintf(c.stdout, "%d\t%s\n", app.Pid, app.BundleId)
+			}
+			return nil
+		case "launch":
+			return driver.AppLaunch(args[1])
+		case "terminate":
+			terminated, err := driver.AppTerminate(args[1])
+			if err != nil {
+				return err
+			}
+			text := "terminated"
+			if !terminated {
+				text = "not running"
+			}
+			return c.print(map[string]interface{}{"bundleId": args[1], "terminated": terminated}, text)
+		default:
+			state, err := driver.AppState(args[1])
+			if err != nil {
+				return err
+			}
+			return c.print(map[string]interface{}{"bundleId": args[1], "state": int(state), "name": state.String()}, state.String())
+		}
+	})
+}
+
+func runAlert(c *cli, args []string) error {
+	fs := c.flagSet("alert")
+	args, err := c.parse(fs, args, 1, 2)
+	if err != nil {
+		return err
+	}
+	action, label := args[0], args[1:]
+	switch {
+	case action == "text" && len(label) == 0:
+	case action == "accept" || action == "dismiss":
+	default:
+		fs.Usage()
+		return errUsage
+	}
+
+	return c.withDriver(func(driver gwda.WebDriver) error {
+		switch action {
+		case "text":
+			text, err := driver.AlertText()
+			if err != nil {
+				return err
+			}
+			buttons, err := driver.AlertButtons()
+			if err != nil {
+				return err
+			}
+			if c.json {
+				return c.printIndented(map[string]interface{}{"text": text, "buttons": buttons})
+			}
+			fmt.Fprintln(c.stdout, text)
+			for _, button := range buttons {
+				fmt.Fprintf(c.stdout, "[%s]\n", button)
+			}
+			return nil
+		case "accept":
+			return driver.AlertAccept(label...)
+		default:
+			return driver.AlertDismiss(label...)
+		}
+	})
+}
+
+// runButton returns a command without arguments calling fn, e.g. to lock the device.
+func runButton(fn func(driver gwda.WebDriver) error) func(c *cli, args []string) error {
+	return func(c *cli, args []string) error {
+		if _, err := c.parse(c.flagSet(c.command.name), args, 0, 0); err != nil {
+			return err
+		}
+		return c.withDriver(fn)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/electricbubble/gwda"
+)
+
+func runInspect(c *cli, args []string) error {
+	fs := c.flagSet("inspect")
+	addr := fs.String("addr", "localhost:8200", "address to serve the inspector on")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	return c.withDriver(func(driver gwda.WebDriver) error {
+		listener, err := net.Listen("tcp", *addr)
+		if err != nil {
+			return err
+		}
+		server := &http.Server{Handler: gwda.NewInspector(driver)}
+		fmt.Fprintf(c.stderr, "open http://%s in a browser\n", listener.Addr())
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			_ = server.Shutdown(context.Background())
+		}()
+		if err = server.Serve(listener); errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		return err
+	})
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// errInterrupted is returned by readLine for Ctrl-C, the line typed so far is dropped.
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads lines typed on a terminal in raw mode, with the usual editing keys,
+// a history browsed by the arrow keys and completion by Tab.
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// raw puts the terminal into raw mode while a line is read, if set,
+	// so the commands run in between can be interrupted by Ctrl-C
+	raw func() (restore func(), err error)
+
+	// complete returns the candidates for the word ending the line head
+	complete func(head string) []string
+
+	history []string
+	// historyLimit is the number of lines kept, the oldest ones are dropped
+	historyLimit int
+}
+
+func newLineEditor(in io.Reader, out io.Writer, complete func(head string) []string) *lineEditor {
+	return &lineEditor{in: bufio.NewReader(in), out: out, complete: complete, historyLimit: 1000}
+}
+
+// addHistory appends line unless it is empty or repeats the last one.
+func (e *lineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == line) {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > e.historyLimit {
+		e.history = e.history[len(e.history)-e.historyLimit:]
+	}
+}
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLF        = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCR        = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// readLine shows prompt and returns the line once Enter is pressed,
+// io.EOF for Ctrl-D on an empty line.
+func (e *lineEditor) readLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	var line []rune
+	pos := 0
+	// the entries of the history being browsed, with the line typed so far at the end
+	browse := append(append([]string(nil), e.history...), "")
+	index := len(browse) - 1
+
+	refresh := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(line))
+		if back := len(line) - pos; back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	show := func(i int) {
+		browse[index] = string(line)
+		index = i
+		line = []rune(browse[index])
+		pos = len(line)
+		refresh()
+	}
+	insert := func(runes ...rune) {
+		line = append(line[:pos], append(runes, line[pos:]...)...)
+		pos += len(runes)
+		refresh()
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return string(line), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyCR, keyLF:
+			fmt.Fprint(e.out, "\r\n")
+			return string(line), nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(line) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+				refresh()
+			}
+		case keyBackspace, keyCtrlH:
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+				refresh()
+			}
+		case keyCtrlA:
+			pos = 0
+			refresh()
+		case keyCtrlE:
+			pos = len(line)
+			refresh()
+		case keyCtrlB:
+			if pos > 0 {
+				pos--
+				refresh()
+			}
+		case keyCtrlF:
+			if pos < len(line) {
+				pos++
+				refresh()
+			}
+		case keyCtrlK:
+			line = line[:pos]
+			refresh()
+		case keyCtrlU:
+			line = line[pos:]
+			pos = 0
+			refresh()
+		case keyCtrlW:
+			start := pos
+			for start > 0 && line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && line[start-1] != ' ' {
+				start--
+			}
+			line = append(line[:start], line[pos:]...)
+			pos = start
+			refresh()
+		case keyCtrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+			refresh()
+		case keyCtrlP:
+			if index > 0 {
+				show(index - 1)
+			}
+		case keyCtrlN:
+			if index < len(browse)-1 {
+				show(index + 1)
+			}
+		case keyTab:
+			if completed, ok := e.completeLine(prompt, line, pos); ok {
+				line = append(completed, line[pos:]...)
+				pos = len(completed)
+			}
+			refresh()
+		case keyEscape:
+			switch e.readEscape() {
+			case 'A':
+				if index > 0 {
+					show(index - 1)
+				}
+			case 'B':
+				if index < len(browse)-1 {
+					show(index + 1)
+				}
+			case 'C':
+				if pos < len(line) {
+					pos++
+					refresh()
+				}
+			case 'D':
+				if pos > 0 {
+					pos--
+					refresh()
+				}
+			case 'H':
+				pos = 0
+				refresh()
+			case 'F':
+				pos = len(line)
+				refresh()
+			}
+		default:
+			if r >= ' ' && r != utf8.RuneError {
+				insert(r)
+			}
+		}
+	}
+}
+
+// readEscape reads the rest of an escape sequence and returns its final byte,
+// e.g. 'A' for the arrow up sent as "ESC [ A" or "ESC O A".
+func (e *lineEditor) readEscape() byte {
+	b, err := e.in.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return 0
+	}
+	for {
+		if b, err = e.in.ReadByte(); err != nil {
+			return 0
+		}
+		// parameters, e.g. "ESC [ 1 ; 5 C"
+		if (b >= '0' && b <= '9') || b == ';' {
+			continue
+		}
+		return b
+	}
+}
+
+// completeLine returns the head of the line with the word before pos completed as far as
+// the candidates agree. Candidates which disagree are listed below the line.
+func (e *lineEditor) completeLine(prompt string, line []rune, pos int) ([]rune, bool) {
+	if e.complete == nil {
+		return nil, false
+	}
+	head := string(line[:pos])
+	candidates := e.complete(head)
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	word := head[strings.LastIndexAny(head, " .=;")+1:]
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		prefix += " "
+	}
+	if len(prefix) > len(word) {
+		return []rune(head[:len(head)-len(word)] + prefix), true
+	}
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	return nil, false
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLineEditor(t *testing.T) {
+	const (
+		up    = "\x1b[A"
+		down  = "\x1b[B"
+		left  = "\x1b[D"
+		right = "\x1b[C"
+	)
+	input := strings.Join([]string{
+		"tap 1 2\r",
+		// editing in the middle of the line
+		"hme" + left + left + "o" + right + right + "\r",
+		// the history, and changes to it
+		up + up + "\x7f3\r",
+		up + up + up + down + "\r",
+		// completion
+		"fi\ta\tpredicate x\r",
+		"ab\x03",
+		"typo\x15home\r",
+		"\x04",
+	}, "")
+	editor := newLineEditor(strings.NewReader(input), io.Discard, func(head string) []string {
+		var matches []string
+		for _, word := range []string{"find", "findall", "predicate"} {
+			if strings.HasPrefix(word, head[strings.LastIndex(head, " ")+1:]) {
+				matches = append(matches, word)
+			}
+		}
+		return matches
+	})
+
+	for _, want := range []string{"tap 1 2", "home", "tap 1 3", "home", "findall predicate x", "", "home"} {
+		line, err := editor.readLine("> ")
+		if want == "" {
+			if err != errInterrupted {
+				t.Fatalf("expected an interrupt, got %q %v", line, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != want {
+			t.Fatalf("got %q, want %q", line, want)
+		}
+		editor.addHistory(line)
+	}
+	if _, err := editor.readLine("> "); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+	if got := strings.Join(editor.history, ","); got != "tap 1 2,home,tap 1 3,home,findall predicate x,home" {
+		t.Errorf("unexpected history %s", got)
+	}
+}
+
+func TestLineEditor_ListsCandidates(t *testing.T) {
+	var out bytes.Buffer
+	editor := newLineEditor(strings.NewReader("find\t\r"), &out, func(string) []string {
+		return []string{"find", "findall"}
+	})
+	if line, err := editor.readLine("> "); err != nil || line != "find" {
+		t.Fatalf("got %q %v", line, err)
+	}
+	if !strings.Contains(out.String(), "find  findall") {
+		t.Errorf("candidates not listed: %q", out.String())
+	}
+}
+
+func TestLineEditor_RawWhileReading(t *testing.T) {
+	editor := newLineEditor(strings.NewReader("a\rb\r"), io.Discard, nil)
+	var raw, restored int
+	editor.raw = func() (func(), error) {
+		raw++
+		return func() { restored++ }, nil
+	}
+	for i := 1; i <= 2; i++ {
+		if _, err := editor.readLine("> "); err != nil {
+			t.Fatal(err)
+		}
+		if raw != i || restored != i {
+			t.Fatalf("raw mode entered %d times, left %d times after %d lines", raw, restored, i)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Command gwda works with iOS devices through WebDriverAgent, e.g.
+//
+//	gwda devices
+//	gwda tap 100 200
+//	gwda --serial 00008030-0001 screenshot -o screen.png
+//	gwda app state com.apple.Preferences --json
+//	gwda serve -addr :8100 -token secret
+//	gwda shell
+//	gwda inspect
+//
+// The device is the first one connected via USB unless selected by --serial,
+// or reached through WDA at --url instead.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/electricbubble/gwda"
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+// commands are listed in this order by the usage.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"devices", "", "list the devices connected via USB", runDevices},
+		{"status", "", "show the status of WDA", runStatus},
+		{"info", "", "show the device, battery and screen information", runInfo},
+		{"screenshot", "[-o file]", "save a screenshot", runScreenshot},
+		{"source", "[--format xml|json|description]", "print the UI hierarchy", runSource},
+		{"tap", "x y", "tap the coordinate", runTap},
+		{"swipe", "fromX fromY toX toY", "swipe between the coordinates", runSwipe},
+		{"type", "text", "type text with the keyboard", runType},
+		{"app", "launch|terminate|state bundleId, app list", "manage the apps", runApp},
+		{"alert", "text|accept|dismiss [button]", "handle the alert shown", runAlert},
+		{"lock", "", "lock the device", runButton(gwda.WebDriver.Lock)},
+		{"unlock", "", "unlock the device", runButton(gwda.WebDriver.Unlock)},
+		{"home", "", "go to the home screen", runButton(gwda.WebDriver.Homescreen)},
+		{"serve", "[-addr localhost:8100] [-token token]", "expose the devices connected via USB to remote drivers", runServe},
+		{"shell", "[-history file]", "run commands interactively against one session", runShell},
+		{"inspect", "[-addr localhost:8200]", "inspect the UI of the device in a browser", runInspect},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// errUsage reports wrong arguments, the usage of the command was printed already.
+var errUsage = errors.New("usage")
+
+// run executes the command line args and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+	global := c.flagSet("gwda")
+	global.Usage = func() { printUsage(stderr) }
+	args, err := parseFlags(global, args, true)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil || len(args) == 0 {
+		if len(args) == 0 {
+			printUsage(stderr)
+		}
+		return 2
+	}
+
+	name, args := args[0], args[1:]
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		c.command = cmd
+		switch err = cmd.run(c, args); {
+		case err == nil:
+			return 0
+		case err == flag.ErrHelp:
+			return 0
+		case err == errUsage:
+			return 2
+		default:
+			c.printError(err)
+			return 1
+		}
+	}
+	if name == "help" {
+		printUsage(stdout)
+		return 0
+	}
+	fmt.Fprintf(stderr, "gwda: unknown command %q\n\n", name)
+	printUsage(stderr)
+	return 2
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, "usage: gwda [--serial serial | --url url] [--json] <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprint(w, "\nRun 'gwda <command> -h' for the arguments of a command.\n")
+}
+
+// cli holds the selection of the device and the output of a command.
+type cli struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	command        command
+	// driver is the session of the shell, shared by its commands
+	driver gwda.WebDriver
+
+	serial string
+	url    string
+	json   bool
+}
+
+// flagSet returns the flags of a command, including the ones selecting the device.
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	if c.serial == "" {
+		c.serial = os.Getenv("GWDA_SERIAL")
+	}
+	if c.url == "" {
+		c.url = os.Getenv("GWDA_URL")
+	}
+	fs.StringVar(&c.serial, "serial", c.serial, "serial number of the device connected via USB, defaults to $GWDA_SERIAL")
+	fs.StringVar(&c.url, "url", c.url, "URL of WDA instead of a device connected via USB, defaults to $GWDA_URL")
+	fs.BoolVar(&c.json, "json", c.json, "print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "usage: gwda %s [flags] %s\n\n%s\n\nflags:\n", c.command.name, c.command.args, c.command.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the flags anywhere between the arguments, and checks there are n to max arguments.
+func (c *cli) parse(fs *flag.FlagSet, args []string, n, max int) ([]string, error) {
+	args, err := parseFlags(fs, args, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < n || len(args) > max {
+		fs.Usage()
+		return nil, errUsage
+	}
+	return args, nil
+}
+
+// parseFlags returns the arguments left once the flags are parsed. The flags may come after
+// the arguments unless firstOnly, as in 'gwda tap 10 20 --json'. Arguments after "--" are taken as is.
+func parseFlags(fs *flag.FlagSet, args []string, firstOnly bool) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if consumed := len(args) - len(rest); firstOnly || (consumed > 0 && args[consumed-1] == "--") {
+			return append(positional, rest...), nil
+		}
+		positional, args = append(positional, rest[0]), rest[1:]
+	}
+}
+
+// withDriver connects to the device for fn, without deleting the session afterwards.
+func (c *cli) withDriver(fn func(driver gwda.WebDriver) error) error {
+	if c.driver != nil {
+		return fn(c.driver)
+	}
+	var driver gwda.WebDriver
+	var err error
+	if c.url != "" {
+		driver, err = gwda.NewDriver(nil, c.url)
+	} else {
+		var options []gwda.DriverOption
+		if c.serial != "" {
+			options = append(options, gwda.WithSerialNumber(c.serial))
+		}
+		driver, err = gwda.NewUSBDriver(nil, options...)
+	}
+	if err != nil {
+		return err
+	}
+	defer driver.Close()
+	return fn(driver)
+}
+
+// print writes value as JSON with --json, text otherwise.
+func (c *cli) print(value interface{}, text string) error {
+	if c.json {
+		return json.NewEncoder(c.stdout).Encode(value)
+	}
+	_, err := fmt.Fprintln(c.stdout, text)
+	return err
+}
+
+// printIndented writes value as JSON, indented unless --json.
+func (c *cli) printIndented(value interface{}) error {
+	encoder := json.NewEncoder(c.stdout)
+	if !c.json {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(value)
+}
+
+// printError reports err on stderr, as JSON with --json so scripts can tell the WDA error codes apart.
+func (c *cli) printError(err error) {
+	if !c.json {
+		fmt.Fprintf(c.stderr, "gwda %s: %v\n", c.command.name, err)
+		return
+	}
+	report := struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}{Error: "unknown error", Message: err.Error()}
+	var wdaErr *gwda.WDAError
+	if errors.As(err, &wdaErr) && wdaErr.Code != "" {
+		report.Error, report.Message = wdaErr.Code, wdaErr.Message
+	}
+	_ = json.NewEncoder(c.stderr).Encode(report)
+}
+
+// parseFloats parses the coordinates of a gesture.
+func parseFloats(args []string) ([]float64, error) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		var err error
+		if values[i], err = strconv.ParseFloat(strings.TrimSuffix(arg, ","), 64); err != nil {
+			return nil, fmt.Errorf("invalid coordinate %q", arg)
+		}
+	}
+	return values, nil
+}
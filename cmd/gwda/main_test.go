@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func newFakeServer(t *testing.T) *wdatest.Server {
+	fake := wdatest.NewServer()
+	t.Cleanup(fake.Close)
+	fake.SetUI(&wdatest.Element{Type: "Application", Name: "Settings", Width: 390, Height: 844, Children: []*wdatest.Element{
+		{Type: "Button", Name: "General", X: 0, Y: 100, Width: 390, Height: 44},
+	}})
+	return fake
+}
+
+// runFake runs the command line against the fake and returns its exit code and output.
+func runFake(t *testing.T, fake *wdatest.Server, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(append([]string{"--url", fake.URL}, args...), nil, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	fake := newFakeServer(t)
+	fake.SetAlert("Allow notifications?", "Allow", "Don't Allow")
+	fake.SetAppState("com.apple.Preferences", 4)
+
+	for _, tc := range []struct {
+		args   []string
+		stdout string
+	}{
+		{[]string{"status"}, `"ready": true`},
+		{[]string{"info"}, "Fake iPhone"},
+		{[]string{"source"}, `name="General"`},
+		{[]string{"source", "--format", "json", "--json"}, `"name":"General"`},
+		{[]string{"tap", "10", "120"}, ""},
+		{[]string{"swipe", "10", "600", "10", "100"}, ""},
+		{[]string{"type", "hello", "world"}, ""},
+		{[]string{"app", "state", "com.apple.Preferences"}, "Running (Front)"},
+		{[]string{"app", "state", "com.apple.Preferences", "--json"}, `"state":4`},
+		{[]string{"app", "list", "--json"}, `"bundleId":"com.apple.Preferences"`},
+		{[]string{"alert", "text"}, "[Don't Allow]"},
+		{[]string{"alert", "accept"}, ""},
+		{[]string{"lock"}, ""},
+		{[]string{"home"}, ""},
+	} {
+		code, stdout, stderr := runFake(t, fake, tc.args...)
+		if code != 0 {
+			t.Errorf("%v: exit code %d: %s", tc.args, code, stderr)
+			continue
+		}
+		if !strings.Contains(stdout, tc.stdout) {
+			t.Errorf("%v: unexpected output %q", tc.args, stdout)
+		}
+	}
+
+	if fake.AlertShown() {
+		t.Error("the alert was not accepted")
+	}
+	var typed bool
+	for _, req := range fake.Requests() {
+		if req.Route() == "/wda/keys" && strings.Contains(string(req.Body), `" "`) {
+			typed = true
+		}
+	}
+	if !typed {
+		t.Error("the text was not typed")
+	}
+}
+
+func TestScreenshot(t *testing.T) {
+	fake := newFakeServer(t)
+	fake.SetScreenshot([]byte("\x89PNG\r\n\x1a\nfake"))
+	path := filepath.Join(t.TempDir(), "screen.png")
+
+	code, stdout, stderr := runFake(t, fake, "screenshot", "-o", path, "--json")
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr)
+	}
+	var result struct {
+		Path  string
+		Bytes int
+	}
+	if err := json.Unmarshal([]byte(stdout), &result); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Path != path || result.Bytes != len(raw) || !bytes.HasPrefix(raw, []byte("\x89PNG")) {
+		t.Errorf("unexpected screenshot %+v of %d bytes", result, len(raw))
+	}
+}
+
+func TestErrors(t *testing.T) {
+	fake := newFakeServer(t)
+
+	code, _, stderr := runFake(t, fake, "alert", "text", "--json")
+	if code != 1 {
+		t.Fatalf("exit code %d", code)
+	}
+	var report struct{ Error, Message string }
+	if err := json.Unmarshal([]byte(stderr), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Error != "no such alert" {
+		t.Errorf("unexpected error %+v", report)
+	}
+
+	for _, args := range [][]string{
+		{"tap", "10"},
+		{"app", "state"},
+		{"alert", "close"},
+		{"source", "--format", "yaml"},
+		{"unknown"},
+	} {
+		if code, _, _ := runFake(t, fake, args...); code != 2 {
+			t.Errorf("%v: exit code %d", args, code)
+		}
+	}
+	if code, _, stderr := runFake(t, fake, "tap", "x", "1"); code != 1 || !strings.Contains(stderr, `invalid coordinate "x"`) {
+		t.Errorf("exit code %d: %s", code, stderr)
+	}
+	// the devices are not served to the network without a token
+	for _, addr := range []string{":0", "0.0.0.0:0", "[::]:0"} {
+		if code, _, stderr := runFake(t, fake, "serve", "-addr", addr, "-token="); code != 1 || !strings.Contains(stderr, "requires -token") {
+			t.Errorf("%s: exit code %d: %s", addr, code, stderr)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/electricbubble/gwda"
+)
+
+func runServe(c *cli, args []string) error {
+	flags := c.flagSet("serve")
+	addr := flags.String("addr", "localhost:8100", "address to listen on, other hosts than localhost require a token")
+	token := flags.String("token", os.Getenv("GWDA_TOKEN"), "token required from clients, defaults to $GWDA_TOKEN")
+	port := flags.Int("port", 8100, "WDA port on the devices")
+	mjpegPort := flags.Int("mjpeg-port", 9100, "MJPEG port on the devices")
+	flags.Usage = func() {
+		fmt.Fprint(c.stderr, "usage: gwda serve [flags]\n\n"+
+			"Exposes each device connected via USB at http://<addr>/<serial>,\n"+
+			"and its MJPEG server at http://<addr>/<serial>/mjpeg.\n\n")
+		flags.PrintDefaults()
+	}
+	if _, err := c.parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	// without a token, anyone reaching the address controls the devices
+	if *token == "" && !isLoopback(*addr) {
+		return fmt.Errorf("serving on %s requires -token or $GWDA_TOKEN, or listen on localhost", *addr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	options := []gwda.DeviceOption{gwda.WithPort(*port), gwda.WithMjpegPort(*mjpegPort)}
+	if c.serial != "" {
+		options = append(options, gwda.WithSerialNumber(c.serial))
+	}
+	proxy := gwda.NewProxyServer(gwda.WithProxyToken(*token))
+	watchErr := make(chan error, 1)
+	go func() { watchErr <- proxy.Watch(ctx, options...) }()
+
+	server := &http.Server{Addr: *addr, Handler: proxy}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ListenAndServe() }()
+	fmt.Fprintf(c.stderr, "serving the devices on %s\n", *addr)
+
+	var err error
+	select {
+	case err = <-serveErr:
+	case err = <-watchErr:
+		if errors.Is(err, context.Canceled) {
+			err = nil
+		}
+	}
+	_ = server.Shutdown(context.Background())
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return err
+}
+
+// isLoopback reports whether addr only listens on the loopback interface,
+// an empty host listens on all of them.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,628 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/electricbubble/gwda"
+)
+
+const shellHelp = `Commands are separated by ';', arguments with spaces are quoted with "" or ''.
+
+  find <by> <value>          find the first element, by is one of
+                             id, name, aid, type, predicate, classchain or xpath
+  findall <by> <value>       find all elements
+  <var> = find ...           keep the element in a variable, e.g.
+                             e = find predicate "label == 'OK'"; e.click
+  <var>                      show the element, or the elements of a list
+  <var>[i]                   the element at index i of a list
+  <var>.<method> [args]      call a method of the element:
+                             ` + "%s" + `
+  vars                       list the variables
+  help                       show this help
+  exit                       leave the shell
+
+and the commands of gwda: %s
+`
+
+// errExit leaves the shell.
+var errExit = errors.New("exit")
+
+// shell runs commands typed interactively against one driver.
+type shell struct {
+	c      *cli
+	driver gwda.WebDriver
+	// vars hold a gwda.WebElement or []gwda.WebElement each
+	vars map[string]interface{}
+}
+
+func runShell(c *cli, args []string) error {
+	fs := c.flagSet("shell")
+	historyFile := fs.String("history", defaultHistoryFile(), "file keeping the command history, empty for none")
+	if _, err := c.parse(fs, args, 0, 0); err != nil {
+		return err
+	}
+	return c.withDriver(func(driver gwda.WebDriver) error {
+		c.driver = driver
+		defer func() { c.driver = nil }()
+		sh := &shell{c: c, driver: driver, vars: make(map[string]interface{})}
+		return sh.run(*historyFile)
+	})
+}
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gwda_history")
+}
+
+// run reads the commands until exit. Lines not typed on a terminal are executed until the first error,
+// which is returned. Ctrl-C interrupts the command running.
+func (sh *shell) run(historyFile string) error {
+	var restore func()
+	var err error
+	stdin, isFile := sh.c.stdin.(*os.File)
+	if isFile {
+		// the terminal is only raw while a line is typed
+		if restore, err = makeRaw(stdin); err == nil {
+			restore()
+		}
+	}
+	if !isFile || err != nil {
+		scanner := bufio.NewScanner(sh.c.stdin)
+		for scanner.Scan() {
+			if err = sh.interruptible(scanner.Text()); err != nil {
+				if err == errExit {
+					return nil
+				}
+				return err
+			}
+		}
+		return scanner.Err()
+	}
+
+	editor := newLineEditor(stdin, sh.c.stdout, sh.complete)
+	editor.raw = func() (func(), error) { return makeRaw(stdin) }
+	if raw, err := os.ReadFile(historyFile); err == nil && historyFile != "" {
+		for _, line := range strings.Split(string(raw), "\n") {
+			editor.addHistory(line)
+		}
+	}
+	fmt.Fprint(sh.c.stdout, "Type 'help' for the commands, Tab completes them.\n")
+	for {
+		line, err := editor.readLine("gwda> ")
+		if err == errInterrupted {
+			continue
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		editor.addHistory(line)
+		if err = sh.interruptible(line); err == errExit {
+			break
+		} else if err != nil {
+			fmt.Fprintln(sh.c.stderr, "error:", err)
+		}
+	}
+	if historyFile != "" {
+		_ = os.WriteFile(historyFile, []byte(strings.Join(editor.history, "\n")+"\n"), 0o600)
+	}
+	return nil
+}
+
+// interruptible executes line, canceling its requests on SIGINT rather than exiting.
+func (sh *shell) interruptible(line string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return sh.execute(ctx, line)
+}
+
+// execute runs the commands of line with the requests bound to ctx, up to the first error.
+func (sh *shell) execute(ctx context.Context, line string) error {
+	statements, err := splitStatements(line)
+	if err != nil {
+		return err
+	}
+	driver := sh.driver
+	sh.driver = driver.WithContext(ctx)
+	sh.c.driver = sh.driver
+	defer func() { sh.driver, sh.c.driver = driver, driver }()
+	for _, words := range statements {
+		var name string
+		if len(words) >= 2 && words[1] == "=" {
+			if name = words[0]; !isIdentifier(name) {
+				return fmt.Errorf("invalid variable name %q", name)
+			}
+			if words = words[2:]; len(words) == 0 {
+				return fmt.Errorf("nothing to assign to %s", name)
+			}
+		}
+
+		value, err := sh.call(words)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			if err = sh.print(value); err != nil {
+				return err
+			}
+			continue
+		}
+		switch value.(type) {
+		case gwda.WebElement, []gwda.WebElement:
+			// the elements outlive the line
+			sh.vars[name] = withContext(value, context.Background())
+		default:
+			return fmt.Errorf("only elements can be kept in variables, %s is %T", words[0], value)
+		}
+	}
+	return nil
+}
+
+// call runs the command words and returns its result.
+func (sh *shell) call(words []string) (interface{}, error) {
+	head, args := words[0], words[1:]
+	switch head {
+	case "help":
+		fmt.Fprintf(sh.c.stdout, shellHelp, strings.Join(elementMethods, " "), strings.Join(sh.commandNames(), " "))
+		return nil, nil
+	case "exit", "quit":
+		return nil, errExit
+	case "vars":
+		names := make([]string, 0, len(sh.vars))
+		for name := range sh.vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			switch value := withContext(sh.vars[name], sh.driver.Context()).(type) {
+			case []gwda.WebElement:
+				fmt.Fprintf(sh.c.stdout, "%s\t%d elements\n", name, len(value))
+			case gwda.WebElement:
+				fmt.Fprintf(sh.c.stdout, "%s\t%s\n", name, sh.describe(value))
+			}
+		}
+		return nil, nil
+	case "find", "findall":
+		return find(sh.driver, head == "findall", args)
+	}
+
+	if i := strings.Index(head, "."); i >= 0 {
+		value, err := sh.lookup(head[:i])
+		if err != nil {
+			return nil, err
+		}
+		element, ok := value.(gwda.WebElement)
+		if !ok {
+			return nil, fmt.Errorf("%s is a list, call the methods of its elements, e.g. %s[0]%s", head[:i], head[:i], head[i:])
+		}
+		return callElement(element, head[i+1:], args)
+	}
+	if isIdentifier(strings.SplitN(head, "[", 2)[0]) && len(args) == 0 {
+		if _, known := sh.vars[strings.SplitN(head, "[", 2)[0]]; known {
+			return sh.lookup(head)
+		}
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != head || !shellCommand(cmd.name) {
+			continue
+		}
+		// the flags only apply to this command
+		saved := *sh.c
+		sh.c.command = cmd
+		err := cmd.run(sh.c, args)
+		*sh.c = saved
+		if err == flag.ErrHelp || err == errUsage {
+			// the usage was printed already
+			err = nil
+		}
+		return nil, err
+	}
+	return nil, fmt.Errorf("unknown command %q, try 'help'", head)
+}
+
+// lookup returns the variable of ref, or the element at an index of it, e.g. "cells[2]".
+func (sh *shell) lookup(ref string) (interface{}, error) {
+	name, index := ref, ""
+	if i := strings.Index(ref, "["); i >= 0 && strings.HasSuffix(ref, "]") {
+		name, index = ref[:i], ref[i+1:len(ref)-1]
+	}
+	value, known := sh.vars[name]
+	if !known {
+		return nil, fmt.Errorf("unknown variable %q", name)
+	}
+	value = withContext(value, sh.driver.Context())
+	if index == "" {
+		return value, nil
+	}
+	elements, ok := value.([]gwda.WebElement)
+	if !ok {
+		return nil, fmt.Errorf("%s is a single element", name)
+	}
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 || i >= len(elements) {
+		return nil, fmt.Errorf("invalid index %q of %d elements", index, len(elements))
+	}
+	return elements[i], nil
+}
+
+// withContext returns the element, or the list of elements, with the requests bound to ctx.
+func withContext(value interface{}, ctx context.Context) interface{} {
+	switch value := value.(type) {
+	case gwda.WebElement:
+		return value.WithContext(ctx)
+	case []gwda.WebElement:
+		elements := make([]gwda.WebElement, len(value))
+		for i, element := range value {
+			elements[i] = element.WithContext(ctx)
+		}
+		return elements
+	}
+	return value
+}
+
+// shellCommand reports whether the command of gwda can be run inside the shell.
+func shellCommand(name string) bool {
+	return name != "shell" && name != "serve" && name != "inspect"
+}
+
+func (sh *shell) commandNames() []string {
+	var names []string
+	for _, cmd := range commands {
+		if shellCommand(cmd.name) {
+			names = append(names, cmd.name)
+		}
+	}
+	return names
+}
+
+// finder is a driver or an element, the elements are looked up inside of.
+type finder interface {
+	FindElement(by gwda.BySelector) (gwda.WebElement, error)
+	FindElements(by gwda.BySelector) ([]gwda.WebElement, error)
+}
+
+var findBy = []string{"id", "name", "aid", "type", "predicate", "classchain", "xpath"}
+
+func find(f finder, all bool, args []string) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("usage: find <%s> <value>", strings.Join(findBy, "|"))
+	}
+	by, value := gwda.BySelector{}, strings.Join(args[1:], " ")
+	switch args[0] {
+	case "id":
+		by.Id = value
+	case "name":
+		by.Name = value
+	case "aid":
+		by.AccessibilityId = value
+	case "type":
+		elementType, err := parseElementType(value)
+		if err != nil {
+			return nil, err
+		}
+		by.ClassName = elementType
+	case "predicate":
+		by.Predicate = value
+	case "classchain":
+		by.ClassChain = value
+	case "xpath":
+		by.XPath = value
+	default:
+		return nil, fmt.Errorf("unknown lookup %q, use one of %s", args[0], strings.Join(findBy, ", "))
+	}
+	if all {
+		return f.FindElements(by)
+	}
+	return f.FindElement(by)
+}
+
+// elementTypeNames returns the names of the fields of gwda.ElementType, e.g. "Button".
+func elementTypeNames() []string {
+	t := reflect.TypeOf(gwda.ElementType{})
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i] = t.Field(i).Name
+	}
+	return names
+}
+
+// parseElementType returns the ElementType of a name like "Button" or "XCUIElementTypeButton".
+func parseElementType(name string) (elementType gwda.ElementType, err error) {
+	name = strings.TrimPrefix(name, "XCUIElementType")
+	field := reflect.ValueOf(&elementType).Elem().FieldByNameFunc(func(field string) bool {
+		return strings.EqualFold(field, name)
+	})
+	if !field.IsValid() {
+		return elementType, fmt.Errorf("unknown element type %q", name)
+	}
+	field.SetBool(true)
+	return elementType, nil
+}
+
+var elementMethods = []string{
+	"attr", "attrs", "clear", "click", "displayed", "doubletap", "enabled", "find", "findall",
+	"hold", "rect", "screenshot", "scroll", "selected", "sendkeys", "swipe", "tap", "text", "type",
+}
+
+// callElement calls the method of element, named in lower case.
+func callElement(element gwda.WebElement, method string, args []string) (interface{}, error) {
+	want := func(n int, usage string) error {
+		if len(args) != n {
+			return fmt.Errorf("usage: %s %s", method, usage)
+		}
+		return nil
+	}
+
+	switch method {
+	case "click":
+		return nil, element.Click()
+	case "doubletap":
+		return nil, element.DoubleTap()
+	case "clear":
+		return nil, element.Clear()
+	case "hold":
+		if len(args) == 0 {
+			return nil, element.TouchAndHold()
+		}
+		seconds, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q", args[0])
+		}
+		return nil, element.TouchAndHold(seconds)
+	case "tap":
+		if err := want(2, "x y"); err != nil {
+			return nil, err
+		}
+		coordinates, err := parseFloats(args)
+		if err != nil {
+			return nil, err
+		}
+		return nil, element.TapFloat(coordinates[0], coordinates[1])
+	case "sendkeys":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("usage: sendkeys text")
+		}
+		return nil, element.SendKeys(strings.Join(args, " "))
+	case "swipe", "scroll":
+		if err := want(1, "up|down|left|right"); err != nil {
+			return nil, err
+		}
+		direction := gwda.Direction(args[0])
+		switch direction {
+		case gwda.DirectionUp, gwda.DirectionDown, gwda.DirectionLeft, gwda.DirectionRight:
+		default:
+			return nil, fmt.Errorf("invalid direction %q", args[0])
+		}
+		if method == "swipe" {
+			return nil, element.SwipeDirection(direction)
+		}
+		return nil, element.ScrollDirection(direction)
+	case "rect":
+		return element.Rect()
+	case "text":
+		return element.Text()
+	case "type":
+		return element.Type()
+	case "enabled":
+		return element.IsEnabled()
+	case "displayed":
+		return element.IsDisplayed()
+	case "selected":
+		return element.IsSelected()
+	case "attr":
+		if err := want(1, "name"); err != nil {
+			return nil, err
+		}
+		return element.GetAttribute(gwda.ElementAttribute{args[0]: ""})
+	case "attrs":
+		return attributesOf(element)
+	case "find", "findall":
+		return find(element, method == "findall", args)
+	case "screenshot":
+		if err := want(1, "file"); err != nil {
+			return nil, err
+		}
+		raw, err := element.Screenshot()
+		if err != nil {
+			return nil, err
+		}
+		return args[0], os.WriteFile(args[0], raw.Bytes(), 0o644)
+	}
+	return nil, fmt.Errorf("unknown method %q, use one of %s", method, strings.Join(elementMethods, ", "))
+}
+
+// attributes are printed as a table.
+type attributes [][2]string
+
+var attributeNames = []string{"type", "name", "label", "value", "enabled", "visible", "accessible", "selected"}
+
+func attributesOf(element gwda.WebElement) (attributes, error) {
+	var attrs attributes
+	for _, name := range attributeNames {
+		value, err := element.GetAttribute(gwda.ElementAttribute{name: ""})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, [2]string{name, value})
+	}
+	rect, err := element.Rect()
+	if err != nil {
+		return nil, err
+	}
+	return append(attrs, [2]string{"rect", formatRect(rect)}, [2]string{"UID", element.UID()}), nil
+}
+
+func formatRect(rect gwda.Rect) string {
+	return fmt.Sprintf("{x: %d, y: %d, width: %d, height: %d}", rect.X, rect.Y, rect.Width, rect.Height)
+}
+
+// describe returns a line about element, e.g. `Button name="OK" {x: 10, y: 20, width: 60, height: 44}`.
+func (sh *shell) describe(element gwda.WebElement) string {
+	elementType, err := element.Type()
+	if err != nil {
+		return fmt.Sprintf("%s (%v)", element.UID(), err)
+	}
+	line := strings.TrimPrefix(elementType, "XCUIElementType")
+	for _, name := range []string{"name", "label", "value"} {
+		if value, err := element.GetAttribute(gwda.ElementAttribute{name: ""}); err == nil && value != "" {
+			line += fmt.Sprintf(" %s=%q", name, value)
+		}
+	}
+	if rect, err := element.Rect(); err == nil {
+		line += " " + formatRect(rect)
+	}
+	return line
+}
+
+func (sh *shell) print(value interface{}) error {
+	out := sh.c.stdout
+	switch value := value.(type) {
+	case nil:
+	case gwda.WebElement:
+		fmt.Fprintln(out, sh.describe(value))
+	case []gwda.WebElement:
+		if len(value) == 0 {
+			fmt.Fprintln(out, "no elements")
+		}
+		for i, element := range value {
+			fmt.Fprintf(out, "[%d] %s\n", i, sh.describe(element))
+		}
+	case gwda.Rect:
+		fmt.Fprintln(out, formatRect(value))
+	case attributes:
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, attr := range value {
+			fmt.Fprintf(w, "%s:\t%s\n", attr[0], attr[1])
+		}
+		return w.Flush()
+	default:
+		fmt.Fprintln(out, value)
+	}
+	return nil
+}
+
+// complete returns the candidates for the word ending head: the commands, the variables,
+// the methods of an element after "." and the arguments of find, e.g. the element types.
+func (sh *shell) complete(head string) []string {
+	statement := head[strings.LastIndex(head, ";")+1:]
+	fields := strings.Fields(statement)
+	if len(fields) >= 2 && fields[1] == "=" {
+		fields = fields[2:]
+	}
+	word := ""
+	if !strings.HasSuffix(statement, " ") && len(fields) > 0 {
+		word, fields = fields[len(fields)-1], fields[:len(fields)-1]
+	}
+
+	var candidates []string
+	switch {
+	case strings.Contains(word, "."):
+		word = word[strings.LastIndex(word, ".")+1:]
+		candidates = elementMethods
+	case len(fields) == 0:
+		candidates = append([]string{"exit", "find", "findall", "help", "vars"}, sh.commandNames()...)
+		for name := range sh.vars {
+			candidates = append(candidates, name)
+		}
+	case len(fields) == 1 && (fields[0] == "find" || fields[0] == "findall" ||
+		strings.HasSuffix(fields[0], ".find") || strings.HasSuffix(fields[0], ".findall")):
+		candidates = findBy
+	case len(fields) == 2 && fields[1] == "type" && strings.Contains(fields[0], "find"):
+		candidates = elementTypeNames()
+	case len(fields) == 1 && fields[0] == "app":
+		candidates = []string{"launch", "list", "state", "terminate"}
+	case len(fields) == 1 && fields[0] == "alert":
+		candidates = []string{"accept", "dismiss", "text"}
+	case len(fields) == 1 && (strings.HasSuffix(fields[0], ".swipe") || strings.HasSuffix(fields[0], ".scroll")):
+		candidates = []string{"down", "left", "right", "up"}
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// splitStatements splits line into statements at ';' and these into words at spaces,
+// keeping quoted spaces: `find predicate "label == 'OK'"; e.click`.
+func splitStatements(line string) ([][]string, error) {
+	var statements [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endStatement := func() {
+		endWord()
+		if len(words) > 0 {
+			statements = append(statements, words)
+			words = nil
+		}
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; r {
+		case ' ', '\t':
+			endWord()
+		case ';':
+			endStatement()
+		case '"', '\'':
+			inWord = true
+			for i++; ; i++ {
+				if i == len(runes) {
+					return nil, fmt.Errorf("missing closing %c", r)
+				}
+				if runes[i] == r {
+					break
+				}
+				if r == '"' && runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				word.WriteRune(runes[i])
+			}
+		default:
+			inWord = true
+			word.WriteRune(r)
+		}
+	}
+	endStatement()
+	return statements, nil
+}
+
+func isIdentifier(s string) bool {
+	for i, r := range s {
+		if !(r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')) {
+			return false
+		}
+	}
+	return s != ""
+}
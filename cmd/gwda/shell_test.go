@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/electricbubble/gwda"
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func TestShell(t *testing.T) {
+	fake := newFakeServer(t)
+	var clicked bool
+	fake.SetUI(&wdatest.Element{Type: "Application", Name: "Settings", Width: 390, Height: 844, Children: []*wdatest.Element{
+		{Type: "Button", Name: "OK", Label: "OK", X: 10, Y: 20, Width: 60, Height: 44, OnClick: func() { clicked = true }},
+		{Type: "Cell", Name: "General", Y: 100, Width: 390, Height: 44},
+		{Type: "Cell", Name: "Privacy", Y: 144, Width: 390, Height: 44},
+		{Type: "TextField", Name: "search", Y: 200, Width: 390, Height: 30},
+	}})
+
+	script := strings.Join([]string{
+		`e = find name OK; e.click`,
+		`e.rect`,
+		`cells = findall type Cell`,
+		`cells`,
+		`cells[1].attrs`,
+		`field = find classchain "**/XCUIElementTypeTextField"; field.sendkeys "hello world"; field.text`,
+		`vars`,
+		`app state com.apple.Preferences`,
+		`exit`,
+		`e.click`,
+	}, "\n")
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"--url", fake.URL, "shell", "-history", ""}, strings.NewReader(script), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if !clicked {
+		t.Error("the button was not clicked")
+	}
+	for _, want := range []string{
+		"{x: 10, y: 20, width: 60, height: 44}",
+		`[0] Cell name="General" {x: 0, y: 100, width: 390, height: 44}`,
+		`[1] Cell name="Privacy"`,
+		"name:        Privacy",
+		"hello world",
+		"cells\t2 elements",
+		`e	Button name="OK" label="OK"`,
+		"Not Running",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("missing %q in\n%s", want, stdout.String())
+		}
+	}
+
+	// the commands piped in stop at the first error
+	stdout.Reset()
+	stderr.Reset()
+	code = run([]string{"--url", fake.URL, "shell", "-history", ""}, strings.NewReader("find name missing\nhome\n"), &stdout, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "no such element") {
+		t.Errorf("exit code %d: %s", code, stderr.String())
+	}
+}
+
+func newTestShell(t *testing.T) *shell {
+	driver, err := gwda.NewDriver(nil, newFakeServer(t).URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = driver.Close() })
+	c := &cli{stdout: io.Discard, stderr: io.Discard, driver: driver}
+	return &shell{c: c, driver: driver, vars: map[string]interface{}{}}
+}
+
+func TestShell_Errors(t *testing.T) {
+	sh := newTestShell(t)
+	for _, line := range []string{
+		`x.click`,
+		`1x = find name OK`,
+		`find label OK`,
+		`find type Buton`,
+		`find name "OK`,
+		`nothing`,
+	} {
+		if err := sh.execute(context.Background(), line); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+}
+
+func TestShell_Interrupted(t *testing.T) {
+	sh := newTestShell(t)
+	if err := sh.execute(context.Background(), "e = find name General"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sh.execute(ctx, "e.click"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	// the variables are not bound to the line interrupted
+	if err := sh.execute(context.Background(), "e.click"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_splitStatements(t *testing.T) {
+	statements, err := splitStatements(`e = find predicate "label == 'OK'"; e.click;; type 'a "b"' "c\"d"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"e", "=", "find", "predicate", "label == 'OK'"},
+		{"e.click"},
+		{"type", `a "b"`, `c"d`},
+	}
+	if !reflect.DeepEqual(statements, want) {
+		t.Errorf("got %q", statements)
+	}
+}
+
+func TestShell_complete(t *testing.T) {
+	sh := &shell{vars: map[string]interface{}{"elem": nil}}
+	for _, tc := range []struct {
+		head string
+		want []string
+	}{
+		{"fi", []string{"find", "findall"}},
+		{"el", []string{"elem"}},
+		{"elem.cl", []string{"clear", "click"}},
+		{"x = find ", []string{"aid", "classchain", "id", "name", "predicate", "type", "xpath"}},
+		{"find type Butt", []string{"Button"}},
+		{"e.find type Cel", []string{"Cell"}},
+		{"home; ap", []string{"app"}},
+		{"app t", []string{"terminate"}},
+		{"elem.swipe ", []string{"down", "left", "right", "up"}},
+		{"tap ", nil},
+	} {
+		if got := sh.complete(tc.head); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.head, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw is not supported on this platform, the shell reads whole lines instead.
+func makeRaw(_ *os.File) (restore func(), err error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
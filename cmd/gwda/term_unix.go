@@ -0,0 +1,38 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// makeRaw puts the terminal f into raw mode, so the keys are read as they are typed,
+// and returns the function restoring the previous mode. It fails if f is not a terminal.
+func makeRaw(f *os.File) (restore func(), err error) {
+	var old syscall.Termios
+	if err = termios(f, ioctlGetTermios, &old); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err = termios(f, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { _ = termios(f, ioctlSetTermios, &old) }, nil
+}
+
+func termios(f *os.File, request uintptr, t *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(unsafe.Pointer(t)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
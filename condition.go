@@ -0,0 +1,271 @@
+package gwda
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// conditionReport is filled by the conditions of this package while Wait evaluates them,
+// so a timeout tells what was waited for and what was observed last.
+type conditionReport struct {
+	description string
+	observed    string
+}
+
+func (r conditionReport) describe() string {
+	if r.description == "" {
+		return "condition"
+	}
+	return r.description
+}
+
+func (r conditionReport) String() string {
+	if r.observed == "" {
+		return r.describe()
+	}
+	return r.describe() + " (" + r.observed + ")"
+}
+
+// report records the description and observation of a condition,
+// it has no effect if the condition is not evaluated by Wait.
+func report(wd WebDriver, description, observed string) {
+	if rwd, ok := wd.(*remoteWD); ok && rwd.report != nil {
+		rwd.report.description, rwd.report.observed = description, observed
+	}
+}
+
+// evaluateCondition calls condition with a report of its own.
+func evaluateCondition(wd WebDriver, condition Condition) (done bool, r conditionReport, err error) {
+	if rwd, ok := wd.(*remoteWD); ok {
+		view := *rwd
+		view.report = &r
+		wd = &view
+	}
+	done, err = condition(wd)
+	return
+}
+
+// ElementPresent is met once an element matches by.
+func ElementPresent(by BySelector) Condition {
+	description := "element present " + describeSelector(by)
+	return func(wd WebDriver) (bool, error) {
+		element, observed, err := findConditionElement(wd, by)
+		report(wd, description, observed)
+		return element != nil, err
+	}
+}
+
+// ElementAbsent is met once no element matches by.
+func ElementAbsent(by BySelector) Condition {
+	description := "element absent " + describeSelector(by)
+	return func(wd WebDriver) (bool, error) {
+		element, observed, err := findConditionElement(wd, by)
+		report(wd, description, observed)
+		return element == nil && err == nil, err
+	}
+}
+
+// ElementVisible is met once an element matches by and is displayed.
+func ElementVisible(by BySelector) Condition {
+	return elementCondition("element visible "+describeSelector(by), by, func(element WebElement) (bool, string, error) {
+		displayed, err := element.IsDisplayed()
+		if err != nil {
+			return false, "", err
+		}
+		return displayed, fmt.Sprintf("displayed %v", displayed), nil
+	})
+}
+
+// ElementEnabled is met once an element matches by and is enabled.
+func ElementEnabled(by BySelector) Condition {
+	return elementCondition("element enabled "+describeSelector(by), by, func(element WebElement) (bool, string, error) {
+		enabled, err := element.IsEnabled()
+		if err != nil {
+			return false, "", err
+		}
+		return enabled, fmt.Sprintf("enabled %v", enabled), nil
+	})
+}
+
+// TextEquals is met once an element matches by and its text is text.
+func TextEquals(by BySelector, text string) Condition {
+	return elementCondition(fmt.Sprintf("text %q of element %s", text, describeSelector(by)), by, func(element WebElement) (bool, string, error) {
+		actual, err := element.Text()
+		if err != nil {
+			return false, "", err
+		}
+		return actual == text, fmt.Sprintf("text %q", actual), nil
+	})
+}
+
+// TextContains is met once an element matches by and its text contains substr.
+func TextContains(by BySelector, substr string) Condition {
+	return elementCondition(fmt.Sprintf("text containing %q of element %s", substr, describeSelector(by)), by, func(element WebElement) (bool, string, error) {
+		actual, err := element.Text()
+		if err != nil {
+			return false, "", err
+		}
+		return strings.Contains(actual, substr), fmt.Sprintf("text %q", actual), nil
+	})
+}
+
+// AlertPresent is met once an alert is shown.
+func AlertPresent() Condition {
+	return func(wd WebDriver) (bool, error) {
+		text, err := wd.AlertText()
+		if errors.Is(err, ErrNoSuchAlert) {
+			report(wd, "alert present", "no alert")
+			return false, nil
+		}
+		if err != nil {
+			report(wd, "alert present", err.Error())
+			return false, err
+		}
+		report(wd, "alert present", fmt.Sprintf("alert %q", text))
+		return true, nil
+	}
+}
+
+// AppInState is met once the application is in state, e.g. AppStateRunningFront.
+func AppInState(bundleId string, state AppState) Condition {
+	description := fmt.Sprintf("%s in state %s", bundleId, state)
+	return func(wd WebDriver) (bool, error) {
+		actual, err := wd.AppState(bundleId)
+		if err != nil {
+			report(wd, description, err.Error())
+			return false, err
+		}
+		report(wd, description, "state "+actual.String())
+		return actual == state, nil
+	}
+}
+
+// ScreenStable is met once two consecutive screenshots are equal,
+// i.e. animations and loading are finished.
+// The condition remembers the last screenshot, so it must not be shared between waits.
+func ScreenStable() Condition {
+	var previous []byte
+	return func(wd WebDriver) (bool, error) {
+		screenshot, err := wd.Screenshot()
+		if err != nil {
+			report(wd, "screen stable", err.Error())
+			return false, err
+		}
+		current := screenshot.Bytes()
+		stable := previous != nil && bytes.Equal(previous, current)
+		switch {
+		case previous == nil:
+			report(wd, "screen stable", "first screenshot")
+		case stable:
+			report(wd, "screen stable", "screen unchanged")
+		default:
+			report(wd, "screen stable", "screen changed")
+		}
+		previous = current
+		return stable, nil
+	}
+}
+
+// KeyboardShown is met once the on-screen keyboard is shown.
+func KeyboardShown() Condition {
+	by := BySelector{ClassName: ElementType{Keyboard: true}}
+	return func(wd WebDriver) (bool, error) {
+		element, _, err := findConditionElement(wd, by)
+		if element != nil {
+			report(wd, "keyboard shown", "keyboard shown")
+		} else {
+			report(wd, "keyboard shown", "no keyboard")
+		}
+		return element != nil, err
+	}
+}
+
+// And is met once all conditions are met, they are evaluated in order until one is not met.
+func And(conditions ...Condition) Condition {
+	return func(wd WebDriver) (bool, error) {
+		var descriptions, observations []string
+		for _, condition := range conditions {
+			done, r, err := evaluateCondition(wd, condition)
+			if err != nil || !done {
+				// the condition not met tells what is missing
+				report(wd, r.describe(), r.observed)
+				return false, err
+			}
+			descriptions = append(descriptions, r.describe())
+			observations = append(observations, r.String())
+		}
+		report(wd, strings.Join(descriptions, " and "), strings.Join(observations, "; "))
+		return true, nil
+	}
+}
+
+// Or is met once any of the conditions is met, they are evaluated in order until one is met.
+func Or(conditions ...Condition) Condition {
+	return func(wd WebDriver) (bool, error) {
+		var descriptions, observations []string
+		for _, condition := range conditions {
+			done, r, err := evaluateCondition(wd, condition)
+			if err != nil || done {
+				report(wd, r.describe(), r.observed)
+				return done, err
+			}
+			descriptions = append(descriptions, r.describe())
+			observations = append(observations, r.String())
+		}
+		report(wd, strings.Join(descriptions, " or "), strings.Join(observations, "; "))
+		return false, nil
+	}
+}
+
+// Not is met while condition is not met.
+func Not(condition Condition) Condition {
+	return func(wd WebDriver) (bool, error) {
+		done, r, err := evaluateCondition(wd, condition)
+		report(wd, "not "+r.describe(), r.observed)
+		if err != nil {
+			return false, err
+		}
+		return !done, nil
+	}
+}
+
+func describeSelector(by BySelector) string {
+	using, value := by.getUsingAndValue()
+	return fmt.Sprintf("using '%s', value '%s'", using, value)
+}
+
+// findConditionElement returns a nil element without an error if no element matches by.
+func findConditionElement(wd WebDriver, by BySelector) (element WebElement, observed string, err error) {
+	if element, err = wd.FindElement(by); err != nil {
+		if errors.Is(err, ErrNoSuchElement) {
+			return nil, "no such element", nil
+		}
+		return nil, err.Error(), err
+	}
+	return element, "element found", nil
+}
+
+// elementCondition is met once an element matches by and check reports true for it,
+// an element gone stale in between counts as not found.
+func elementCondition(description string, by BySelector, check func(element WebElement) (bool, string, error)) Condition {
+	return func(wd WebDriver) (bool, error) {
+		element, observed, err := findConditionElement(wd, by)
+		if element == nil {
+			report(wd, description, observed)
+			return false, err
+		}
+		done, observed, err := check(element)
+		if errors.Is(err, ErrStaleElementReference) {
+			report(wd, description, "stale element")
+			return false, nil
+		}
+		if err != nil {
+			report(wd, description, err.Error())
+			return false, err
+		}
+		report(wd, description, observed)
+		return done, nil
+	}
+}
@@ -0,0 +1,115 @@
+package gwda
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConditions(t *testing.T) {
+	var mu sync.Mutex
+	var buttonShown, alertShown bool
+	var screenshots int
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/session/test-session/element", func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&data)
+		mu.Lock()
+		defer mu.Unlock()
+		if data["value"] == "Login" && buttonShown || data["value"] == "XCUIElementTypeKeyboard" {
+			_, _ = w.Write([]byte(`{"value":{"ELEMENT":"login"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"value":{"error":"no such element","message":"unable to find an element"}}`))
+	})
+	mux.HandleFunc("/session/test-session/element/login/displayed", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"value":true}`))
+	})
+	mux.HandleFunc("/session/test-session/element/login/enabled", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"value":false}`))
+	})
+	mux.HandleFunc("/session/test-session/element/login/text", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"value":"Log in"}`))
+	})
+	mux.HandleFunc("/session/test-session/alert/text", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if alertShown {
+			_, _ = w.Write([]byte(`{"value":"Allow?"}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"value":{"error":"no such alert","message":"no alert"}}`))
+	})
+	mux.HandleFunc("/session/test-session/wda/apps/state", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"value":4}`))
+	})
+	mux.HandleFunc("/session/test-session/screenshot", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		screenshots++
+		frame := screenshots
+		mu.Unlock()
+		if frame > 3 {
+			frame = 3
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"value": base64.StdEncoding.EncodeToString([]byte{byte(frame)})})
+	})
+	wd := newTestDriver(t, mux)
+
+	login := BySelector{Name: "Login"}
+	wait := func(condition Condition) error {
+		return wd.WaitWithTimeoutAndInterval(condition, 30*time.Millisecond, 5*time.Millisecond)
+	}
+	expectTimeout := func(condition Condition, substrs ...string) {
+		t.Helper()
+		err := wait(condition)
+		if !errors.Is(err, ErrTimeout) {
+			t.Fatalf("got %v, want %v", err, ErrTimeout)
+		}
+		for _, substr := range substrs {
+			if !strings.Contains(err.Error(), substr) {
+				t.Fatalf("%q does not contain %q", err, substr)
+			}
+		}
+	}
+
+	expectTimeout(ElementPresent(login), "waiting for element present using 'name', value 'Login'", "last observed: no such element")
+	if err := wait(ElementAbsent(login)); err != nil {
+		t.Fatal(err)
+	}
+	expectTimeout(AlertPresent(), "waiting for alert present, last observed: no alert")
+
+	mu.Lock()
+	buttonShown, alertShown = true, true
+	mu.Unlock()
+	for _, condition := range []Condition{
+		ElementPresent(login), ElementVisible(login), TextEquals(login, "Log in"), TextContains(login, "in"),
+		AlertPresent(), AppInState("com.apple.Preferences", AppStateRunningFront), ScreenStable(), KeyboardShown(),
+		Not(ElementEnabled(login)), And(ElementPresent(login), AlertPresent()), Or(ElementEnabled(login), AlertPresent()),
+	} {
+		if err := wait(condition); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectTimeout(ElementEnabled(login), "waiting for element enabled using 'name', value 'Login', last observed: enabled false")
+	expectTimeout(TextEquals(login, "Sign in"), `waiting for text "Sign in" of element using 'name', value 'Login', last observed: text "Log in"`)
+	expectTimeout(AppInState("com.apple.Preferences", AppStateNotRunning), "waiting for com.apple.Preferences in state Not Running, last observed: state Running (Front)")
+	expectTimeout(And(ElementVisible(login), ElementEnabled(login)), "waiting for element enabled", "last observed: enabled false")
+	expectTimeout(Or(ElementEnabled(login), Not(AlertPresent())),
+		"waiting for element enabled using 'name', value 'Login' or not alert present",
+		`last observed: element enabled using 'name', value 'Login' (enabled false); not alert present (alert "Allow?")`)
+	expectTimeout(Not(ElementPresent(login)), "waiting for not element present", "last observed: element found")
+
+	err := wait(func(wd WebDriver) (bool, error) { return false, nil })
+	if !errors.Is(err, ErrTimeout) || strings.Contains(err.Error(), "waiting for") {
+		t.Fatalf("unexpected error for a custom condition: %v", err)
+	}
+}
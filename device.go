@@ -1,6 +1,7 @@
 package gwda
 
 import (
+	"context"
 	"fmt"
 
 	giDevice "github.com/electricbubble/gidevice"
@@ -99,6 +100,127 @@ func DeviceList() (devices []Device, err error) {
 	return
 }
 
+// DeviceEventType tells whether a device was plugged in or unplugged.
+type DeviceEventType int
+
+const (
+	DeviceAttached DeviceEventType = iota
+	DeviceDetached
+)
+
+func (t DeviceEventType) String() string {
+	if t == DeviceDetached {
+		return "Detached"
+	}
+	return "Attached"
+}
+
+// DeviceEvent is sent by WatchDevices when a device is plugged in or unplugged.
+type DeviceEvent struct {
+	Type   DeviceEventType
+	Device Device
+}
+
+// WatchDevices sends an event for every device attached or detached until ctx is done,
+// starting with the ones attached already. Devices are reported with the ports set
+// by WithPort and WithMjpegPort, WithSerialNumber limits the events to that device.
+//
+//	events, err := gwda.WatchDevices(ctx)
+//	for event := range events {
+//		if event.Type == gwda.DeviceAttached {
+//			driver, err := gwda.NewUSBDriver(nil, event.Device)
+//			...
+//		}
+//	}
+func WatchDevices(ctx context.Context, options ...DeviceOption) (<-chan DeviceEvent, error) {
+	usbmux, err := giDevice.NewUsbmux()
+	if err != nil {
+		return nil, fmt.Errorf("usbmuxd: %w", err)
+	}
+	return watchDevices(ctx, usbmux, options...)
+}
+
+// isListed reports whether usbmuxd still lists the device with the id.
+func isListed(usbmux giDevice.Usbmux, id int) bool {
+	devices, err := usbmux.Devices()
+	if err != nil {
+		return false
+	}
+	for _, d := range devices {
+		if d.Properties().DeviceID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func watchDevices(ctx context.Context, usbmux giDevice.Usbmux, options ...DeviceOption) (<-chan DeviceEvent, error) {
+	notifier := make(chan giDevice.Device)
+	cancel, err := usbmux.Listen(notifier)
+	if err != nil {
+		return nil, fmt.Errorf("usbmuxd listen: %w", err)
+	}
+
+	template := Device{Port: defaultPort, MjpegPort: defaultMjpegPort}
+	for _, option := range options {
+		option(&template)
+	}
+
+	events := make(chan DeviceEvent)
+	go func() {
+		defer close(events)
+		defer func() {
+			cancel()
+			// the notifier is closed once the listener stopped
+			for range notifier {
+			}
+		}()
+
+		attached := make(map[int]Device)
+		for {
+			var d giDevice.Device
+			var ok bool
+			select {
+			case <-ctx.Done():
+				return
+			case d, ok = <-notifier:
+				if !ok {
+					return
+				}
+			}
+
+			// a detached device is only reported with its id,
+			// but so are the other messages like a paired one
+			properties := d.Properties()
+			event := DeviceEvent{Type: DeviceAttached}
+			if properties.SerialNumber == "" {
+				device, known := attached[properties.DeviceID]
+				if !known || isListed(usbmux, properties.DeviceID) {
+					continue
+				}
+				delete(attached, properties.DeviceID)
+				event = DeviceEvent{Type: DeviceDetached, Device: device}
+			} else {
+				if template.serialNumber != "" && properties.SerialNumber != template.serialNumber {
+					continue
+				}
+				event.Device = template
+				event.Device.deviceID = properties.DeviceID
+				event.Device.serialNumber = properties.SerialNumber
+				event.Device.d = d
+				attached[properties.DeviceID] = event.Device
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case events <- event:
+			}
+		}
+	}()
+	return events, nil
+}
+
 func (d Device) DeviceID() int {
 	return d.deviceID
 }
@@ -0,0 +1,209 @@
+package gwda
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	giDevice "github.com/electricbubble/gidevice"
+)
+
+type fakeUsbmuxDevice struct {
+	giDevice.Device
+	properties giDevice.DeviceProperties
+	// addrs are the TCP addresses the ports of the device are connected to
+	addrs map[int]string
+}
+
+func (d fakeUsbmuxDevice) Properties() giDevice.DeviceProperties {
+	return d.properties
+}
+
+func (d fakeUsbmuxDevice) NewConnect(port int, _ ...time.Duration) (giDevice.InnerConn, error) {
+	addr, ok := d.addrs[port]
+	if !ok {
+		return nil, fmt.Errorf("port %d is not listening", port)
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return fakeInnerConn{conn: conn}, nil
+}
+
+type fakeInnerConn struct {
+	giDevice.InnerConn
+	conn net.Conn
+}
+
+func (c fakeInnerConn) RawConn() net.Conn { return c.conn }
+
+func (c fakeInnerConn) Close() { _ = c.conn.Close() }
+
+// newFakeDevice returns a device whose ports are connected to the TCP addresses.
+func newFakeDevice(serial string, addrs map[int]string) Device {
+	return Device{
+		serialNumber: serial,
+		Port:         defaultPort,
+		MjpegPort:    defaultMjpegPort,
+		d:            fakeUsbmuxDevice{properties: giDevice.DeviceProperties{SerialNumber: serial}, addrs: addrs},
+	}
+}
+
+// fakeUsbmux notifies the listener of the devices sent to plug,
+// and like gidevice closes the notifier once canceled.
+type fakeUsbmux struct {
+	plug     chan giDevice.Device
+	canceled chan struct{}
+
+	mu      sync.Mutex
+	devices map[int]giDevice.Device
+}
+
+func newFakeUsbmux() *fakeUsbmux {
+	return &fakeUsbmux{
+		plug:     make(chan giDevice.Device),
+		canceled: make(chan struct{}),
+		devices:  make(map[int]giDevice.Device),
+	}
+}
+
+func (u *fakeUsbmux) Devices() ([]giDevice.Device, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	devices := make([]giDevice.Device, 0, len(u.devices))
+	for _, d := range u.devices {
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+func (u *fakeUsbmux) ReadBUID() (string, error) { return "", nil }
+
+func (u *fakeUsbmux) Listen(notifier chan giDevice.Device) (context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer close(u.canceled)
+		defer close(notifier)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case d := <-u.plug:
+				select {
+				case notifier <- d:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return cancel, nil
+}
+
+func (u *fakeUsbmux) attach(id int, serial string) {
+	d := fakeUsbmuxDevice{properties: giDevice.DeviceProperties{DeviceID: id, SerialNumber: serial}}
+	u.mu.Lock()
+	u.devices[id] = d
+	u.mu.Unlock()
+	u.plug <- d
+}
+
+func (u *fakeUsbmux) detach(id int) {
+	u.mu.Lock()
+	delete(u.devices, id)
+	u.mu.Unlock()
+	u.plug <- fakeUsbmuxDevice{properties: giDevice.DeviceProperties{DeviceID: id}}
+}
+
+// pair notifies like gidevice a message of the attached device other than Attached,
+// which only carries its id.
+func (u *fakeUsbmux) pair(id int) {
+	u.plug <- fakeUsbmuxDevice{properties: giDevice.DeviceProperties{DeviceID: id}}
+}
+
+func Test_watchDevices(t *testing.T) {
+	usbmux := newFakeUsbmux()
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := watchDevices(ctx, usbmux, WithPort(8200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() DeviceEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no device event")
+		}
+		return DeviceEvent{}
+	}
+
+	go func() {
+		usbmux.attach(1, "00008030-A")
+		usbmux.attach(2, "00008030-B")
+		// unknown devices are ignored
+		usbmux.detach(9)
+		// and the devices still attached are not detached when paired
+		usbmux.pair(2)
+		usbmux.detach(1)
+	}()
+	for _, want := range []struct {
+		eventType DeviceEventType
+		id        int
+		serial    string
+	}{
+		{DeviceAttached, 1, "00008030-A"},
+		{DeviceAttached, 2, "00008030-B"},
+		{DeviceDetached, 1, "00008030-A"},
+	} {
+		event := next()
+		if event.Type != want.eventType || event.Device.DeviceID() != want.id || event.Device.SerialNumber() != want.serial {
+			t.Fatalf("got %s %d %s, want %s %d %s", event.Type, event.Device.DeviceID(), event.Device.SerialNumber(),
+				want.eventType, want.id, want.serial)
+		}
+		if event.Device.Port != 8200 || event.Device.MjpegPort != defaultMjpegPort {
+			t.Errorf("ports %d %d", event.Device.Port, event.Device.MjpegPort)
+		}
+	}
+
+	cancel()
+	select {
+	case <-usbmux.canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the listener was not canceled")
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("events not closed")
+	}
+}
+
+func Test_watchDevices_SerialNumber(t *testing.T) {
+	usbmux := newFakeUsbmux()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := watchDevices(ctx, usbmux, WithSerialNumber("00008030-B"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		usbmux.attach(1, "00008030-A")
+		usbmux.attach(2, "00008030-B")
+		usbmux.detach(1)
+		usbmux.detach(2)
+	}()
+	for _, want := range []DeviceEventType{DeviceAttached, DeviceDetached} {
+		select {
+		case event := <-events:
+			if event.Type != want || event.Device.SerialNumber() != "00008030-B" {
+				t.Fatalf("unexpected event %s %s", event.Type, event.Device.SerialNumber())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no device event")
+		}
+	}
+}
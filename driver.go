@@ -2,15 +2,18 @@ package gwda
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
 	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,34 +21,220 @@ import (
 	giDevice "github.com/electricbubble/gidevice"
 )
 
+// DriverOption configures the driver created by NewDriverWithOptions, NewDriverWithOutNewSessionWithOptions or NewUSBDriver.
+//
+// A Device or a DeviceOption is a DriverOption as well,
+// they pick the device of NewUSBDriver and the MJPEG port of all drivers.
+//
+//	driver, err := gwda.NewUSBDriver(nil, gwda.WithSerialNumber("xxxx"), gwda.WithSessionRecovery(nil))
+type DriverOption interface {
+	applyDriverOption(opts *driverOptions)
+}
+
+type driverOptionFunc func(opts *driverOptions)
+
+func (f driverOptionFunc) applyDriverOption(opts *driverOptions) {
+	f(opts)
+}
+
+func (d Device) applyDriverOption(opts *driverOptions) {
+	dev := d
+	opts.device = &dev
+}
+
+func (opt DeviceOption) applyDriverOption(opts *driverOptions) {
+	opts.deviceOptions = append(opts.deviceOptions, opt)
+}
+
+type driverOptions struct {
+	device        *Device
+	deviceOptions []DeviceOption
+
+	sessionRecovery bool
+	onRecovered     func(oldSessionId string, sessionInfo SessionInfo)
+
+	localQueries   bool
+	snapshotMaxAge time.Duration
+
+	cassette *Cassette
+
+	httpClient   *http.Client
+	logger       Logger
+	waitTimeout  time.Duration
+	waitInterval time.Duration
+	keepAlive    *time.Duration
+
+	usbConnections int
+
+	requestLogger RequestLogger
+	logBodyLimit  *int
+	redactKeys    bool
+
+	middleware []Middleware
+	metrics    MetricsCollector
+	tracer     Tracer
+}
+
+// WithHTTPClient sends the requests of the driver with client instead of HTTPClient.
+// A driver connected via USB keeps its own connection, only the Timeout of client applies to it.
+func WithHTTPClient(client *http.Client) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.httpClient = client
+	})
+}
+
+// WithLogger writes the debug output of the driver to logger, regardless of SetDebug.
+func WithLogger(logger Logger) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.logger = logger
+	})
+}
+
+// WithWaitTimeout sets the timeout of Wait, instead of DefaultWaitTimeout.
+func WithWaitTimeout(timeout time.Duration) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.waitTimeout = timeout
+	})
+}
+
+// WithWaitInterval sets the polling interval of Wait and WaitWithTimeout, instead of DefaultWaitInterval.
+func WithWaitInterval(interval time.Duration) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.waitInterval = interval
+	})
+}
+
+// WithKeepAlive checks the health of WDA every interval, instead of DefaultKeepAliveInterval,
+// until the driver is closed. An interval <= 0 disables the checks.
+// Changes of the health are published by HealthEvents.
+//
+// Drivers connected via USB keep alive by default, others only with this option.
+func WithKeepAlive(interval time.Duration) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.keepAlive = &interval
+	})
+}
+
+// WithUSBConnections limits the usbmux connections to WDA of a driver connected via USB,
+// by default to 4. Requests beyond the limit wait for a free connection.
+func WithUSBConnections(n int) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.usbConnections = n
+	})
+}
+
+func newDriverOptions(options []DriverOption) *driverOptions {
+	opts := new(driverOptions)
+	for _, option := range options {
+		option.applyDriverOption(opts)
+	}
+	return opts
+}
+
+// defaultUSBConnections is the number of concurrent requests of a driver connected via USB,
+// WDA handles most commands one after the other anyway.
+const defaultUSBConnections = 4
+
+func (opts *driverOptions) usbConnectionsOrDefault() int {
+	if opts.usbConnections > 0 {
+		return opts.usbConnections
+	}
+	return defaultUSBConnections
+}
+
+func (opts *driverOptions) waitTimeoutOrDefault() time.Duration {
+	if opts.waitTimeout > 0 {
+		return opts.waitTimeout
+	}
+	return DefaultWaitTimeout
+}
+
+func (opts *driverOptions) waitIntervalOrDefault() time.Duration {
+	if opts.waitInterval > 0 {
+		return opts.waitInterval
+	}
+	return DefaultWaitInterval
+}
+
+// mjpegPort returns the MJPEG port of the drivers connected via TCP.
+func (opts *driverOptions) mjpegPort() int {
+	dev := Device{MjpegPort: defaultMjpegPort}
+	if opts.device != nil {
+		dev = *opts.device
+	}
+	for _, option := range opts.deviceOptions {
+		option(&dev)
+	}
+	return dev.MjpegPort
+}
+
+// usbDevice returns the device of NewUSBDriver, the first attached one unless specified.
+func (opts *driverOptions) usbDevice() (dev Device, err error) {
+	if opts.device == nil {
+		var device *Device
+		if device, err = NewDevice(opts.deviceOptions...); err != nil {
+			return Device{}, err
+		}
+		return *device, nil
+	}
+	dev = *opts.device
+	for _, option := range opts.deviceOptions {
+		option(&dev)
+	}
+	return dev, nil
+}
+
+// WithSessionRecovery Creates a new session once WDA reports the current one as invalid,
+// which happens after WDA crashed or was relaunched.
+// The new session is started with the Capabilities of the last NewSession call,
+// the failed request is retried if it is idempotent (GET requests and element lookups).
+//
+// onRecovered is called after each recovery if not nil,
+// the app under test may have been relaunched by then.
+func WithSessionRecovery(onRecovered func(oldSessionId string, sessionInfo SessionInfo)) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.sessionRecovery = true
+		opts.onRecovered = onRecovered
+	})
+}
+
 // NewDriver creates new remote client, this will also start a new session.
+// The other options of the driver are given to NewDriverWithOptions,
+// where the MJPEG port is set by WithMjpegPort.
 func NewDriver(capabilities Capabilities, urlPrefix string, mjpegPort ...int) (driver WebDriver, err error) {
-	if len(mjpegPort) == 0 {
-		mjpegPort = []int{defaultMjpegPort}
-	}
-	wd := new(remoteWD)
+	return NewDriverWithOptions(capabilities, urlPrefix, mjpegPortOptions(mjpegPort)...)
+}
+
+// NewDriverWithOptions creates new remote client configured by options, this will also start a new session.
+//
+//	driver, err := gwda.NewDriverWithOptions(nil, "http://localhost:8100", gwda.WithMjpegPort(9100), gwda.WithKeepAlive(time.Minute))
+func NewDriverWithOptions(capabilities Capabilities, urlPrefix string, options ...DriverOption) (driver WebDriver, err error) {
+	wd := newRemoteWD()
+	wd.options = newDriverOptions(options)
 	if wd.urlPrefix, err = url.Parse(urlPrefix); err != nil {
 		return nil, err
 	}
-	var sessionInfo SessionInfo
-	if sessionInfo, err = wd.NewSession(capabilities); err != nil {
+	if _, err = wd.NewSession(capabilities); err != nil {
 		return nil, err
 	}
-	wd.sessionId = sessionInfo.SessionId
 
-	if wd.mjpegConn, err = net.Dial("tcp", fmt.Sprintf("%s:%d", wd.urlPrefix.Hostname(), mjpegPort[0])); err != nil {
-		return nil, err
+	wd.initMjpegClient()
+	if wd.options.keepAlive != nil {
+		wd.supervisor.start(wd, *wd.options.keepAlive)
 	}
-	wd.mjpegClient = convertToHTTPClient(wd.mjpegConn)
 
 	return wd, nil
 }
 
 func NewDriverWithOutNewSession(capabilities Capabilities, urlPrefix string, mjpegPort ...int) (driver WebDriver, err error) {
-	if len(mjpegPort) == 0 {
-		mjpegPort = []int{defaultMjpegPort}
-	}
-	wd := new(remoteWD)
+	return NewDriverWithOutNewSessionWithOptions(capabilities, urlPrefix, mjpegPortOptions(mjpegPort)...)
+}
+
+// NewDriverWithOutNewSessionWithOptions creates new remote client configured by options,
+// reusing the session WDA reports instead of starting a new one.
+func NewDriverWithOutNewSessionWithOptions(capabilities Capabilities, urlPrefix string, options ...DriverOption) (driver WebDriver, err error) {
+	wd := newRemoteWD()
+	wd.options = newDriverOptions(options)
 	if wd.urlPrefix, err = url.Parse(urlPrefix); err != nil {
 		return nil, err
 	}
@@ -55,65 +244,68 @@ func NewDriverWithOutNewSession(capabilities Capabilities, urlPrefix string, mjp
 		return nil, err
 	}
 
-	wd.sessionId = info.SessionID
+	wd.setSession(info.SessionID, capabilities)
 
-	if wd.mjpegConn, err = net.Dial("tcp", fmt.Sprintf("%s:%d", wd.urlPrefix.Hostname(), mjpegPort[0])); err != nil {
-		return nil, err
+	wd.initMjpegClient()
+	if wd.options.keepAlive != nil {
+		wd.supervisor.start(wd, *wd.options.keepAlive)
 	}
-	wd.mjpegClient = convertToHTTPClient(wd.mjpegConn)
 
 	return wd, nil
 }
 
-// NewUSBDriver creates new client via USB connected device, this will also start a new session.
-func NewUSBDriver(capabilities Capabilities, device ...Device) (driver WebDriver, err error) {
-	if len(device) == 0 {
-		if device, err = DeviceList(); err != nil {
-			return nil, err
-		}
-		if len(device) == 0 {
-			return nil, errors.New("no device")
-		}
+// mjpegPortOptions returns the option of the MJPEG port given to NewDriver, if any.
+func mjpegPortOptions(mjpegPort []int) []DriverOption {
+	if len(mjpegPort) == 0 {
+		return nil
 	}
-	dev := device[0]
+	return []DriverOption{WithMjpegPort(mjpegPort[0])}
+}
 
-	wd := &remoteWD{
-		usbCli: &struct {
-			httpCli                *http.Client
-			defaultConn, mjpegConn giDevice.InnerConn
-			sync.Mutex
-		}{},
+// NewUSBDriver creates new client via USB connected device, this will also start a new session.
+// The first attached device is used unless a Device or WithSerialNumber is given.
+func NewUSBDriver(capabilities Capabilities, options ...DriverOption) (driver WebDriver, err error) {
+	wd := newRemoteWD()
+	wd.options = newDriverOptions(options)
+	if err = wd.openUSB(capabilities); err != nil {
+		// the caller gets no driver to close
+		_ = wd.Close()
+		return nil, err
 	}
-	if wd.usbCli.defaultConn, err = dev.d.NewConnect(dev.Port, 0); err != nil {
-		return nil, fmt.Errorf("create connection: %w", err)
+	return wd, nil
+}
+
+// openUSB connects the driver to the device of its options, starts a new session and the health checks.
+func (wd *remoteWD) openUSB(capabilities Capabilities) (err error) {
+	var dev Device
+	if dev, err = wd.options.usbDevice(); err != nil {
+		return err
 	}
-	wd.usbCli.httpCli = convertToHTTPClient(wd.usbCli.defaultConn.RawConn())
 
-	if wd.usbCli.mjpegConn, err = dev.d.NewConnect(dev.MjpegPort, 0); err != nil {
-		return nil, fmt.Errorf("create connection MJPEG: %w", err)
+	wd.usbCli = &usbClient{serial: dev.serialNumber}
+	if err = wd.usbCli.open(dev); err != nil {
+		return err
 	}
-	wd.mjpegClient = convertToHTTPClient(wd.usbCli.mjpegConn.RawConn())
+	wd.usbCli.httpCli = newHTTPClient(wd.options.usbConnectionsOrDefault(), wd.usbCli.dialer(dev.Port))
+	if wd.options.httpClient != nil {
+		wd.usbCli.httpCli.Timeout = wd.options.httpClient.Timeout
+	}
+	wd.mjpegClient = newHTTPClient(0, wd.usbCli.dialer(dev.MjpegPort))
 
 	if wd.urlPrefix, err = url.Parse("http://" + dev.serialNumber); err != nil {
-		return nil, err
+		return err
+	}
+	wd.mjpegURL = "http://" + net.JoinHostPort(dev.serialNumber, strconv.Itoa(dev.MjpegPort))
+	if _, err = wd.NewSession(capabilities); err != nil {
+		return err
 	}
-	_, err = wd.NewSession(capabilities)
-
-	go func() {
-		if DefaultKeepAliveInterval <= 0 {
-			return
-		}
-		ticker := time.NewTicker(DefaultKeepAliveInterval)
-		for {
-			<-ticker.C
-			if healthy, err := wd.IsWdaHealthy(); err != nil || !healthy {
-				ticker.Stop()
-				return
-			}
-		}
-	}()
 
-	return wd, err
+	interval := DefaultKeepAliveInterval
+	if wd.options.keepAlive != nil {
+		interval = *wd.options.keepAlive
+	}
+	wd.supervisor.start(wd, interval)
+	return nil
 }
 
 var _ WebDriver = (*remoteWD)(nil)
@@ -128,76 +320,440 @@ func (wd *remoteWD) _requestURL(tmpURL *url.URL, elem ...string) string {
 	return tmp.String()
 }
 
-func (wd *remoteWD) executeGet(pathElem ...string) (rawResp rawResponse, err error) {
-	var httpCli *http.Client
-	if wd.usbCli != nil {
-		wd.usbCli.Lock()
-		defer wd.usbCli.Unlock()
-		httpCli = wd.usbCli.httpCli
-	}
-	return executeHTTP(http.MethodGet, wd._requestURL(nil, pathElem...), nil, httpCli)
+// executeGet sends a GET request for command, the name of the method issuing it, see Command.
+func (wd *remoteWD) executeGet(command string, pathElem ...string) (rawResp rawResponse, err error) {
+	return wd.execute(command, http.MethodGet, wd._requestURL(nil, pathElem...), nil)
 }
 
-func (wd *remoteWD) executePost(data interface{}, pathElem ...string) (rawResp rawResponse, err error) {
+func (wd *remoteWD) executePost(command string, data interface{}, pathElem ...string) (rawResp rawResponse, err error) {
 	var bsJSON []byte = nil
 	if data != nil {
 		if bsJSON, err = json.Marshal(data); err != nil {
 			return nil, err
 		}
 	}
-	var httpCli *http.Client
+	return wd.execute(command, http.MethodPost, wd._requestURL(nil, pathElem...), bsJSON)
+}
+
+func (wd *remoteWD) executeDelete(command string, pathElem ...string) (rawResp rawResponse, err error) {
+	return wd.execute(command, http.MethodDelete, wd._requestURL(nil, pathElem...), nil)
+}
+
+func (wd *remoteWD) execute(command string, method string, rawURL string, rawBody []byte) (rawResp rawResponse, err error) {
+	// requests which may change the screen outdate the snapshot of the local queries
+	if !isIdempotentRequest(method, rawURL) {
+		wd.InvalidateSnapshot()
+		defer wd.InvalidateSnapshot()
+	}
+
+	sessionId := wd.sessionID()
+	if rawResp, err = wd.do(command, method, rawURL, rawBody); err == nil || !wd.options.sessionRecovery {
+		return rawResp, err
+	}
+	// deleting an invalid session must not start a new one
+	if method == http.MethodDelete || !errors.Is(err, ErrInvalidSessionID) {
+		return nil, err
+	}
+	if errRecover := wd.recoverSession(sessionId); errRecover != nil {
+		return nil, fmt.Errorf("%w (recover session: %v)", err, errRecover)
+	}
+	if !isIdempotentRequest(method, rawURL) {
+		return nil, err
+	}
+	return wd.do(command, method, replaceSessionId(rawURL, sessionId, wd.sessionID()), rawBody)
+}
+
+func (wd *remoteWD) do(command string, method string, rawURL string, rawBody []byte) (rawResp rawResponse, err error) {
+	if len(wd.options.middleware) != 0 || wd.options.metrics != nil || wd.options.tracer != nil {
+		return wd.runMiddleware(command, method, rawURL, rawBody, func(cmd *Command) ([]byte, error) {
+			return wd.send(cmd.Context, cmd.Method, cmd.URL, cmd.Body, cmd.Header)
+		})
+	}
+	return wd.send(wd.context(), method, rawURL, rawBody, nil)
+}
+
+func (wd *remoteWD) send(ctx context.Context, method string, rawURL string, rawBody []byte, header http.Header) (rawResp rawResponse, err error) {
+	httpCli := wd.options.httpClient
 	if wd.usbCli != nil {
-		wd.usbCli.Lock()
-		defer wd.usbCli.Unlock()
 		httpCli = wd.usbCli.httpCli
 	}
-	return executeHTTP(http.MethodPost, wd._requestURL(nil, pathElem...), bsJSON, httpCli)
+	if wd.options.cassette != nil {
+		httpCli = wd.options.cassette.client(httpCli)
+	}
+	return executeHTTP(ctx, httpCli, wd.requestLogging(), method, rawURL, rawBody, header)
 }
 
-func (wd *remoteWD) executeDelete(pathElem ...string) (rawResp rawResponse, err error) {
-	var httpCli *http.Client
+func (wd *remoteWD) requestLogging() *requestLogging {
+	logging := &requestLogging{
+		logger:        wd.options.logger,
+		requestLogger: wd.options.requestLogger,
+		bodyLimit:     wd.options.logBodyLimit,
+		redactKeys:    wd.options.redactKeys,
+	}
 	if wd.usbCli != nil {
-		wd.usbCli.Lock()
-		defer wd.usbCli.Unlock()
-		httpCli = wd.usbCli.httpCli
+		logging.serial = wd.usbCli.serial
+	}
+	return logging
+}
+
+// recoverSession starts a new session unless a concurrent request already replaced staleSessionId.
+func (wd *remoteWD) recoverSession(staleSessionId string) (err error) {
+	wd.recoverMu.Lock()
+	defer wd.recoverMu.Unlock()
+
+	if wd.sessionID() != staleSessionId {
+		return nil
+	}
+	var sessionInfo SessionInfo
+	if sessionInfo, err = wd.NewSession(wd.sessionCapabilities()); err != nil {
+		return err
 	}
-	return executeHTTP(http.MethodDelete, wd._requestURL(nil, pathElem...), nil, httpCli)
+	if wd.options.metrics != nil {
+		wd.options.metrics.ObserveReconnect(wd.deviceName())
+	}
+	if wd.options.onRecovered != nil {
+		wd.options.onRecovered(staleSessionId, sessionInfo)
+	}
+	return nil
+}
+
+// isIdempotentRequest reports whether the request can be sent again after a session recovery.
+func isIdempotentRequest(method string, rawURL string) bool {
+	if method == http.MethodGet {
+		return true
+	}
+	if method != http.MethodPost {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	elem := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := range elem {
+		if elem[i] != "session" || i+2 >= len(elem) {
+			continue
+		}
+		switch strings.Join(elem[i+2:], "/") {
+		case "element", "elements", "wda/apps/state":
+			return true
+		}
+	}
+	return false
+}
+
+func replaceSessionId(rawURL string, oldSessionId, newSessionId string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || oldSessionId == "" {
+		return rawURL
+	}
+	elem := strings.Split(u.Path, "/")
+	for i := 1; i < len(elem); i++ {
+		if elem[i-1] == "session" && elem[i] == oldSessionId {
+			elem[i] = newSessionId
+		}
+	}
+	u.Path = strings.Join(elem, "/")
+	return u.String()
 }
 
 func (wd *remoteWD) GetMjpegHTTPClient() *http.Client {
 	return wd.mjpegClient
 }
 
-func (wd *remoteWD) Close() error {
-	if wd.usbCli == nil {
-		wd.mjpegClient.CloseIdleConnections()
-		return wd.mjpegConn.Close()
+func (wd *remoteWD) MjpegStream(options ...MjpegStreamOption) (stream *MjpegStream, err error) {
+	options = append([]MjpegStreamOption{withMjpegLogger(wd.options.logger)}, options...)
+	return NewMjpegStream(wd.context(), wd.mjpegClient, wd.mjpegURL, options...)
+}
+
+func (wd *remoteWD) StartRecording(path string, recOpt ...RecordingOption) (err error) {
+	opt := NewRecordingOption()
+	if len(recOpt) != 0 {
+		opt = recOpt[0]
 	}
 
-	wd.usbCli.Lock()
-	defer wd.usbCli.Unlock()
+	wd.recordingMu.Lock()
+	defer wd.recordingMu.Unlock()
+	if wd.recorder != nil {
+		select {
+		case <-wd.recorder.done:
+		default:
+			return errors.New("recording already in progress")
+		}
+	}
 
-	if wd.usbCli.defaultConn != nil {
-		wd.usbCli.defaultConn.Close()
+	var rec *recorder
+	if rec, err = newRecorder(path, opt); err != nil {
+		return err
 	}
-	if wd.usbCli.mjpegConn != nil {
-		wd.usbCli.mjpegConn.Close()
+	if err = rec.start(wd, opt.maxDuration); err != nil {
+		return err
+	}
+	wd.recorder = rec
+	return nil
+}
+
+func (wd *remoteWD) StopRecording() (err error) {
+	wd.recordingMu.Lock()
+	defer wd.recordingMu.Unlock()
+	if wd.recorder == nil {
+		return errors.New("no recording in progress")
+	}
+
+	rec := wd.recorder
+	wd.recorder = nil
+	rec.finish()
+	return rec.err
+}
+
+func (wd *remoteWD) Close() error {
+	// an unfinished recording is completed rather than left without index
+	wd.recordingMu.Lock()
+	if wd.recorder != nil {
+		wd.recorder.finish()
+		wd.recorder = nil
+	}
+	wd.recordingMu.Unlock()
+
+	wd.supervisor.stop()
+	if wd.mjpegClient != nil {
+		wd.mjpegClient.CloseIdleConnections()
+	}
+	if wd.usbCli != nil {
+		wd.usbCli.close()
 	}
 	return nil
 }
 
 type remoteWD struct {
+	*remoteState
+
+	// ctx is the context of the requests issued through this driver,
+	// it is only ever set by WithContext.
+	ctx context.Context
+
+	// report is where the conditions of this package describe themselves
+	// while Wait evaluates them, see conditionReport.
+	report *conditionReport
+}
+
+// remoteState is shared by a driver and all of its WithContext copies.
+type remoteState struct {
 	urlPrefix *url.URL
+	options   *driverOptions
+
+	// sessionMu guards sessionId and capabilities, which NewSession replaces while other requests run
+	sessionMu sync.RWMutex
 	sessionId string
+	// capabilities of the last NewSession call, reused by the session recovery
+	capabilities Capabilities
+	recoverMu    sync.Mutex
 
-	usbCli *struct {
-		httpCli                *http.Client
-		defaultConn, mjpegConn giDevice.InnerConn
-		sync.Mutex
-	}
+	usbCli *usbClient
 
 	mjpegClient *http.Client
-	mjpegConn   net.Conn
+	mjpegURL    string
+
+	recordingMu sync.Mutex
+	recorder    *recorder
+
+	snapshot snapshotCache
+
+	supervisor *supervisor
+}
+
+func newRemoteWD() *remoteWD {
+	return &remoteWD{remoteState: &remoteState{options: new(driverOptions), supervisor: newSupervisor()}}
+}
+
+// sessionID returns the id of the current session, read by every request.
+func (wd *remoteWD) sessionID() string {
+	wd.sessionMu.RLock()
+	defer wd.sessionMu.RUnlock()
+	return wd.sessionId
+}
+
+// sessionCapabilities returns the capabilities the current session was created with.
+func (wd *remoteWD) sessionCapabilities() Capabilities {
+	wd.sessionMu.RLock()
+	defer wd.sessionMu.RUnlock()
+	return wd.capabilities
+}
+
+func (wd *remoteWD) setSession(sessionId string, capabilities Capabilities) {
+	wd.sessionMu.Lock()
+	defer wd.sessionMu.Unlock()
+	wd.sessionId, wd.capabilities = sessionId, capabilities
+}
+
+func (wd *remoteWD) setSessionID(sessionId string) {
+	wd.sessionMu.Lock()
+	defer wd.sessionMu.Unlock()
+	wd.sessionId = sessionId
+}
+
+func (wd *remoteWD) context() context.Context {
+	if wd.ctx != nil {
+		return wd.ctx
+	}
+	return context.Background()
+}
+
+func (wd *remoteWD) withContext(ctx context.Context) *remoteWD {
+	if ctx == nil {
+		panic("nil context")
+	}
+	return &remoteWD{remoteState: wd.remoteState, ctx: ctx}
+}
+
+func (wd *remoteWD) WithContext(ctx context.Context) WebDriver {
+	return wd.withContext(ctx)
+}
+
+func (wd *remoteWD) Context() context.Context {
+	return wd.context()
+}
+
+// usbClient holds the usbmux connections of a driver connected via USB,
+// httpCli pools the connections to WDA, so requests run concurrently
+// up to the limit set by WithUSBConnections.
+type usbClient struct {
+	serial  string
+	httpCli *http.Client
+
+	mu                     sync.Mutex
+	device                 Device
+	defaultConn, mjpegConn giDevice.InnerConn
+	// unused holds the connections by port until the transports take them
+	unused    map[int]net.Conn
+	closeOnce sync.Once
+
+	// newDevice looks up the device to reconnect to, NewDevice if nil
+	newDevice func(options ...DeviceOption) (*Device, error)
+}
+
+// open connects to WDA and its MJPEG server on dev, replacing the connections to the previous device.
+func (c *usbClient) open(dev Device) error {
+	defaultConn, err := dev.d.NewConnect(dev.Port, 0)
+	if err != nil {
+		return fmt.Errorf("create connection: %w", err)
+	}
+	mjpegConn, err := dev.d.NewConnect(dev.MjpegPort, 0)
+	if err != nil {
+		defaultConn.Close()
+		return fmt.Errorf("create connection MJPEG: %w", err)
+	}
+
+	c.mu.Lock()
+	oldDefault, oldMjpeg := c.defaultConn, c.mjpegConn
+	c.device, c.defaultConn, c.mjpegConn = dev, defaultConn, mjpegConn
+	c.unused = map[int]net.Conn{dev.Port: defaultConn.RawConn(), dev.MjpegPort: mjpegConn.RawConn()}
+	c.mu.Unlock()
+
+	if oldDefault != nil {
+		oldDefault.Close()
+	}
+	if oldMjpeg != nil {
+		oldMjpeg.Close()
+	}
+	return nil
+}
+
+// reconnect looks up the device by its serial number and opens new connections to it.
+func (c *usbClient) reconnect() error {
+	c.mu.Lock()
+	dev := c.device
+	c.mu.Unlock()
+
+	newDevice := c.newDevice
+	if newDevice == nil {
+		newDevice = NewDevice
+	}
+	found, err := newDevice(WithSerialNumber(c.serial), WithPort(dev.Port), WithMjpegPort(dev.MjpegPort))
+	if err != nil {
+		return err
+	}
+	if err = c.open(*found); err != nil {
+		return err
+	}
+	c.httpCli.CloseIdleConnections()
+	return nil
+}
+
+// dialer returns the dial func of the transport to port,
+// which hands out the connection opened by open first.
+func (c *usbClient) dialer(port int) func(ctx context.Context) (net.Conn, error) {
+	return func(ctx context.Context) (net.Conn, error) {
+		c.mu.Lock()
+		conn := c.unused[port]
+		delete(c.unused, port)
+		c.mu.Unlock()
+		if conn != nil {
+			return conn, nil
+		}
+		return c.connect(ctx, port)
+	}
+}
+
+// connect opens a new usbmux connection to port of the device.
+func (c *usbClient) connect(ctx context.Context, port int) (net.Conn, error) {
+	var timeout time.Duration
+	if deadline, ok := ctx.Deadline(); ok {
+		if timeout = time.Until(deadline); timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+	c.mu.Lock()
+	dev := c.device
+	c.mu.Unlock()
+	conn, err := dev.d.NewConnect(port, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("create connection: %w", err)
+	}
+	// the usbmux handshake leaves its deadline on the raw connection
+	rawConn := conn.RawConn()
+	if err = rawConn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return rawConn, nil
+}
+
+func (c *usbClient) close() {
+	c.closeOnce.Do(func() {
+		c.httpCli.CloseIdleConnections()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.defaultConn != nil {
+			c.defaultConn.Close()
+		}
+		if c.mjpegConn != nil {
+			c.mjpegConn.Close()
+		}
+	})
+}
+
+// initMjpegClient sets up the client of the MJPEG server of a driver reached via TCP,
+// the server is only connected to once the screen broadcast is requested.
+// WDA behind a path prefix, e.g. of a ProxyServer, serves the stream at "<prefix>/mjpeg".
+func (wd *remoteWD) initMjpegClient() {
+	addr := net.JoinHostPort(wd.urlPrefix.Hostname(), strconv.Itoa(wd.options.mjpegPort()))
+	wd.mjpegURL = "http://" + addr
+	if prefix := strings.TrimSuffix(wd.urlPrefix.Path, "/"); prefix != "" {
+		port := wd.urlPrefix.Port()
+		if port == "" {
+			port = "80"
+			if wd.urlPrefix.Scheme == "https" {
+				port = "443"
+			}
+		}
+		addr = net.JoinHostPort(wd.urlPrefix.Hostname(), port)
+		wd.mjpegURL = wd._requestURL(nil, "/mjpeg")
+	}
+	wd.mjpegClient = newHTTPClient(0, func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", addr)
+	})
 }
 
 func (wd *remoteWD) NewSession(capabilities Capabilities) (sessionInfo SessionInfo, err error) {
@@ -210,20 +766,20 @@ func (wd *remoteWD) NewSession(capabilities Capabilities) (sessionInfo SessionIn
 	}
 
 	var rawResp rawResponse
-	if rawResp, err = wd.executePost(data, "/session"); err != nil {
+	if rawResp, err = wd.executePost("NewSession", data, "/session"); err != nil {
 		return SessionInfo{}, err
 	}
 	if sessionInfo, err = rawResp.valueConvertToSessionInfo(); err != nil {
 		return SessionInfo{}, err
 	}
-	wd.sessionId = sessionInfo.SessionId
+	wd.setSession(sessionInfo.SessionId, capabilities)
 	return
 }
 
 func (wd *remoteWD) ActiveSession() (sessionInfo SessionInfo, err error) {
 	// [[FBRoute GET:@""] respondWithTarget:self action:@selector(handleGetActiveSession:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId); err != nil {
+	if rawResp, err = wd.executeGet("ActiveSession", "/session", wd.sessionID()); err != nil {
 		return SessionInfo{}, err
 	}
 	if sessionInfo, err = rawResp.valueConvertToSessionInfo(); err != nil {
@@ -234,14 +790,14 @@ func (wd *remoteWD) ActiveSession() (sessionInfo SessionInfo, err error) {
 
 func (wd *remoteWD) DeleteSession() (err error) {
 	// [[FBRoute DELETE:@""] respondWithTarget:self action:@selector(handleDeleteSession:)]
-	_, err = wd.executeDelete("/session", wd.sessionId)
+	_, err = wd.executeDelete("DeleteSession", "/session", wd.sessionID())
 	return
 }
 
 func (wd *remoteWD) Status() (deviceStatus DeviceStatus, err error) {
 	// [[FBRoute GET:@"/status"].withoutSession respondWithTarget:self action:@selector(handleGetStatus:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/status"); err != nil {
+	if rawResp, err = wd.executeGet("Status", "/status"); err != nil {
 		return DeviceStatus{}, err
 	}
 	var reply = new(struct{ Value struct{ DeviceStatus } })
@@ -256,7 +812,7 @@ func (wd *remoteWD) DeviceInfo() (deviceInfo DeviceInfo, err error) {
 	// [[FBRoute GET:@"/wda/device/info"] respondWithTarget:self action:@selector(handleGetDeviceInfo:)]
 	// [[FBRoute GET:@"/wda/device/info"].withoutSession
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/wda/device/info"); err != nil {
+	if rawResp, err = wd.executeGet("DeviceInfo", "/session", wd.sessionID(), "/wda/device/info"); err != nil {
 		return DeviceInfo{}, err
 	}
 	var reply = new(struct{ Value struct{ DeviceInfo } })
@@ -271,7 +827,7 @@ func (wd *remoteWD) Location() (location Location, err error) {
 	// [[FBRoute GET:@"/wda/device/location"] respondWithTarget:self action:@selector(handleGetLocation:)]
 	// [[FBRoute GET:@"/wda/device/location"].withoutSession
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/wda/device/location"); err != nil {
+	if rawResp, err = wd.executeGet("Location", "/session", wd.sessionID(), "/wda/device/location"); err != nil {
 		return Location{}, err
 	}
 	var reply = new(struct{ Value struct{ Location } })
@@ -285,7 +841,7 @@ func (wd *remoteWD) Location() (location Location, err error) {
 func (wd *remoteWD) BatteryInfo() (batteryInfo BatteryInfo, err error) {
 	// [[FBRoute GET:@"/wda/batteryInfo"] respondWithTarget:self action:@selector(handleGetBatteryInfo:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/wda/batteryInfo"); err != nil {
+	if rawResp, err = wd.executeGet("BatteryInfo", "/session", wd.sessionID(), "/wda/batteryInfo"); err != nil {
 		return BatteryInfo{}, err
 	}
 	var reply = new(struct{ Value struct{ BatteryInfo } })
@@ -299,7 +855,7 @@ func (wd *remoteWD) BatteryInfo() (batteryInfo BatteryInfo, err error) {
 func (wd *remoteWD) WindowSize() (size Size, err error) {
 	// [[FBRoute GET:@"/window/size"] respondWithTarget:self action:@selector(handleGetWindowSize:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/window/size"); err != nil {
+	if rawResp, err = wd.executeGet("WindowSize", "/session", wd.sessionID(), "/window/size"); err != nil {
 		return Size{}, err
 	}
 	var reply = new(struct{ Value struct{ Size } })
@@ -311,9 +867,13 @@ func (wd *remoteWD) WindowSize() (size Size, err error) {
 }
 
 func (wd *remoteWD) Screen() (screen Screen, err error) {
+	return wd.screen("Screen")
+}
+
+func (wd *remoteWD) screen(command string) (screen Screen, err error) {
 	// [[FBRoute GET:@"/wda/screen"] respondWithTarget:self action:@selector(handleGetScreen:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/wda/screen"); err != nil {
+	if rawResp, err = wd.executeGet(command, "/session", wd.sessionID(), "/wda/screen"); err != nil {
 		return Screen{}, err
 	}
 	var reply = new(struct{ Value struct{ Screen } })
@@ -325,7 +885,7 @@ func (wd *remoteWD) Screen() (screen Screen, err error) {
 }
 
 func (wd *remoteWD) Scale() (float64, error) {
-	screen, err := wd.Screen()
+	screen, err := wd.screen("Scale")
 	if err != nil {
 		return 0, err
 	}
@@ -336,7 +896,7 @@ func (wd *remoteWD) ActiveAppInfo() (info AppInfo, err error) {
 	// [[FBRoute GET:@"/wda/activeAppInfo"] respondWithTarget:self action:@selector(handleActiveAppInfo:)]
 	// [[FBRoute GET:@"/wda/activeAppInfo"].withoutSession
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/wda/activeAppInfo"); err != nil {
+	if rawResp, err = wd.executeGet("ActiveAppInfo", "/session", wd.sessionID(), "/wda/activeAppInfo"); err != nil {
 		return AppInfo{}, err
 	}
 	var reply = new(struct{ Value struct{ AppInfo } })
@@ -350,7 +910,7 @@ func (wd *remoteWD) ActiveAppInfo() (info AppInfo, err error) {
 func (wd *remoteWD) ActiveAppsList() (appsList []AppBaseInfo, err error) {
 	// [[FBRoute GET:@"/wda/apps/list"] respondWithTarget:self action:@selector(handleGetActiveAppsList:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/wda/apps/list"); err != nil {
+	if rawResp, err = wd.executeGet("ActiveAppsList", "/session", wd.sessionID(), "/wda/apps/list"); err != nil {
 		return nil, err
 	}
 	var reply = new(struct{ Value []AppBaseInfo })
@@ -365,7 +925,7 @@ func (wd *remoteWD) AppState(bundleId string) (runState AppState, err error) {
 	// [[FBRoute POST:@"/wda/apps/state"] respondWithTarget:self action:@selector(handleSessionAppState:)]
 	data := map[string]interface{}{"bundleId": bundleId}
 	var rawResp rawResponse
-	if rawResp, err = wd.executePost(data, "/session", wd.sessionId, "/wda/apps/state"); err != nil {
+	if rawResp, err = wd.executePost("AppState", data, "/session", wd.sessionID(), "/wda/apps/state"); err != nil {
 		return 0, err
 	}
 	var reply = new(struct{ Value AppState })
@@ -381,7 +941,7 @@ func (wd *remoteWD) IsLocked() (locked bool, err error) {
 	// [[FBRoute GET:@"/wda/locked"] respondWithTarget:self action:@selector(handleIsLocked:)]
 	// [[FBRoute GET:@"/wda/locked"].withoutSession
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/wda/locked"); err != nil {
+	if rawResp, err = wd.executeGet("IsLocked", "/session", wd.sessionID(), "/wda/locked"); err != nil {
 		return false, err
 	}
 	if locked, err = rawResp.valueConvertToBool(); err != nil {
@@ -393,20 +953,20 @@ func (wd *remoteWD) IsLocked() (locked bool, err error) {
 func (wd *remoteWD) Unlock() (err error) {
 	// [[FBRoute POST:@"/wda/unlock"] respondWithTarget:self action:@selector(handleUnlock:)]
 	// [[FBRoute POST:@"/wda/unlock"].withoutSession
-	_, err = wd.executePost(nil, "/session", wd.sessionId, "/wda/unlock")
+	_, err = wd.executePost("Unlock", nil, "/session", wd.sessionID(), "/wda/unlock")
 	return
 }
 
 func (wd *remoteWD) Lock() (err error) {
 	// [[FBRoute POST:@"/wda/lock"] respondWithTarget:self action:@selector(handleLock:)]
 	// [[FBRoute POST:@"/wda/lock"].withoutSession
-	_, err = wd.executePost(nil, "/session", wd.sessionId, "/wda/lock")
+	_, err = wd.executePost("Lock", nil, "/session", wd.sessionID(), "/wda/lock")
 	return
 }
 
 func (wd *remoteWD) Homescreen() (err error) {
 	// [[FBRoute POST:@"/wda/homescreen"].withoutSession respondWithTarget:self action:@selector(handleHomescreenCommand:)]
-	_, err = wd.executePost(nil, "/wda/homescreen")
+	_, err = wd.executePost("Homescreen", nil, "/wda/homescreen")
 	return
 }
 
@@ -414,7 +974,7 @@ func (wd *remoteWD) AlertText() (text string, err error) {
 	// [[FBRoute GET:@"/alert/text"] respondWithTarget:self action:@selector(handleAlertGetTextCommand:)]
 	// [[FBRoute GET:@"/alert/text"].withoutSession
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/alert/text"); err != nil {
+	if rawResp, err = wd.executeGet("AlertText", "/session", wd.sessionID(), "/alert/text"); err != nil {
 		return "", err
 	}
 	if text, err = rawResp.valueConvertToString(); err != nil {
@@ -426,7 +986,7 @@ func (wd *remoteWD) AlertText() (text string, err error) {
 func (wd *remoteWD) AlertButtons() (btnLabels []string, err error) {
 	// [[FBRoute GET:@"/wda/alert/buttons"] respondWithTarget:self action:@selector(handleGetAlertButtonsCommand:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/wda/alert/buttons"); err != nil {
+	if rawResp, err = wd.executeGet("AlertButtons", "/session", wd.sessionID(), "/wda/alert/buttons"); err != nil {
 		return nil, err
 	}
 	var reply = new(struct{ Value []string })
@@ -444,7 +1004,7 @@ func (wd *remoteWD) AlertAccept(label ...string) (err error) {
 	if len(label) != 0 && label[0] != "" {
 		data["name"] = label[0]
 	}
-	_, err = wd.executePost(data, "/alert/accept")
+	_, err = wd.executePost("AlertAccept", data, "/alert/accept")
 	return
 }
 
@@ -455,14 +1015,14 @@ func (wd *remoteWD) AlertDismiss(label ...string) (err error) {
 	if len(label) != 0 && label[0] != "" {
 		data["name"] = label[0]
 	}
-	_, err = wd.executePost(data, "/alert/dismiss")
+	_, err = wd.executePost("AlertDismiss", data, "/alert/dismiss")
 	return
 }
 
 func (wd *remoteWD) AlertSendKeys(text string) (err error) {
 	// [[FBRoute POST:@"/alert/text"] respondWithTarget:self action:@selector(handleAlertSetTextCommand:)]
 	data := map[string]interface{}{"value": strings.Split(text, "")}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/alert/text")
+	_, err = wd.executePost("AlertSendKeys", data, "/session", wd.sessionID(), "/alert/text")
 	return
 }
 
@@ -473,14 +1033,14 @@ func (wd *remoteWD) AppLaunch(bundleId string, launchOpt ...AppLaunchOption) (er
 		data = launchOpt[0]
 	}
 	data["bundleId"] = bundleId
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/apps/launch")
+	_, err = wd.executePost("AppLaunch", data, "/session", wd.sessionID(), "/wda/apps/launch")
 	return
 }
 
 func (wd *remoteWD) AppLaunchUnattached(bundleId string) (err error) {
 	// [[FBRoute POST:@"/wda/apps/launchUnattached"].withoutSession respondWithTarget:self action:@selector(handleLaunchUnattachedApp:)]
 	data := map[string]interface{}{"bundleId": bundleId}
-	_, err = wd.executePost(data, "/wda/apps/launchUnattached")
+	_, err = wd.executePost("AppLaunchUnattached", data, "/wda/apps/launchUnattached")
 	return
 }
 
@@ -488,7 +1048,7 @@ func (wd *remoteWD) AppTerminate(bundleId string) (successful bool, err error) {
 	// [[FBRoute POST:@"/wda/apps/terminate"] respondWithTarget:self action:@selector(handleSessionAppTerminate:)]
 	data := map[string]interface{}{"bundleId": bundleId}
 	var rawResp rawResponse
-	if rawResp, err = wd.executePost(data, "/session", wd.sessionId, "/wda/apps/terminate"); err != nil {
+	if rawResp, err = wd.executePost("AppTerminate", data, "/session", wd.sessionID(), "/wda/apps/terminate"); err != nil {
 		return false, err
 	}
 	if successful, err = rawResp.valueConvertToBool(); err != nil {
@@ -500,7 +1060,7 @@ func (wd *remoteWD) AppTerminate(bundleId string) (successful bool, err error) {
 func (wd *remoteWD) AppActivate(bundleId string) (err error) {
 	// [[FBRoute POST:@"/wda/apps/activate"] respondWithTarget:self action:@selector(handleSessionAppActivate:)]
 	data := map[string]interface{}{"bundleId": bundleId}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/apps/activate")
+	_, err = wd.executePost("AppActivate", data, "/session", wd.sessionID(), "/wda/apps/activate")
 	return
 }
 
@@ -510,50 +1070,63 @@ func (wd *remoteWD) AppDeactivate(second float64) (err error) {
 		second = 3.0
 	}
 	data := map[string]interface{}{"duration": second}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/deactivateApp")
+	_, err = wd.executePost("AppDeactivate", data, "/session", wd.sessionID(), "/wda/deactivateApp")
 	return
 }
 
 func (wd *remoteWD) AppAuthReset(resource ProtectedResource) (err error) {
 	// [[FBRoute POST:@"/wda/resetAppAuth"] respondWithTarget:self action:@selector(handleResetAppAuth:)]
 	data := map[string]interface{}{"resource": resource}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/resetAppAuth")
+	_, err = wd.executePost("AppAuthReset", data, "/session", wd.sessionID(), "/wda/resetAppAuth")
 	return
 }
 
 func (wd *remoteWD) Tap(x, y int) error {
-	return wd.TapFloat(float64(x), float64(y))
+	return wd.tap("Tap", float64(x), float64(y))
 }
 
-func (wd *remoteWD) TapFloat(x, y float64) (err error) {
+func (wd *remoteWD) TapFloat(x, y float64) error {
+	return wd.tap("TapFloat", x, y)
+}
+
+// tap taps the coordinate for command, the method of the driver reported to the middleware.
+func (wd *remoteWD) tap(command string, x, y float64) (err error) {
 	// [[FBRoute POST:@"/wda/tap/:uuid"] respondWithTarget:self action:@selector(handleTap:)]
 	data := map[string]interface{}{
 		"x": x,
 		"y": y,
 	}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/tap/0")
+	_, err = wd.executePost(command, data, "/session", wd.sessionID(), "/wda/tap/0")
 	return
 }
 
 func (wd *remoteWD) DoubleTap(x, y int) error {
-	return wd.DoubleTapFloat(float64(x), float64(y))
+	return wd.doubleTap("DoubleTap", float64(x), float64(y))
+}
+
+func (wd *remoteWD) DoubleTapFloat(x, y float64) error {
+	return wd.doubleTap("DoubleTapFloat", x, y)
 }
 
-func (wd *remoteWD) DoubleTapFloat(x, y float64) (err error) {
+func (wd *remoteWD) doubleTap(command string, x, y float64) (err error) {
 	// [[FBRoute POST:@"/wda/doubleTap"] respondWithTarget:self action:@selector(handleDoubleTapCoordinate:)]
 	data := map[string]interface{}{
 		"x": x,
 		"y": y,
 	}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/doubleTap")
+	_, err = wd.executePost(command, data, "/session", wd.sessionID(), "/wda/doubleTap")
 	return
 }
 
 func (wd *remoteWD) TouchAndHold(x, y int, second ...float64) error {
-	return wd.TouchAndHoldFloat(float64(x), float64(y), second...)
+	return wd.touchAndHold("TouchAndHold", float64(x), float64(y), second...)
 }
 
-func (wd *remoteWD) TouchAndHoldFloat(x, y float64, second ...float64) (err error) {
+func (wd *remoteWD) TouchAndHoldFloat(x, y float64, second ...float64) error {
+	return wd.touchAndHold("TouchAndHoldFloat", x, y, second...)
+}
+
+func (wd *remoteWD) touchAndHold(command string, x, y float64, second ...float64) (err error) {
 	// [[FBRoute POST:@"/wda/touchAndHold"] respondWithTarget:self action:@selector(handleTouchAndHoldCoordinate:)]
 	data := map[string]interface{}{
 		"x": x,
@@ -563,15 +1136,19 @@ func (wd *remoteWD) TouchAndHoldFloat(x, y float64, second ...float64) (err erro
 		second = []float64{1.0}
 	}
 	data["duration"] = second[0]
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/touchAndHold")
+	_, err = wd.executePost(command, data, "/session", wd.sessionID(), "/wda/touchAndHold")
 	return
 }
 
 func (wd *remoteWD) Drag(fromX, fromY, toX, toY int, pressForDuration ...float64) error {
-	return wd.DragFloat(float64(fromX), float64(fromY), float64(toX), float64(toY), pressForDuration...)
+	return wd.drag("Drag", float64(fromX), float64(fromY), float64(toX), float64(toY), pressForDuration...)
 }
 
-func (wd *remoteWD) DragFloat(fromX, fromY, toX, toY float64, pressForDuration ...float64) (err error) {
+func (wd *remoteWD) DragFloat(fromX, fromY, toX, toY float64, pressForDuration ...float64) error {
+	return wd.drag("DragFloat", fromX, fromY, toX, toY, pressForDuration...)
+}
+
+func (wd *remoteWD) drag(command string, fromX, fromY, toX, toY float64, pressForDuration ...float64) (err error) {
 	// [[FBRoute POST:@"/wda/dragfromtoforduration"] respondWithTarget:self action:@selector(handleDragCoordinate:)]
 	data := map[string]interface{}{
 		"fromX": fromX,
@@ -583,23 +1160,27 @@ func (wd *remoteWD) DragFloat(fromX, fromY, toX, toY float64, pressForDuration .
 		pressForDuration = []float64{1.0}
 	}
 	data["duration"] = pressForDuration[0]
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/dragfromtoforduration")
+	_, err = wd.executePost(command, data, "/session", wd.sessionID(), "/wda/dragfromtoforduration")
 	return
 }
 
 func (wd *remoteWD) Swipe(fromX, fromY, toX, toY int) error {
-	return wd.SwipeFloat(float64(fromX), float64(fromY), float64(toX), float64(toY))
+	return wd.drag("Swipe", float64(fromX), float64(fromY), float64(toX), float64(toY), 0)
 }
 
 func (wd *remoteWD) SwipeFloat(fromX, fromY, toX, toY float64) error {
-	return wd.DragFloat(fromX, fromY, toX, toY, 0)
+	return wd.drag("SwipeFloat", fromX, fromY, toX, toY, 0)
 }
 
 func (wd *remoteWD) ForceTouch(x, y int, pressure float64, second ...float64) error {
-	return wd.ForceTouchFloat(float64(x), float64(y), pressure, second...)
+	return wd.forceTouch("ForceTouch", float64(x), float64(y), pressure, second...)
 }
 
 func (wd *remoteWD) ForceTouchFloat(x, y, pressure float64, second ...float64) error {
+	return wd.forceTouch("ForceTouchFloat", x, y, pressure, second...)
+}
+
+func (wd *remoteWD) forceTouch(command string, x, y, pressure float64, second ...float64) error {
 	if len(second) == 0 || second[0] <= 0 {
 		second = []float64{1.0}
 	}
@@ -608,21 +1189,29 @@ func (wd *remoteWD) ForceTouchFloat(x, y, pressure float64, second ...float64) e
 			NewTouchActionPress().WithXYFloat(x, y).WithPressure(pressure)).
 		Wait(second[0]).
 		Release()
-	return wd.PerformAppiumTouchActions(actions)
+	return wd.performAppiumTouchActions(command, actions)
+}
+
+func (wd *remoteWD) PerformW3CActions(actions *W3CActions) error {
+	return wd.performW3CActions("PerformW3CActions", actions)
 }
 
-func (wd *remoteWD) PerformW3CActions(actions *W3CActions) (err error) {
+func (wd *remoteWD) performW3CActions(command string, actions *W3CActions) (err error) {
 	// [[FBRoute POST:@"/actions"] respondWithTarget:self action:@selector(handlePerformW3CTouchActions:)]
 	data := map[string]interface{}{"actions": actions}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/actions")
+	_, err = wd.executePost(command, data, "/session", wd.sessionID(), "/actions")
 	return
 }
 
-func (wd *remoteWD) PerformAppiumTouchActions(touchActs *TouchActions) (err error) {
+func (wd *remoteWD) PerformAppiumTouchActions(touchActs *TouchActions) error {
+	return wd.performAppiumTouchActions("PerformAppiumTouchActions", touchActs)
+}
+
+func (wd *remoteWD) performAppiumTouchActions(command string, touchActs *TouchActions) (err error) {
 	// [[FBRoute POST:@"/wda/touch/perform"] respondWithTarget:self action:@selector(handlePerformAppiumTouchActions:)]
 	// [[FBRoute POST:@"/wda/touch/multi/perform"]
 	data := map[string]interface{}{"actions": touchActs}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/touch/multi/perform")
+	_, err = wd.executePost(command, data, "/session", wd.sessionID(), "/wda/touch/multi/perform")
 	return
 }
 
@@ -632,7 +1221,7 @@ func (wd *remoteWD) SetPasteboard(contentType PasteboardType, content string) (e
 		"contentType": contentType,
 		"content":     base64.StdEncoding.EncodeToString([]byte(content)),
 	}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/setPasteboard")
+	_, err = wd.executePost("SetPasteboard", data, "/session", wd.sessionID(), "/wda/setPasteboard")
 	return
 }
 
@@ -640,7 +1229,7 @@ func (wd *remoteWD) GetPasteboard(contentType PasteboardType) (raw *bytes.Buffer
 	// [[FBRoute POST:@"/wda/getPasteboard"] respondWithTarget:self action:@selector(handleGetPasteboard:)]
 	data := map[string]interface{}{"contentType": contentType}
 	var rawResp rawResponse
-	if rawResp, err = wd.executePost(data, "/session", wd.sessionId, "/wda/getPasteboard"); err != nil {
+	if rawResp, err = wd.executePost("GetPasteboard", data, "/session", wd.sessionID(), "/wda/getPasteboard"); err != nil {
 		return nil, err
 	}
 	if raw, err = rawResp.valueDecodeAsBase64(); err != nil {
@@ -656,7 +1245,7 @@ func (wd *remoteWD) SendKeys(text string, frequency ...int) (err error) {
 		frequency = []int{60}
 	}
 	data["frequency"] = frequency[0]
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/keys")
+	_, err = wd.executePost("SendKeys", data, "/session", wd.sessionID(), "/wda/keys")
 	return
 }
 
@@ -666,14 +1255,14 @@ func (wd *remoteWD) KeyboardDismiss(keyNames ...string) (err error) {
 		keyNames = []string{"return"}
 	}
 	data := map[string]interface{}{"keyNames": keyNames}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/keyboard/dismiss")
+	_, err = wd.executePost("KeyboardDismiss", data, "/session", wd.sessionID(), "/wda/keyboard/dismiss")
 	return
 }
 
 func (wd *remoteWD) PressButton(devBtn DeviceButton) (err error) {
 	// [[FBRoute POST:@"/wda/pressButton"] respondWithTarget:self action:@selector(handlePressButtonCommand:)]
 	data := map[string]interface{}{"name": devBtn}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/pressButton")
+	_, err = wd.executePost("PressButton", data, "/session", wd.sessionID(), "/wda/pressButton")
 	return
 }
 
@@ -687,7 +1276,7 @@ func (wd *remoteWD) IOHIDEvent(pageID EventPageID, usageID EventUsageID, duratio
 		"usage":    usageID,
 		"duration": duration[0],
 	}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/performIoHidEvent")
+	_, err = wd.executePost("IOHIDEvent", data, "/session", wd.sessionID(), "/wda/performIoHidEvent")
 	return
 }
 
@@ -701,28 +1290,28 @@ func (wd *remoteWD) ExpectNotification(notifyName string, notifyType Notificatio
 		"type":    notifyType,
 		"timeout": second[0],
 	}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/expectNotification")
+	_, err = wd.executePost("ExpectNotification", data, "/session", wd.sessionID(), "/wda/expectNotification")
 	return
 }
 
 func (wd *remoteWD) SiriActivate(text string) (err error) {
 	// [[FBRoute POST:@"/wda/siri/activate"] respondWithTarget:self action:@selector(handleActivateSiri:)]
 	data := map[string]interface{}{"text": text}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/siri/activate")
+	_, err = wd.executePost("SiriActivate", data, "/session", wd.sessionID(), "/wda/siri/activate")
 	return
 }
 
 func (wd *remoteWD) SiriOpenUrl(url string) (err error) {
 	// [[FBRoute POST:@"/url"] respondWithTarget:self action:@selector(handleOpenURL:)]
 	data := map[string]interface{}{"url": url}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/url")
+	_, err = wd.executePost("SiriOpenUrl", data, "/session", wd.sessionID(), "/url")
 	return
 }
 
 func (wd *remoteWD) Orientation() (orientation Orientation, err error) {
 	// [[FBRoute GET:@"/orientation"] respondWithTarget:self action:@selector(handleGetOrientation:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/orientation"); err != nil {
+	if rawResp, err = wd.executeGet("Orientation", "/session", wd.sessionID(), "/orientation"); err != nil {
 		return "", err
 	}
 	var reply = new(struct{ Value Orientation })
@@ -736,14 +1325,14 @@ func (wd *remoteWD) Orientation() (orientation Orientation, err error) {
 func (wd *remoteWD) SetOrientation(orientation Orientation) (err error) {
 	// [[FBRoute POST:@"/orientation"] respondWithTarget:self action:@selector(handleSetOrientation:)]
 	data := map[string]interface{}{"orientation": orientation}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/orientation")
+	_, err = wd.executePost("SetOrientation", data, "/session", wd.sessionID(), "/orientation")
 	return
 }
 
 func (wd *remoteWD) Rotation() (rotation Rotation, err error) {
 	// [[FBRoute GET:@"/rotation"] respondWithTarget:self action:@selector(handleGetRotation:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/rotation"); err != nil {
+	if rawResp, err = wd.executeGet("Rotation", "/session", wd.sessionID(), "/rotation"); err != nil {
 		return Rotation{}, err
 	}
 	var reply = new(struct{ Value Rotation })
@@ -756,21 +1345,21 @@ func (wd *remoteWD) Rotation() (rotation Rotation, err error) {
 
 func (wd *remoteWD) SetRotation(rotation Rotation) (err error) {
 	// [[FBRoute POST:@"/rotation"] respondWithTarget:self action:@selector(handleSetRotation:)]
-	_, err = wd.executePost(rotation, "/session", wd.sessionId, "/rotation")
+	_, err = wd.executePost("SetRotation", rotation, "/session", wd.sessionID(), "/rotation")
 	return
 }
 
 func (wd *remoteWD) MatchTouchID(isMatch bool) (err error) {
 	// [FBRoute POST:@"/wda/touch_id"]
 	data := map[string]interface{}{"match": isMatch}
-	_, err = wd.executePost(data, "/session", wd.sessionId, "/wda/touch_id")
+	_, err = wd.executePost("MatchTouchID", data, "/session", wd.sessionID(), "/wda/touch_id")
 	return
 }
 
 func (wd *remoteWD) ActiveElement() (element WebElement, err error) {
 	// [[FBRoute GET:@"/element/active"] respondWithTarget:self action:@selector(handleGetActiveElement:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/element/active"); err != nil {
+	if rawResp, err = wd.executeGet("ActiveElement", "/session", wd.sessionID(), "/element/active"); err != nil {
 		return nil, err
 	}
 	var elementID string
@@ -784,17 +1373,27 @@ func (wd *remoteWD) ActiveElement() (element WebElement, err error) {
 func (wd *remoteWD) FindElement(by BySelector) (element WebElement, err error) {
 	// [[FBRoute POST:@"/element"] respondWithTarget:self action:@selector(handleFindElement:)]
 	using, value := by.getUsingAndValue()
+	if wd.queriesLocally(using) {
+		var elements []WebElement
+		if elements, err = wd.findLocal(using, value, true); err != nil {
+			return nil, err
+		}
+		if len(elements) == 0 {
+			return nil, fmt.Errorf("%w: unable to find an element using '%s', value '%s'", ErrNoSuchElement, using, value)
+		}
+		return elements[0], nil
+	}
 	data := map[string]interface{}{
 		"using": using,
 		"value": value,
 	}
 	var rawResp rawResponse
-	if rawResp, err = wd.executePost(data, "/session", wd.sessionId, "/element"); err != nil {
+	if rawResp, err = wd.executePost("FindElement", data, "/session", wd.sessionID(), "/element"); err != nil {
 		return nil, err
 	}
 	var elementID string
 	if elementID, err = rawResp.valueConvertToElementID(); err != nil {
-		if errors.Is(err, errNoSuchElement) {
+		if errors.Is(err, ErrNoSuchElement) {
 			return nil, fmt.Errorf("%w: unable to find an element using '%s', value '%s'", err, using, value)
 		}
 		return nil, err
@@ -806,17 +1405,20 @@ func (wd *remoteWD) FindElement(by BySelector) (element WebElement, err error) {
 func (wd *remoteWD) FindElements(by BySelector) (elements []WebElement, err error) {
 	// [[FBRoute POST:@"/elements"] respondWithTarget:self action:@selector(handleFindElements:)]
 	using, value := by.getUsingAndValue()
+	if wd.queriesLocally(using) {
+		return wd.findLocal(using, value, false)
+	}
 	data := map[string]interface{}{
 		"using": using,
 		"value": value,
 	}
 	var rawResp rawResponse
-	if rawResp, err = wd.executePost(data, "/session", wd.sessionId, "/elements"); err != nil {
+	if rawResp, err = wd.executePost("FindElements", data, "/session", wd.sessionID(), "/elements"); err != nil {
 		return nil, err
 	}
 	var elementIDs []string
 	if elementIDs, err = rawResp.valueConvertToElementIDs(); err != nil {
-		if errors.Is(err, errNoSuchElement) {
+		if errors.Is(err, ErrNoSuchElement) {
 			return nil, fmt.Errorf("%w: unable to find an element using '%s', value '%s'", err, using, value)
 		}
 		return nil, err
@@ -832,20 +1434,132 @@ func (wd *remoteWD) Screenshot() (raw *bytes.Buffer, err error) {
 	// [[FBRoute GET:@"/screenshot"] respondWithTarget:self action:@selector(handleGetScreenshot:)]
 	// [[FBRoute GET:@"/screenshot"].withoutSession respondWithTarget:self action:@selector(handleGetScreenshot:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/screenshot"); err != nil {
+	if rawResp, err = wd.executeGet("Screenshot", "/session", wd.sessionID(), "/screenshot"); err != nil {
 		return nil, err
 	}
 
 	if raw, err = rawResp.valueDecodeAsBase64(); err != nil {
 		return nil, err
 	}
+	wd.observeScreenshot(raw.Len())
 	return
 }
 
+func (wd *remoteWD) FindImage(template image.Image, matchOpt ...ImageMatchOption) (match ImageMatch, err error) {
+	return wd.findImage(template, 0, matchOpt...)
+}
+
+// findImage is FindImage with the scale of the screen, which is looked up if not positive.
+func (wd *remoteWD) findImage(template image.Image, scale float64, matchOpt ...ImageMatchOption) (match ImageMatch, err error) {
+	opt := NewImageMatchOption()
+	if len(matchOpt) != 0 {
+		opt = matchOpt[0]
+	}
+	var matches []ImageMatch
+	if matches, err = wd.findImages(template, scale, opt.WithMaxResults(1)); err != nil {
+		return ImageMatch{}, err
+	}
+	if len(matches) == 0 {
+		return ImageMatch{}, ErrImageNotFound
+	}
+	return matches[0], nil
+}
+
+func (wd *remoteWD) FindImages(template image.Image, matchOpt ...ImageMatchOption) (matches []ImageMatch, err error) {
+	return wd.findImages(template, 0, matchOpt...)
+}
+
+func (wd *remoteWD) findImages(template image.Image, scale float64, matchOpt ...ImageMatchOption) (matches []ImageMatch, err error) {
+	opt := NewImageMatchOption()
+	if len(matchOpt) != 0 {
+		opt = matchOpt[0]
+	}
+
+	var raw *bytes.Buffer
+	if opt.uusense {
+		raw, err = wd.ScreenshotUUSense(0, 0, 0, 0, 0, 100)
+	} else {
+		raw, err = wd.Screenshot()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var screen image.Image
+	if screen, _, err = image.Decode(raw); err != nil {
+		return nil, fmt.Errorf("decode screenshot: %w", err)
+	}
+
+	// screenshots are in pixels, WDA works with points
+	if scale <= 0 {
+		if scale, err = wd.screenScale(); err != nil {
+			return nil, err
+		}
+	}
+
+	if matches, err = MatchTemplate(screen, template, opt); err != nil {
+		return nil, err
+	}
+	toPoints := func(v int) int { return int(math.Round(float64(v) / scale)) }
+	for i := range matches {
+		r := &matches[i].Rect
+		r.X, r.Y, r.Width, r.Height = toPoints(r.X), toPoints(r.Y), toPoints(r.Width), toPoints(r.Height)
+	}
+	return matches, nil
+}
+
+// screenScale returns the scale of the screen to convert the matches to points.
+func (wd *remoteWD) screenScale() (float64, error) {
+	scale, err := wd.Scale()
+	if err != nil {
+		return 0, err
+	}
+	if scale <= 0 {
+		scale = 1
+	}
+	return scale, nil
+}
+
+func (wd *remoteWD) TapImage(template image.Image, matchOpt ...ImageMatchOption) (err error) {
+	var match ImageMatch
+	if match, err = wd.FindImage(template, matchOpt...); err != nil {
+		return err
+	}
+	x, y := match.Center()
+	return wd.tap("TapImage", x, y)
+}
+
+func (wd *remoteWD) WaitForImage(template image.Image, timeout time.Duration, matchOpt ...ImageMatchOption) (match ImageMatch, err error) {
+	// the scale is only requested by the first poll, so the others cost no more than the screenshots
+	var scale float64
+	var lastErr error
+	err = wd.WaitWithTimeout(func(WebDriver) (bool, error) {
+		if scale <= 0 {
+			if scale, lastErr = wd.screenScale(); lastErr != nil {
+				return false, lastErr
+			}
+		}
+		if match, lastErr = wd.findImage(template, scale, matchOpt...); lastErr != nil {
+			if errors.Is(lastErr, ErrImageNotFound) {
+				return false, nil
+			}
+			return false, lastErr
+		}
+		return true, nil
+	}, timeout)
+	if err != nil && errors.Is(lastErr, ErrImageNotFound) {
+		return ImageMatch{}, fmt.Errorf("%v: %w", err, ErrImageNotFound)
+	}
+	return match, err
+}
+
 func (wd *remoteWD) Source(srcOpt ...SourceOption) (source string, err error) {
+	return wd.source("Source", srcOpt...)
+}
+
+func (wd *remoteWD) source(command string, srcOpt ...SourceOption) (source string, err error) {
 	// [[FBRoute GET:@"/source"] respondWithTarget:self action:@selector(handleGetSourceCommand:)]
 	// [[FBRoute GET:@"/source"].withoutSession
-	tmp, _ := url.Parse(wd._requestURL(nil, "/session", wd.sessionId))
+	tmp, _ := url.Parse(wd._requestURL(nil, "/session", wd.sessionID()))
 	toJsonRaw := false
 	if len(srcOpt) != 0 {
 		q := tmp.Query()
@@ -859,16 +1573,9 @@ func (wd *remoteWD) Source(srcOpt ...SourceOption) (source string, err error) {
 		tmp.RawQuery = q.Encode()
 	}
 
-	var httpCli *http.Client
-	if wd.usbCli != nil {
-		wd.usbCli.Lock()
-		defer wd.usbCli.Unlock()
-		httpCli = wd.usbCli.httpCli
-	}
-
 	var rawResp rawResponse
-	if rawResp, err = executeHTTP(http.MethodGet, wd._requestURL(tmp, "/source"), nil, httpCli); err != nil {
-		return "", nil
+	if rawResp, err = wd.execute(command, http.MethodGet, wd._requestURL(tmp, "/source"), nil); err != nil {
+		return "", err
 	}
 	if toJsonRaw {
 		var jr json.RawMessage
@@ -883,11 +1590,19 @@ func (wd *remoteWD) Source(srcOpt ...SourceOption) (source string, err error) {
 	return
 }
 
+func (wd *remoteWD) Hierarchy(srcOpt ...SourceOption) (hierarchy *Hierarchy, err error) {
+	var source string
+	if source, err = wd.source("Hierarchy", srcOpt...); err != nil {
+		return nil, err
+	}
+	return ParseHierarchy(source)
+}
+
 func (wd *remoteWD) AccessibleSource() (source string, err error) {
 	// [[FBRoute GET:@"/wda/accessibleSource"] respondWithTarget:self action:@selector(handleGetAccessibleSourceCommand:)]
 	// [[FBRoute GET:@"/wda/accessibleSource"].withoutSession
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/wda/accessibleSource"); err != nil {
+	if rawResp, err = wd.executeGet("AccessibleSource", "/session", wd.sessionID(), "/wda/accessibleSource"); err != nil {
 		return "", err
 	}
 	var jr json.RawMessage
@@ -900,14 +1615,14 @@ func (wd *remoteWD) AccessibleSource() (source string, err error) {
 
 func (wd *remoteWD) HealthCheck() (err error) {
 	// [[FBRoute GET:@"/wda/healthcheck"].withoutSession respondWithTarget:self action:@selector(handleGetHealthCheck:)]
-	_, err = wd.executeGet("/wda/healthcheck")
+	_, err = wd.executeGet("HealthCheck", "/wda/healthcheck")
 	return
 }
 
 func (wd *remoteWD) GetAppiumSettings() (settings map[string]interface{}, err error) {
 	// [[FBRoute GET:@"/appium/settings"] respondWithTarget:self action:@selector(handleGetSettings:)]
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/session", wd.sessionId, "/appium/settings"); err != nil {
+	if rawResp, err = wd.executeGet("GetAppiumSettings", "/session", wd.sessionID(), "/appium/settings"); err != nil {
 		return nil, err
 	}
 	var reply = new(struct{ Value map[string]interface{} })
@@ -922,7 +1637,7 @@ func (wd *remoteWD) SetAppiumSettings(settings map[string]interface{}) (ret map[
 	// [[FBRoute POST:@"/appium/settings"] respondWithTarget:self action:@selector(handleSetSettings:)]
 	data := map[string]interface{}{"settings": settings}
 	var rawResp rawResponse
-	if rawResp, err = wd.executePost(data, "/session", wd.sessionId, "/appium/settings"); err != nil {
+	if rawResp, err = wd.executePost("SetAppiumSettings", data, "/session", wd.sessionID(), "/appium/settings"); err != nil {
 		return nil, err
 	}
 	var reply = new(struct{ Value map[string]interface{} })
@@ -935,7 +1650,7 @@ func (wd *remoteWD) SetAppiumSettings(settings map[string]interface{}) (ret map[
 
 func (wd *remoteWD) IsWdaHealthy() (healthy bool, err error) {
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/health"); err != nil {
+	if rawResp, err = wd.executeGet("IsWdaHealthy", "/health"); err != nil {
 		return false, err
 	}
 	if string(rawResp) != "I-AM-ALIVE" {
@@ -945,14 +1660,14 @@ func (wd *remoteWD) IsWdaHealthy() (healthy bool, err error) {
 }
 
 func (wd *remoteWD) WdaShutdown() (err error) {
-	_, err = wd.executeGet("/wda/shutdown")
+	_, err = wd.executeGet("WdaShutdown", "/wda/shutdown")
 	return
 }
 
 func (wd *remoteWD) WaitWithTimeoutAndInterval(condition Condition, timeout, interval time.Duration) error {
 	startTime := time.Now()
 	for {
-		done, err := condition(wd)
+		done, report, err := evaluateCondition(wd, condition)
 		if err != nil {
 			return err
 		}
@@ -961,18 +1676,35 @@ func (wd *remoteWD) WaitWithTimeoutAndInterval(condition Condition, timeout, int
 		}
 
 		if elapsed := time.Since(startTime); elapsed > timeout {
-			return fmt.Errorf("timeout after %v", elapsed)
+			if report.description == "" {
+				return fmt.Errorf("%w after %v", ErrTimeout, elapsed)
+			}
+			return fmt.Errorf("%w after %v waiting for %s, last observed: %s", ErrTimeout, elapsed, report.description, report.observed)
+		}
+		if err = sleepContext(wd.context(), interval); err != nil {
+			return err
 		}
-		time.Sleep(interval)
+	}
+}
+
+// sleepContext pauses for d, or less if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
 }
 
 func (wd *remoteWD) WaitWithTimeout(condition Condition, timeout time.Duration) error {
-	return wd.WaitWithTimeoutAndInterval(condition, timeout, DefaultWaitInterval)
+	return wd.WaitWithTimeoutAndInterval(condition, timeout, wd.options.waitIntervalOrDefault())
 }
 
 func (wd *remoteWD) Wait(condition Condition) error {
-	return wd.WaitWithTimeoutAndInterval(condition, DefaultWaitTimeout, DefaultWaitInterval)
+	return wd.WaitWithTimeoutAndInterval(condition, wd.options.waitTimeoutOrDefault(), wd.options.waitIntervalOrDefault())
 }
 
 /*------ uusense ------*/
@@ -998,7 +1730,7 @@ func (wd *remoteWD) Dragfromtoforduration(fromX, fromY, toX, toY float64, durati
 	} else {
 		data["duration"] = duration
 	}
-	_, err = wd.executePost(data, "/uusense/dragfromtoforduration")
+	_, err = wd.executePost("Dragfromtoforduration", data, "/uusense/dragfromtoforduration")
 	return
 }
 
@@ -1019,7 +1751,7 @@ func (wd *remoteWD) DoubleMove(aX1, aY1, aX2, aY2, bX1, bY1, bX2, bY2 float64, d
 	} else {
 		data["duration"] = duration
 	}
-	_, err = wd.executePost(data, "/uusense/doubleMove")
+	_, err = wd.executePost("DoubleMove", data, "/uusense/doubleMove")
 	return
 }
 
@@ -1033,7 +1765,7 @@ func (wd *remoteWD) SlidePath(points []map[string]int, duration float64) (err er
 	} else {
 		data["duration"] = duration
 	}
-	_, err = wd.executePost(data, "/uusense/move")
+	_, err = wd.executePost("SlidePath", data, "/uusense/move")
 	return
 }
 
@@ -1057,8 +1789,11 @@ func (wd *remoteWD) ScreenshotUUSense(shotType int, X float64, Y float64, width
 		"type":    qualitylocal,
 	}
 	var screenshotData rawResponse
-	screenshotData, err = wd.executePost(data, "uusense/screenshot")
+	screenshotData, err = wd.executePost("ScreenshotUUSense", data, "uusense/screenshot")
 	raw = bytes.NewBuffer(screenshotData)
+	if err == nil {
+		wd.observeScreenshot(raw.Len())
+	}
 	return
 }
 
@@ -1068,7 +1803,7 @@ func (wd *remoteWD) InputUUSense(test string) (err error) {
 	data := map[string]interface{}{
 		"text": test,
 	}
-	_, err = wd.executePost(data, "uusense/globalInput")
+	_, err = wd.executePost("InputUUSense", data, "uusense/globalInput")
 	return
 }
 
@@ -1098,7 +1833,7 @@ type StatusInfo struct {
 
 func (wd *remoteWD) GetDeviceInfo() (ret StatusInfo, err error) {
 	var rawResp rawResponse
-	if rawResp, err = wd.executeGet("/status"); err != nil {
+	if rawResp, err = wd.executeGet("GetDeviceInfo", "/status"); err != nil {
 		return StatusInfo{}, err
 	}
 
@@ -1109,6 +1844,6 @@ func (wd *remoteWD) GetDeviceInfo() (ret StatusInfo, err error) {
 		fmt.Println(err.Error())
 		return
 	}
-	wd.sessionId = ret.SessionID
+	wd.setSessionID(ret.SessionID)
 	return
 }
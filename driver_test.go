@@ -2,9 +2,19 @@ package gwda
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/electricbubble/gwda/wdatest"
 )
 
 var urlPrefix = "http://localhost:8100"
@@ -19,6 +29,193 @@ func setup(t *testing.T) {
 	}
 }
 
+// newTestDriver returns a driver talking to handler instead of a real WDA.
+func newTestDriver(t *testing.T, handler http.Handler) *remoteWD {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	wd := newRemoteWD()
+	var err error
+	if wd.urlPrefix, err = url.Parse(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	wd.setSessionID("test-session")
+	return wd
+}
+
+type countingTransport struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests++
+	c.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+type bufferLogger struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *bufferLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(&l.buf, format+"\n", v...)
+}
+
+func (l *bufferLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+func TestDriverOptions(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+
+	transport := new(countingTransport)
+	logger := new(bufferLogger)
+	driver, err := NewDriverWithOptions(nil, fake.URL,
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithLogger(logger),
+		WithWaitTimeout(20*time.Millisecond),
+		WithWaitInterval(5*time.Millisecond),
+		WithKeepAlive(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = driver.Wait(ElementPresent(BySelector{Name: "Login"}))
+	if !errors.Is(err, ErrTimeout) || time.Since(start) > DefaultWaitTimeout/2 {
+		t.Fatalf("got %v after %v", err, time.Since(start))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var checks int
+		for _, r := range fake.Requests() {
+			if r.Path == "/health" {
+				checks++
+			}
+		}
+		if checks >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no keep alive requests")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	transport.mu.Lock()
+	requests := transport.requests
+	transport.mu.Unlock()
+	// the keep alive may have sent another one meanwhile
+	if received := len(fake.Requests()); requests < received-1 {
+		t.Fatalf("%d requests sent with the client, %d received", requests, received)
+	}
+	if !strings.Contains(logger.String(), "--> POST "+fake.URL+"/session/"+fake.SessionID()+"/element") {
+		t.Fatalf("unexpected log %s", logger)
+	}
+}
+
+// newUSBTestDriver returns a driver taking the USB code path,
+// its connections go to the fake instead of usbmux.
+func newUSBTestDriver(tb testing.TB, fake *wdatest.Server) *remoteWD {
+	wd := newRemoteWD()
+	var err error
+	if wd.urlPrefix, err = url.Parse(fake.URL); err != nil {
+		tb.Fatal(err)
+	}
+	wd.setSessionID(fake.SessionID())
+	wd.usbCli = &usbClient{httpCli: newHTTPClient(defaultUSBConnections, func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", wd.urlPrefix.Host)
+	})}
+	tb.Cleanup(func() { _ = wd.Close() })
+	return wd
+}
+
+// BenchmarkUSBDrivers_Parallel drives a number of devices with one goroutine each,
+// every request takes a millisecond on the device.
+func BenchmarkUSBDrivers_Parallel(b *testing.B) {
+	for _, devices := range []int{1, 4, 10} {
+		b.Run(fmt.Sprintf("devices=%d", devices), func(b *testing.B) {
+			drivers := make([]*remoteWD, devices)
+			for i := range drivers {
+				fake := wdatest.NewServer()
+				b.Cleanup(fake.Close)
+				fake.Handle(http.MethodGet, "/status", func(w http.ResponseWriter, r *http.Request) {
+					time.Sleep(time.Millisecond)
+					_, _ = w.Write([]byte(`{"value":{"ready":true},"sessionId":"` + fake.SessionID() + `"}`))
+				})
+				drivers[i] = newUSBTestDriver(b, fake)
+			}
+
+			b.ResetTimer()
+			start := time.Now()
+			var wg sync.WaitGroup
+			for i, wd := range drivers {
+				requests := b.N / devices
+				if i < b.N%devices {
+					requests++
+				}
+				wg.Add(1)
+				go func(wd *remoteWD, requests int) {
+					defer wg.Done()
+					for j := 0; j < requests; j++ {
+						if _, err := wd.Status(); err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				}(wd, requests)
+			}
+			wg.Wait()
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "req/s")
+		})
+	}
+}
+
+func TestUSBDriver_Concurrent(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+
+	// the requests only complete once all of them arrived
+	const concurrent = defaultUSBConnections
+	var arrived sync.WaitGroup
+	arrived.Add(concurrent)
+	fake.Handle(http.MethodGet, "/status", func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		arrived.Wait()
+		_, _ = w.Write([]byte(`{"value":{"ready":true}}`))
+	})
+	wd := newUSBTestDriver(t, fake)
+
+	errs := make(chan error, concurrent)
+	for i := 0; i < concurrent; i++ {
+		go func() {
+			_, err := wd.Status()
+			errs <- err
+		}()
+	}
+	for i := 0; i < concurrent; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("the requests of a USB driver are serialized")
+		}
+	}
+}
+
 func TestViaUSB(t *testing.T) {
 	devices, err := DeviceList()
 	if err != nil {
@@ -721,7 +918,7 @@ func Test_remoteWD_Source(t *testing.T) {
 	// 	t.Fatal(err)
 	// }
 
-	source, err = driver.Source(NewSourceOption().WithScope("AppiumAUT"))
+	source, err = driver.Source(SourceOption{"scope": "AppiumAUT"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -827,3 +1024,120 @@ func Test_remoteWD_IOHIDEvent(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func Test_remoteWD_WithContext(t *testing.T) {
+	wd := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := wd.WithContext(ctx).Tap(200, 300)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if wd.Context() != context.Background() {
+		t.Fatal("WithContext must not modify the original driver")
+	}
+
+	element := &remoteWE{parent: wd, id: "1"}
+	err = element.WithContext(ctx).Click()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func Test_remoteWD_WithContext_Wait(t *testing.T) {
+	wd := newTestDriver(t, http.NotFoundHandler())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	never := func(d WebDriver) (bool, error) {
+		cancel()
+		return false, nil
+	}
+	err := wd.WithContext(ctx).WaitWithTimeoutAndInterval(never, time.Minute, time.Minute)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func Test_remoteWD_SessionRecovery(t *testing.T) {
+	const invalidSession = `{"value":{"error":"invalid session id","message":"Session does not exist","traceback":""}}`
+	current := "new-session"
+	var created int
+	wd := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/session":
+			created++
+			_, _ = fmt.Fprintf(w, `{"value":{"sessionId":%q,"capabilities":{}},"sessionId":%q}`, current, current)
+		case !strings.HasPrefix(r.URL.Path, "/session/"+current+"/"):
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(invalidSession))
+		case strings.HasSuffix(r.URL.Path, "/wda/screen"):
+			_, _ = w.Write([]byte(`{"value":{"statusBarSize":{"width":375,"height":20},"scale":2}}`))
+		default:
+			_, _ = w.Write([]byte(`{"value":null}`))
+		}
+	}))
+	wd.capabilities = NewCapabilities().WithDefaultAlertAction(AlertActionAccept)
+
+	if _, err := wd.Screen(); !errors.Is(err, ErrInvalidSessionID) {
+		t.Fatalf("expected %v without recovery, got %v", ErrInvalidSessionID, err)
+	}
+
+	var recovered []string
+	wd.options = newDriverOptions([]DriverOption{WithSessionRecovery(func(oldSessionId string, sessionInfo SessionInfo) {
+		recovered = append(recovered, oldSessionId+"->"+sessionInfo.SessionId)
+	})})
+
+	scale, err := wd.Scale()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scale != 2 || wd.sessionID() != current || created != 1 {
+		t.Fatalf("scale = %v, session = %s, created = %d", scale, wd.sessionID(), created)
+	}
+	if len(recovered) != 1 || recovered[0] != "test-session->new-session" {
+		t.Fatal(recovered)
+	}
+
+	// a tap is not idempotent, the error is returned after the session has been replaced
+	current = "newer-session"
+	if err = wd.Tap(1, 1); !errors.Is(err, ErrInvalidSessionID) {
+		t.Fatalf("expected %v, got %v", ErrInvalidSessionID, err)
+	}
+	if wd.sessionID() != current || created != 2 {
+		t.Fatalf("session = %s, created = %d", wd.sessionID(), created)
+	}
+	if err = wd.Tap(1, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewDriver_MjpegPort(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+
+	for _, tc := range []struct {
+		new  func() (WebDriver, error)
+		port string
+	}{
+		{func() (WebDriver, error) { return NewDriver(nil, fake.URL) }, "9100"},
+		{func() (WebDriver, error) { return NewDriver(nil, fake.URL, 9200) }, "9200"},
+		{func() (WebDriver, error) { return NewDriverWithOutNewSession(nil, fake.URL, 9300) }, "9300"},
+		{func() (WebDriver, error) { return NewDriverWithOptions(nil, fake.URL, WithMjpegPort(9400)) }, "9400"},
+	} {
+		driver, err := tc.new()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mjpegURL := driver.(*remoteWD).mjpegURL; !strings.HasSuffix(mjpegURL, ":"+tc.port) {
+			t.Errorf("expected the port %s, got %s", tc.port, mjpegURL)
+		}
+		_ = driver.Close()
+	}
+}
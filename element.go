@@ -2,6 +2,7 @@ package gwda
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -14,9 +15,13 @@ type remoteWE struct {
 	id     string
 }
 
+func (we remoteWE) WithContext(ctx context.Context) WebElement {
+	return &remoteWE{parent: we.parent.withContext(ctx), id: we.id}
+}
+
 func (we remoteWE) Click() (err error) {
 	// [[FBRoute POST:@"/element/:uuid/click"] respondWithTarget:self action:@selector(handleClick:)]
-	_, err = we.parent.executePost(nil, "/session", we.parent.sessionId, "/element", we.id, "/click")
+	_, err = we.parent.executePost("Element.Click", nil, "/session", we.parent.sessionID(), "/element", we.id, "/click")
 	return
 }
 
@@ -27,33 +32,37 @@ func (we remoteWE) SendKeys(text string, frequency ...int) (err error) {
 		frequency = []int{60}
 	}
 	data["frequency"] = frequency[0]
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/element", we.id, "/value")
+	_, err = we.parent.executePost("Element.SendKeys", data, "/session", we.parent.sessionID(), "/element", we.id, "/value")
 	return
 }
 
 func (we remoteWE) Clear() (err error) {
 	// [[FBRoute POST:@"/element/:uuid/clear"] respondWithTarget:self action:@selector(handleClear:)]
-	_, err = we.parent.executePost(nil, "/session", we.parent.sessionId, "/element", we.id, "/clear")
+	_, err = we.parent.executePost("Element.Clear", nil, "/session", we.parent.sessionID(), "/element", we.id, "/clear")
 	return
 }
 
 func (we remoteWE) Tap(x, y int) error {
-	return we.TapFloat(float64(x), float64(y))
+	return we.tap("Element.Tap", float64(x), float64(y))
 }
 
-func (we remoteWE) TapFloat(x, y float64) (err error) {
+func (we remoteWE) TapFloat(x, y float64) error {
+	return we.tap("Element.TapFloat", x, y)
+}
+
+func (we remoteWE) tap(command string, x, y float64) (err error) {
 	// [[FBRoute POST:@"/wda/tap/:uuid"] respondWithTarget:self action:@selector(handleTap:)]
 	data := map[string]interface{}{
 		"x": x,
 		"y": y,
 	}
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/wda/tap/", we.id)
+	_, err = we.parent.executePost(command, data, "/session", we.parent.sessionID(), "/wda/tap/", we.id)
 	return
 }
 
 func (we remoteWE) DoubleTap() (err error) {
 	// [[FBRoute POST:@"/wda/element/:uuid/doubleTap"] respondWithTarget:self action:@selector(handleDoubleTap:)]
-	_, err = we.parent.executePost(nil, "/session", we.parent.sessionId, "/wda/element", we.id, "/doubleTap")
+	_, err = we.parent.executePost("Element.DoubleTap", nil, "/session", we.parent.sessionID(), "/wda/element", we.id, "/doubleTap")
 	return
 }
 
@@ -64,13 +73,13 @@ func (we remoteWE) TouchAndHold(second ...float64) (err error) {
 		second = []float64{1.0}
 	}
 	data["duration"] = second[0]
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/wda/element", we.id, "/touchAndHold")
+	_, err = we.parent.executePost("Element.TouchAndHold", data, "/session", we.parent.sessionID(), "/wda/element", we.id, "/touchAndHold")
 	return
 }
 
 func (we remoteWE) TwoFingerTap() (err error) {
 	// [[FBRoute POST:@"/wda/element/:uuid/twoFingerTap"] respondWithTarget:self action:@selector(handleTwoFingerTap:)]
-	_, err = we.parent.executePost(nil, "/session", we.parent.sessionId, "/wda/element", we.id, "/twoFingerTap")
+	_, err = we.parent.executePost("Element.TwoFingerTap", nil, "/session", we.parent.sessionID(), "/wda/element", we.id, "/twoFingerTap")
 	return
 }
 
@@ -92,15 +101,19 @@ func (we remoteWE) TapWithNumberOfTaps(numberOfTaps, numberOfTouches int) (err e
 		"numberOfTaps":    numberOfTaps,
 		"numberOfTouches": numberOfTouches,
 	}
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/wda/element", we.id, "/tapWithNumberOfTaps")
+	_, err = we.parent.executePost("Element.TapWithNumberOfTaps", data, "/session", we.parent.sessionID(), "/wda/element", we.id, "/tapWithNumberOfTaps")
 	return
 }
 
 func (we remoteWE) ForceTouch(pressure float64, second ...float64) (err error) {
-	return we.ForceTouchFloat(-1, -1, pressure, second...)
+	return we.forceTouch("Element.ForceTouch", -1, -1, pressure, second...)
 }
 
 func (we remoteWE) ForceTouchFloat(x, y, pressure float64, second ...float64) (err error) {
+	return we.forceTouch("Element.ForceTouchFloat", x, y, pressure, second...)
+}
+
+func (we remoteWE) forceTouch(command string, x, y, pressure float64, second ...float64) (err error) {
 	// [[FBRoute POST:@"/wda/element/:uuid/forceTouch"] respondWithTarget:self action:@selector(handleForceTouch:)]
 	data := make(map[string]interface{})
 	if x != -1 && y != -1 {
@@ -112,15 +125,19 @@ func (we remoteWE) ForceTouchFloat(x, y, pressure float64, second ...float64) (e
 	}
 	data["pressure"] = pressure
 	data["duration"] = second[0]
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/wda/element", we.id, "/forceTouch")
+	_, err = we.parent.executePost(command, data, "/session", we.parent.sessionID(), "/wda/element", we.id, "/forceTouch")
 	return
 }
 
 func (we remoteWE) Drag(fromX, fromY, toX, toY int, pressForDuration ...float64) error {
-	return we.DragFloat(float64(fromX), float64(fromY), float64(toX), float64(toY), pressForDuration...)
+	return we.drag("Element.Drag", float64(fromX), float64(fromY), float64(toX), float64(toY), pressForDuration...)
+}
+
+func (we remoteWE) DragFloat(fromX, fromY, toX, toY float64, pressForDuration ...float64) error {
+	return we.drag("Element.DragFloat", fromX, fromY, toX, toY, pressForDuration...)
 }
 
-func (we remoteWE) DragFloat(fromX, fromY, toX, toY float64, pressForDuration ...float64) (err error) {
+func (we remoteWE) drag(command string, fromX, fromY, toX, toY float64, pressForDuration ...float64) (err error) {
 	// [[FBRoute POST:@"/wda/element/:uuid/dragfromtoforduration"] respondWithTarget:self action:@selector(handleDrag:)]
 	data := map[string]interface{}{
 		"fromX": fromX,
@@ -132,16 +149,16 @@ func (we remoteWE) DragFloat(fromX, fromY, toX, toY float64, pressForDuration ..
 		pressForDuration = []float64{1.0}
 	}
 	data["duration"] = pressForDuration[0]
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/wda/element", we.id, "/dragfromtoforduration")
+	_, err = we.parent.executePost(command, data, "/session", we.parent.sessionID(), "/wda/element", we.id, "/dragfromtoforduration")
 	return
 }
 
 func (we remoteWE) Swipe(fromX, fromY, toX, toY int) error {
-	return we.SwipeFloat(float64(fromX), float64(fromY), float64(toX), float64(toY))
+	return we.drag("Element.Swipe", float64(fromX), float64(fromY), float64(toX), float64(toY), 0)
 }
 
 func (we remoteWE) SwipeFloat(fromX, fromY, toX, toY float64) error {
-	return we.DragFloat(fromX, fromY, toX, toY, 0)
+	return we.drag("Element.SwipeFloat", fromX, fromY, toX, toY, 0)
 }
 
 func (we remoteWE) SwipeDirection(direction Direction, velocity ...float64) (err error) {
@@ -150,7 +167,7 @@ func (we remoteWE) SwipeDirection(direction Direction, velocity ...float64) (err
 	if len(velocity) != 0 && velocity[0] > 0 {
 		data["velocity"] = velocity[0]
 	}
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/wda/element", we.id, "/swipe")
+	_, err = we.parent.executePost("Element.SwipeDirection", data, "/session", we.parent.sessionID(), "/wda/element", we.id, "/swipe")
 	return
 }
 
@@ -172,7 +189,7 @@ func (we remoteWE) Pinch(scale, velocity float64) (err error) {
 		"scale":    scale,
 		"velocity": velocity,
 	}
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/wda/element", we.id, "/pinch")
+	_, err = we.parent.executePost("Element.Pinch", data, "/session", we.parent.sessionID(), "/wda/element", we.id, "/pinch")
 	return
 }
 
@@ -182,15 +199,16 @@ func (we remoteWE) PinchToZoomOutByW3CAction(scale ...float64) (err error) {
 	} else if scale[0] > 23 {
 		scale[0] = 23
 	}
-	var size Size
-	if size, err = we.Size(); err != nil {
+	var rect Rect
+	if rect, err = we.rect("Element.PinchToZoomOutByW3CAction"); err != nil {
 		return err
 	}
+	size := rect.Size
 	r := scale[0] * 2 / 100.0
 	offsetX, offsetY := float64(size.Width)*r, float64(size.Height)*r
 
 	actions := NewW3CActions().SwipeFloat(0-offsetX, 0-offsetY, 0, 0, we).SwipeFloat(offsetX, offsetY, 0, 0, we)
-	return we.parent.PerformW3CActions(actions)
+	return we.parent.performW3CActions("Element.PinchToZoomOutByW3CAction", actions)
 }
 
 func (we remoteWE) Rotate(rotation float64, velocity ...float64) (err error) {
@@ -208,7 +226,7 @@ func (we remoteWE) Rotate(rotation float64, velocity ...float64) (err error) {
 		"rotation": rotation,
 		"velocity": velocity[0],
 	}
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/wda/element", we.id, "/rotate")
+	_, err = we.parent.executePost("Element.Rotate", data, "/session", we.parent.sessionID(), "/wda/element", we.id, "/rotate")
 	return
 }
 
@@ -223,29 +241,29 @@ func (we remoteWE) PickerWheelSelect(order PickerWheelOrder, offset ...int) (err
 		"order":  order,
 		"offset": float64(offset[0]) * 0.1,
 	}
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/wda/pickerwheel", we.id, "/select")
+	_, err = we.parent.executePost("Element.PickerWheelSelect", data, "/session", we.parent.sessionID(), "/wda/pickerwheel", we.id, "/select")
 	return
 }
 
-func (we remoteWE) scroll(data interface{}) (err error) {
+func (we remoteWE) scroll(command string, data interface{}) (err error) {
 	// [[FBRoute POST:@"/wda/element/:uuid/scroll"] respondWithTarget:self action:@selector(handleScroll:)]
-	_, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/wda/element", we.id, "/scroll")
+	_, err = we.parent.executePost(command, data, "/session", we.parent.sessionID(), "/wda/element", we.id, "/scroll")
 	return
 }
 
 func (we remoteWE) ScrollElementByName(name string) error {
 	data := map[string]interface{}{"name": name}
-	return we.scroll(data)
+	return we.scroll("Element.ScrollElementByName", data)
 }
 
 func (we remoteWE) ScrollElementByPredicate(predicate string) error {
 	data := map[string]interface{}{"predicateString": predicate}
-	return we.scroll(data)
+	return we.scroll("Element.ScrollElementByPredicate", data)
 }
 
 func (we remoteWE) ScrollToVisible() error {
 	data := map[string]interface{}{"toVisible": true}
-	return we.scroll(data)
+	return we.scroll("Element.ScrollToVisible", data)
 }
 
 func (we remoteWE) ScrollDirection(direction Direction, distance ...float64) error {
@@ -256,7 +274,7 @@ func (we remoteWE) ScrollDirection(direction Direction, distance ...float64) err
 		"direction": direction,
 		"distance":  distance[0],
 	}
-	return we.scroll(data)
+	return we.scroll("Element.ScrollDirection", data)
 }
 
 func (we remoteWE) FindElement(by BySelector) (element WebElement, err error) {
@@ -267,12 +285,12 @@ func (we remoteWE) FindElement(by BySelector) (element WebElement, err error) {
 		"value": value,
 	}
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/element", we.id, "/element"); err != nil {
+	if rawResp, err = we.parent.executePost("Element.FindElement", data, "/session", we.parent.sessionID(), "/element", we.id, "/element"); err != nil {
 		return nil, err
 	}
 	var elementID string
 	if elementID, err = rawResp.valueConvertToElementID(); err != nil {
-		if errors.Is(err, errNoSuchElement) {
+		if errors.Is(err, ErrNoSuchElement) {
 			return nil, fmt.Errorf("%w: unable to find an element using '%s', value '%s'", err, using, value)
 		}
 		return nil, err
@@ -289,12 +307,12 @@ func (we remoteWE) FindElements(by BySelector) (elements []WebElement, err error
 		"value": value,
 	}
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executePost(data, "/session", we.parent.sessionId, "/element", we.id, "/elements"); err != nil {
+	if rawResp, err = we.parent.executePost("Element.FindElements", data, "/session", we.parent.sessionID(), "/element", we.id, "/elements"); err != nil {
 		return nil, err
 	}
 	var elementIDs []string
 	if elementIDs, err = rawResp.valueConvertToElementIDs(); err != nil {
-		if errors.Is(err, errNoSuchElement) {
+		if errors.Is(err, ErrNoSuchElement) {
 			return nil, fmt.Errorf("%w: unable to find an element using '%s', value '%s'", err, using, value)
 		}
 		return nil, err
@@ -309,12 +327,12 @@ func (we remoteWE) FindElements(by BySelector) (elements []WebElement, err error
 func (we remoteWE) FindVisibleCells() (elements []WebElement, err error) {
 	// [[FBRoute GET:@"/wda/element/:uuid/getVisibleCells"] respondWithTarget:self action:@selector(handleFindVisibleCells:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/wda/element", we.id, "/getVisibleCells"); err != nil {
+	if rawResp, err = we.parent.executeGet("Element.FindVisibleCells", "/session", we.parent.sessionID(), "/wda/element", we.id, "/getVisibleCells"); err != nil {
 		return nil, err
 	}
 	var elementIDs []string
 	if elementIDs, err = rawResp.valueConvertToElementIDs(); err != nil {
-		if errors.Is(err, errNoSuchElement) {
+		if errors.Is(err, ErrNoSuchElement) {
 			return nil, fmt.Errorf("%w: unable to find a cell element in this element", err)
 		}
 		return nil, err
@@ -327,9 +345,13 @@ func (we remoteWE) FindVisibleCells() (elements []WebElement, err error) {
 }
 
 func (we remoteWE) Rect() (rect Rect, err error) {
+	return we.rect("Element.Rect")
+}
+
+func (we remoteWE) rect(command string) (rect Rect, err error) {
 	// [[FBRoute GET:@"/element/:uuid/rect"] respondWithTarget:self action:@selector(handleGetRect:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/element", we.id, "/rect"); err != nil {
+	if rawResp, err = we.parent.executeGet(command, "/session", we.parent.sessionID(), "/element", we.id, "/rect"); err != nil {
 		return Rect{}, err
 	}
 	var reply = new(struct{ Value struct{ Rect } })
@@ -341,7 +363,7 @@ func (we remoteWE) Rect() (rect Rect, err error) {
 }
 
 func (we remoteWE) Location() (Point, error) {
-	rect, err := we.Rect()
+	rect, err := we.rect("Element.Location")
 	if err != nil {
 		return Point{}, err
 	}
@@ -349,7 +371,7 @@ func (we remoteWE) Location() (Point, error) {
 }
 
 func (we remoteWE) Size() (Size, error) {
-	rect, err := we.Rect()
+	rect, err := we.rect("Element.Size")
 	if err != nil {
 		return Size{}, err
 	}
@@ -359,7 +381,7 @@ func (we remoteWE) Size() (Size, error) {
 func (we remoteWE) Text() (text string, err error) {
 	// [[FBRoute GET:@"/element/:uuid/text"] respondWithTarget:self action:@selector(handleGetText:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/element", we.id, "/text"); err != nil {
+	if rawResp, err = we.parent.executeGet("Element.Text", "/session", we.parent.sessionID(), "/element", we.id, "/text"); err != nil {
 		return "", err
 	}
 	if text, err = rawResp.valueConvertToString(); err != nil {
@@ -371,7 +393,7 @@ func (we remoteWE) Text() (text string, err error) {
 func (we remoteWE) Type() (elemType string, err error) {
 	// [[FBRoute GET:@"/element/:uuid/name"] respondWithTarget:self action:@selector(handleGetName:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/element", we.id, "/name"); err != nil {
+	if rawResp, err = we.parent.executeGet("Element.Type", "/session", we.parent.sessionID(), "/element", we.id, "/name"); err != nil {
 		return "", err
 	}
 	if elemType, err = rawResp.valueConvertToString(); err != nil {
@@ -383,7 +405,7 @@ func (we remoteWE) Type() (elemType string, err error) {
 func (we remoteWE) IsEnabled() (enabled bool, err error) {
 	// [[FBRoute GET:@"/element/:uuid/enabled"] respondWithTarget:self action:@selector(handleGetEnabled:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/element", we.id, "/enabled"); err != nil {
+	if rawResp, err = we.parent.executeGet("Element.IsEnabled", "/session", we.parent.sessionID(), "/element", we.id, "/enabled"); err != nil {
 		return false, err
 	}
 	if enabled, err = rawResp.valueConvertToBool(); err != nil {
@@ -395,7 +417,7 @@ func (we remoteWE) IsEnabled() (enabled bool, err error) {
 func (we remoteWE) IsDisplayed() (displayed bool, err error) {
 	// [[FBRoute GET:@"/element/:uuid/displayed"] respondWithTarget:self action:@selector(handleGetDisplayed:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/element", we.id, "/displayed"); err != nil {
+	if rawResp, err = we.parent.executeGet("Element.IsDisplayed", "/session", we.parent.sessionID(), "/element", we.id, "/displayed"); err != nil {
 		return false, err
 	}
 	if displayed, err = rawResp.valueConvertToBool(); err != nil {
@@ -407,7 +429,7 @@ func (we remoteWE) IsDisplayed() (displayed bool, err error) {
 func (we remoteWE) IsSelected() (selected bool, err error) {
 	// [[FBRoute GET:@"/element/:uuid/selected"] respondWithTarget:self action:@selector(handleGetSelected:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/element", we.id, "/selected"); err != nil {
+	if rawResp, err = we.parent.executeGet("Element.IsSelected", "/session", we.parent.sessionID(), "/element", we.id, "/selected"); err != nil {
 		return false, err
 	}
 	if selected, err = rawResp.valueConvertToBool(); err != nil {
@@ -419,7 +441,7 @@ func (we remoteWE) IsSelected() (selected bool, err error) {
 func (we remoteWE) IsAccessible() (accessible bool, err error) {
 	// [[FBRoute GET:@"/wda/element/:uuid/accessible"] respondWithTarget:self action:@selector(handleGetAccessible:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/wda/element", we.id, "/accessible"); err != nil {
+	if rawResp, err = we.parent.executeGet("Element.IsAccessible", "/session", we.parent.sessionID(), "/wda/element", we.id, "/accessible"); err != nil {
 		return false, err
 	}
 	if accessible, err = rawResp.valueConvertToBool(); err != nil {
@@ -431,7 +453,7 @@ func (we remoteWE) IsAccessible() (accessible bool, err error) {
 func (we remoteWE) IsAccessibilityContainer() (isAccessibilityContainer bool, err error) {
 	// [[FBRoute GET:@"/wda/element/:uuid/accessibilityContainer"] respondWithTarget:self action:@selector(handleGetIsAccessibilityContainer:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/wda/element", we.id, "/accessibilityContainer"); err != nil {
+	if rawResp, err = we.parent.executeGet("Element.IsAccessibilityContainer", "/session", we.parent.sessionID(), "/wda/element", we.id, "/accessibilityContainer"); err != nil {
 		return false, err
 	}
 	if isAccessibilityContainer, err = rawResp.valueConvertToBool(); err != nil {
@@ -443,7 +465,7 @@ func (we remoteWE) IsAccessibilityContainer() (isAccessibilityContainer bool, er
 func (we remoteWE) GetAttribute(attr ElementAttribute) (value string, err error) {
 	// [[FBRoute GET:@"/element/:uuid/attribute/:name"] respondWithTarget:self action:@selector(handleGetAttribute:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/element", we.id, "/attribute", attr.getAttributeName()); err != nil {
+	if rawResp, err = we.parent.executeGet("Element.GetAttribute", "/session", we.parent.sessionID(), "/element", we.id, "/attribute", attr.getAttributeName()); err != nil {
 		return "", err
 	}
 	if value, err = rawResp.valueConvertToString(); err != nil {
@@ -462,11 +484,12 @@ func (we remoteWE) Screenshot() (raw *bytes.Buffer, err error) {
 	// JSONWP element screenshot
 	// [[FBRoute GET:@"/screenshot/:uuid"] respondWithTarget:self action:@selector(handleElementScreenshot:)]
 	var rawResp rawResponse
-	if rawResp, err = we.parent.executeGet("/session", we.parent.sessionId, "/element", we.id, "/screenshot"); err != nil {
+	if rawResp, err = we.parent.executeGet("Element.Screenshot", "/session", we.parent.sessionID(), "/element", we.id, "/screenshot"); err != nil {
 		return nil, err
 	}
 	if raw, err = rawResp.valueDecodeAsBase64(); err != nil {
 		return nil, err
 	}
+	we.parent.observeScreenshot(raw.Len())
 	return
 }
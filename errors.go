@@ -0,0 +1,67 @@
+package gwda
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Sentinel errors for the W3C error codes callers most often branch on.
+// They are matched by a *WDAError carrying the corresponding code:
+//
+//	if errors.Is(err, gwda.ErrStaleElementReference) {
+//		// find the element again
+//	}
+var (
+	ErrNoSuchElement          = errors.New("no such element")
+	ErrStaleElementReference  = errors.New("stale element reference")
+	ErrNoSuchAlert            = errors.New("no such alert")
+	ErrInvalidSessionID       = errors.New("invalid session id")
+	ErrElementNotInteractable = errors.New("element not interactable")
+	ErrTimeout                = errors.New("timeout")
+)
+
+// ErrImageNotFound is returned when no area of the screen matches a template image.
+var ErrImageNotFound = errors.New("image not found")
+
+var wdaErrorCodes = map[string]error{
+	"no such element":          ErrNoSuchElement,
+	"stale element reference":  ErrStaleElementReference,
+	"no such alert":            ErrNoSuchAlert,
+	"invalid session id":       ErrInvalidSessionID,
+	"element not interactable": ErrElementNotInteractable,
+	"timeout":                  ErrTimeout,
+}
+
+// WDAError is returned when WebDriverAgent responds to a request with an error.
+type WDAError struct {
+	// Code is the W3C error code, e.g. "no such element"
+	Code string
+	// Message is the human readable description reported by WDA
+	Message string
+	// Traceback is the stack trace of the failure on the device, if any
+	Traceback string
+
+	StatusCode int
+	Method     string
+	URL        string
+}
+
+var reErrMessage = regexp.MustCompile(`{.+?=(.+?)}`)
+
+func (e *WDAError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("%s %s: unexpected status %d: %s", e.Method, e.URL, e.StatusCode, e.Message)
+	}
+	text := e.Message
+	if subMatch := reErrMessage.FindStringSubmatch(e.Message); subMatch != nil {
+		text = subMatch[len(subMatch)-1]
+	}
+	return fmt.Sprintf("%s: %s", e.Code, text)
+}
+
+// Is reports whether target is the sentinel error of the W3C error code.
+func (e *WDAError) Is(target error) bool {
+	sentinel, ok := wdaErrorCodes[e.Code]
+	return ok && sentinel == target
+}
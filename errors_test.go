@@ -0,0 +1,42 @@
+package gwda
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWDAError(t *testing.T) {
+	wd := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/alert/text"):
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"value":{"error":"no such alert","message":"An attempt was made to operate on a modal dialog when one was not open","traceback":"(\n\t0 WebDriverAgentLib\n)"},"sessionId":"test-session"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte("bad gateway"))
+		}
+	}))
+
+	_, err := wd.AlertText()
+	if !errors.Is(err, ErrNoSuchAlert) {
+		t.Fatalf("expected %v, got %v", ErrNoSuchAlert, err)
+	}
+	if errors.Is(err, ErrNoSuchElement) {
+		t.Fatal("unexpected match of", ErrNoSuchElement)
+	}
+	var wdaErr *WDAError
+	if !errors.As(err, &wdaErr) {
+		t.Fatalf("expected *WDAError, got %T", err)
+	}
+	if wdaErr.StatusCode != http.StatusBadRequest || wdaErr.Method != http.MethodGet ||
+		!strings.HasSuffix(wdaErr.URL, "/session/test-session/alert/text") || wdaErr.Traceback == "" {
+		t.Fatalf("unexpected error details: %+v", wdaErr)
+	}
+
+	_, err = wd.Status()
+	if !errors.As(err, &wdaErr) || wdaErr.StatusCode != http.StatusBadGateway || wdaErr.Message != "bad gateway" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package gwda
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Forwarder forwards the connections accepted on a local address to a port of a device,
+// like 'iproxy' of libimobiledevice. Each connection opens its own usbmux stream.
+type Forwarder struct {
+	listener net.Listener
+	dial     func() (net.Conn, error)
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	stats   ForwardStats
+	closing bool
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// ForwardStats counts the connections of a Forwarder.
+type ForwardStats struct {
+	// Active is the number of connections currently forwarded
+	Active int
+	// Accepted is the number of local connections accepted so far
+	Accepted int
+	// Failed is the number of connections to the device which could not be opened
+	Failed int
+	// BytesUp and BytesDown are the bytes sent to and received from the device,
+	// counted once the sending side of a connection is done
+	BytesUp, BytesDown int64
+}
+
+// Forward listens on localAddr, e.g. "localhost:8100" or ":0" for any free port,
+// and forwards each accepted connection to devicePort, e.g.
+//
+//	device, _ := gwda.NewDevice()
+//	forwarder, _ := device.Forward("localhost:8100", 8100)
+//	defer forwarder.Close()
+//	driver, _ := gwda.NewDriver(nil, "http://"+forwarder.Addr().String())
+func (d Device) Forward(localAddr string, devicePort int) (*Forwarder, error) {
+	if d.d == nil {
+		return nil, fmt.Errorf("device %s not connected", d.serialNumber)
+	}
+	listener, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return nil, err
+	}
+	return newForwarder(listener, func() (net.Conn, error) {
+		conn, err := d.d.NewConnect(devicePort, 5*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("create connection: %w", err)
+		}
+		// the usbmux handshake leaves its deadline on the raw connection
+		rawConn := conn.RawConn()
+		if err = rawConn.SetDeadline(time.Time{}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return rawConn, nil
+	}), nil
+}
+
+func newForwarder(listener net.Listener, dial func() (net.Conn, error)) *Forwarder {
+	f := &Forwarder{listener: listener, dial: dial, conns: make(map[net.Conn]struct{})}
+	f.wg.Add(1)
+	go f.serve()
+	return f
+}
+
+// Addr returns the local address the forwarder listens on.
+func (f *Forwarder) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Stats returns the counts of the connections so far.
+func (f *Forwarder) Stats() ForwardStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.stats
+}
+
+// Close stops listening and closes all forwarded connections.
+func (f *Forwarder) Close() error {
+	f.closeOnce.Do(func() {
+		f.closeErr = f.listener.Close()
+		f.mu.Lock()
+		f.closing = true
+		for conn := range f.conns {
+			_ = conn.Close()
+		}
+		f.mu.Unlock()
+		f.wg.Wait()
+	})
+	return f.closeErr
+}
+
+func (f *Forwarder) serve() {
+	defer f.wg.Done()
+	for {
+		local, err := f.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		f.mu.Lock()
+		f.stats.Accepted++
+		f.mu.Unlock()
+
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			f.forward(local)
+		}()
+	}
+}
+
+// track adds conn to the open connections, false if the forwarder is closed already.
+func (f *Forwarder) track(conns ...net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closing {
+		return false
+	}
+	for _, conn := range conns {
+		f.conns[conn] = struct{}{}
+	}
+	f.stats.Active++
+	return true
+}
+
+func (f *Forwarder) untrack(conns ...net.Conn) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, conn := range conns {
+		delete(f.conns, conn)
+	}
+	f.stats.Active--
+}
+
+func (f *Forwarder) forward(local net.Conn) {
+	remote, err := f.dial()
+	if err != nil {
+		debugLogf(nil, "forward %s: %v", local.RemoteAddr(), err)
+		f.mu.Lock()
+		f.stats.Failed++
+		f.mu.Unlock()
+		_ = local.Close()
+		return
+	}
+	if !f.track(local, remote) {
+		_ = local.Close()
+		_ = remote.Close()
+		return
+	}
+	defer f.untrack(local, remote)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		n := splice(remote, local)
+		f.mu.Lock()
+		f.stats.BytesUp += n
+		f.mu.Unlock()
+	}()
+	go func() {
+		defer wg.Done()
+		n := splice(local, remote)
+		f.mu.Lock()
+		f.stats.BytesDown += n
+		f.mu.Unlock()
+	}()
+	wg.Wait()
+	_ = local.Close()
+	_ = remote.Close()
+}
+
+// splice copies src to dst until src is done, then closes the writing side of dst,
+// or dst completely if it cannot be half closed.
+func splice(dst, src net.Conn) int64 {
+	n, _ := io.Copy(dst, src)
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	} else {
+		_ = dst.Close()
+		_ = src.Close()
+	}
+	return n
+}
@@ -0,0 +1,104 @@
+package gwda
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func newTestForwarder(t *testing.T, dial func() (net.Conn, error)) *Forwarder {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := newForwarder(listener, dial)
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+func TestForwarder(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+	host := fake.URL[len("http://"):]
+
+	f := newTestForwarder(t, func() (net.Conn, error) {
+		return net.Dial("tcp", host)
+	})
+	driver, err := NewDriver(nil, "http://"+f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = driver.Status(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := f.Stats(); stats.Accepted == 0 || stats.Active == 0 || stats.Failed != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := f.Stats(); stats.Active != 0 || stats.BytesUp == 0 || stats.BytesDown == 0 {
+		t.Errorf("unexpected stats after Close %+v", stats)
+	}
+	if _, err = net.Dial("tcp", f.Addr().String()); err == nil {
+		t.Error("still listening after Close")
+	}
+}
+
+func TestForwarder_HalfClose(t *testing.T) {
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go func() {
+		conn, err := backend.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// answers once the request is complete
+		request, _ := io.ReadAll(conn)
+		_, _ = conn.Write(append([]byte("echo "), request...))
+	}()
+
+	f := newTestForwarder(t, func() (net.Conn, error) {
+		return net.Dial("tcp", backend.Addr().String())
+	})
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("ping"))
+	_ = conn.(*net.TCPConn).CloseWrite()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != io.EOF || reply != "echo ping" {
+		t.Errorf("reply %q, %v", reply, err)
+	}
+}
+
+func TestForwarder_DialFailure(t *testing.T) {
+	f := newTestForwarder(t, func() (net.Conn, error) {
+		return nil, errors.New("device gone")
+	})
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+	if stats := f.Stats(); stats.Accepted != 1 || stats.Failed != 1 || stats.Active != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
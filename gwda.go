@@ -5,24 +5,24 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"image"
 	"io"
 	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
-// HTTPClient The default client to use to communicate with the WebDriver server.
+// HTTPClient The default client to use to communicate with the WebDriver server,
+// unless the driver was created WithHTTPClient.
 var HTTPClient = http.DefaultClient
 
+// The defaults of the drivers not created WithWaitTimeout, WithWaitInterval or WithKeepAlive.
 var (
 	DefaultWaitTimeout  = 60 * time.Second
 	DefaultWaitInterval = 400 * time.Millisecond
@@ -30,39 +30,40 @@ var (
 	DefaultKeepAliveInterval = 30 * time.Second
 )
 
-func newRequest(method string, url string, rawBody []byte) (request *http.Request, err error) {
+func newRequest(ctx context.Context, method string, url string, rawBody []byte, extraHeader http.Header) (request *http.Request, err error) {
 	var header = map[string]string{
 		"Content-Type": "application/json;charset=UTF-8",
 		"Accept":       "application/json",
 	}
-	if request, err = http.NewRequest(method, url, bytes.NewBuffer(rawBody)); err != nil {
+	if request, err = http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(rawBody)); err != nil {
 		return nil, err
 	}
 	for k, v := range header {
 		request.Header.Set(k, v)
 	}
+	for k, v := range extraHeader {
+		request.Header[http.CanonicalHeaderKey(k)] = v
+	}
 	return
 }
 
-var _mUSB sync.Mutex
-
-func executeHTTP(method string, rawURL string, rawBody []byte, usbHTTPClient ...*http.Client) (rawResp rawResponse, err error) {
-	debugLog(fmt.Sprintf("--> %s %s\n%s", method, rawURL, rawBody))
+// executeHTTP sends the request with client, or HTTPClient if nil, the exchange is logged to logging.
+// header is added to the request and may be nil.
+func executeHTTP(ctx context.Context, client *http.Client, logging *requestLogging, method string, rawURL string, rawBody []byte, header http.Header) (rawResp rawResponse, err error) {
+	logging.before(method, rawURL, rawBody)
 	var req *http.Request
-	if req, err = newRequest(method, rawURL, rawBody); err != nil {
+	if req, err = newRequest(ctx, method, rawURL, rawBody, header); err != nil {
 		return
 	}
 
-	tmpHTTPClient := HTTPClient
-	if len(usbHTTPClient) != 0 {
-		tmpHTTPClient = usbHTTPClient[0]
-		_mUSB.Lock()
-		defer _mUSB.Unlock()
+	if client == nil {
+		client = HTTPClient
 	}
 
 	start := time.Now()
 	var resp *http.Response
-	if resp, err = tmpHTTPClient.Do(req); err != nil {
+	if resp, err = client.Do(req); err != nil {
+		logging.after(method, rawURL, rawBody, 0, time.Since(start), nil, err)
 		return nil, err
 	}
 	defer func() {
@@ -72,7 +73,7 @@ func executeHTTP(method string, rawURL string, rawBody []byte, usbHTTPClient ...
 	}()
 
 	rawResp, err = ioutil.ReadAll(resp.Body)
-	debugLog(fmt.Sprintf("<-- %s %s %d %s\n%s\n", method, rawURL, resp.StatusCode, time.Since(start), rawResp))
+	logging.after(method, rawURL, rawBody, resp.StatusCode, time.Since(start), rawResp, err)
 	if err != nil {
 		return nil, err
 	}
@@ -81,49 +82,57 @@ func executeHTTP(method string, rawURL string, rawBody []byte, usbHTTPClient ...
 		if resp.StatusCode == http.StatusOK {
 			return rawResp, nil
 		}
-		return nil, err
+		wdaErr, ok := err.(*WDAError)
+		if !ok {
+			// not a WDA reply at all, e.g. a proxy in between failed
+			wdaErr = &WDAError{Message: string(rawResp)}
+			if len(wdaErr.Message) > 256 {
+				wdaErr.Message = wdaErr.Message[:256] + "..."
+			}
+		}
+		wdaErr.StatusCode = resp.StatusCode
+		wdaErr.Method = method
+		wdaErr.URL = redactURL(rawURL)
+		return nil, wdaErr
 	}
 
 	return
 }
 
-func keepAlive(d WebDriver) {
-	go func() {
-		if DefaultKeepAliveInterval <= 0 {
-			return
-		}
-		ticker := time.NewTicker(DefaultKeepAliveInterval)
-		for {
-			select {
-			case <-ticker.C:
-				if _, err := d.Status(); err != nil {
-					ticker.Stop()
-					return
-				}
-			}
-		}
-	}()
-}
-
 var debugFlag = false
 
-// SetDebug sets debug mode
+// SetDebug sets debug mode of the drivers not created WithLogger,
+// which log their requests to the standard logger with the bodies truncated, see WithLogBodyLimit.
 func SetDebug(debug bool) {
 	debugFlag = debug
 }
 
-func debugLog(msg string) {
+// Logger receives the debug output of a driver, e.g. a *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// debugLogf writes to logger if not nil, otherwise to the standard logger in debug mode.
+func debugLogf(logger Logger, format string, v ...interface{}) {
+	if logger != nil {
+		logger.Printf("[GWDA-DEBUG] "+format, v...)
+		return
+	}
 	if !debugFlag {
 		return
 	}
-	log.Println("[GWDA-DEBUG] " + msg)
+	log.Printf("[GWDA-DEBUG] "+format, v...)
 }
 
-func convertToHTTPClient(_conn net.Conn) *http.Client {
+// newHTTPClient returns a client whose transport connects with dial.
+// maxConns limits the connections open at once if > 0, further requests wait for a free one.
+func newHTTPClient(maxConns int, dial func(ctx context.Context) (net.Conn, error)) *http.Client {
 	return &http.Client{
 		Transport: &http.Transport{
-			DialContext: func(_ context.Context, _, _ string) (net.Conn, error) {
-				return _conn, nil
+			MaxConnsPerHost:     maxConns,
+			MaxIdleConnsPerHost: maxConns,
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dial(ctx)
 			},
 		},
 	}
@@ -143,13 +152,11 @@ func (r rawResponse) checkErr() (err error) {
 		return err
 	}
 	if reply.Value.Err != "" {
-		errText := reply.Value.Message
-		re := regexp.MustCompile(`{.+?=(.+?)}`)
-		if re.MatchString(reply.Value.Message) {
-			subMatch := re.FindStringSubmatch(reply.Value.Message)
-			errText = subMatch[len(subMatch)-1]
+		return &WDAError{
+			Code:      reply.Value.Err,
+			Message:   reply.Value.Message,
+			Traceback: reply.Value.Traceback,
 		}
-		return fmt.Errorf("%s: %s", reply.Value.Err, errText)
 	}
 	return
 }
@@ -203,15 +210,13 @@ func (r rawResponse) valueDecodeAsBase64() (raw *bytes.Buffer, err error) {
 	return
 }
 
-var errNoSuchElement = errors.New("no such element")
-
 func (r rawResponse) valueConvertToElementID() (id string, err error) {
 	var reply = new(struct{ Value map[string]string })
 	if err = json.Unmarshal(r, reply); err != nil {
 		return "", err
 	}
 	if len(reply.Value) == 0 {
-		return "", errNoSuchElement
+		return "", ErrNoSuchElement
 	}
 	if id = elementIDFromValue(reply.Value); id == "" {
 		return "", fmt.Errorf("invalid element returned: %+v", reply)
@@ -225,7 +230,7 @@ func (r rawResponse) valueConvertToElementIDs() (IDs []string, err error) {
 		return nil, err
 	}
 	if len(reply.Value) == 0 {
-		return nil, errNoSuchElement
+		return nil, ErrNoSuchElement
 	}
 	IDs = make([]string, len(reply.Value))
 	for i, elem := range reply.Value {
@@ -880,6 +885,8 @@ const (
 	ProtectedResourceHealth                 ProtectedResource = -0x40000003
 )
 
+// Condition is polled by Wait until it is met or returns an error,
+// see ElementPresent, AppInState, And and the other conditions of this package.
 type Condition func(wd WebDriver) (bool, error)
 
 type Direction string
@@ -910,6 +917,14 @@ type Rect struct {
 
 // WebDriver defines methods supported by WebDriver drivers.
 type WebDriver interface {
+	// WithContext Returns a shallow copy of the driver whose requests are bound to ctx.
+	// The copy shares the session and connections with the original driver,
+	// so it is cheap to create one per step to enforce a deadline.
+	//  driver.WithContext(ctx).Tap(x, y)
+	WithContext(ctx context.Context) WebDriver
+	// Context Returns the context set by WithContext, defaults to context.Background
+	Context() context.Context
+
 	// NewSession starts a new session and returns the SessionInfo.
 	NewSession(capabilities Capabilities) (SessionInfo, error)
 
@@ -1064,13 +1079,33 @@ type WebDriver interface {
 	ActiveElement() (WebElement, error)
 	FindElement(by BySelector) (WebElement, error)
 	FindElements(by BySelector) ([]WebElement, error)
+	// FindNodes Evaluates an XPath or Predicate selector against a snapshot of Source,
+	// the nodes carry their frame, so they can be tapped without an element lookup.
+	// The snapshot is shared with the local queries enabled by WithLocalQueries.
+	FindNodes(by BySelector) ([]*Node, error)
+	// InvalidateSnapshot Drops the snapshot of FindNodes and the local queries,
+	// e.g. after the screen changed by itself
+	InvalidateSnapshot()
 
 	Screenshot() (*bytes.Buffer, error)
 
+	// FindImage Returns the area of the screen matching template best, in points.
+	// Fails with ErrImageNotFound when no area reaches the threshold.
+	FindImage(template image.Image, matchOpt ...ImageMatchOption) (ImageMatch, error)
+	// FindImages Returns all areas of the screen matching template, in points and ordered by confidence.
+	FindImages(template image.Image, matchOpt ...ImageMatchOption) ([]ImageMatch, error)
+	// TapImage Taps the center of the area matching template best
+	TapImage(template image.Image, matchOpt ...ImageMatchOption) error
+	// WaitForImage Waits until template appears on the screen
+	WaitForImage(template image.Image, timeout time.Duration, matchOpt ...ImageMatchOption) (ImageMatch, error)
+
 	// Source Return application elements tree
 	Source(srcOpt ...SourceOption) (string, error)
 	// AccessibleSource Return application elements accessibility tree
 	AccessibleSource() (string, error)
+	// Hierarchy Return application elements tree parsed from Source,
+	// for any number of lookups without further requests
+	Hierarchy(srcOpt ...SourceOption) (*Hierarchy, error)
 
 	// HealthCheck Health check might modify simulator state so it should only be called in-between testing sessions
 	//  Checks health of XCTest by:
@@ -1083,7 +1118,15 @@ type WebDriver interface {
 	IsWdaHealthy() (bool, error)
 	WdaShutdown() error
 
+	// HealthEvents Returns the changes of the health of WDA found by the keep-alive, see WithKeepAlive.
+	// The channel is shared by all readers and closed by Close,
+	// the oldest events are dropped if it is not read.
+	HealthEvents() <-chan HealthEvent
+	// Close Stops the keep-alive, completes a screen recording and closes the connections of the driver.
+	Close() error
+
 	// WaitWithTimeoutAndInterval waits for the condition to evaluate to true.
+	// It returns early with the context's error once the driver's context is done.
 	WaitWithTimeoutAndInterval(condition Condition, timeout, interval time.Duration) error
 	// WaitWithTimeout works like WaitWithTimeoutAndInterval, but with default polling interval.
 	WaitWithTimeout(condition Condition, timeout time.Duration) error
@@ -1091,6 +1134,16 @@ type WebDriver interface {
 	Wait(condition Condition) error
 
 	GetMjpegHTTPClient() *http.Client
+	// MjpegStream Starts decoding the screen broadcast of the MJPEG server,
+	// the stream ends with the driver's context or when it is closed.
+	MjpegStream(options ...MjpegStreamOption) (*MjpegStream, error)
+
+	// StartRecording Records the screen broadcast of the MJPEG server to path,
+	// by default as Motion-JPEG AVI file.
+	StartRecording(path string, recOpt ...RecordingOption) error
+	// StopRecording Stops the recording and completes the file,
+	// reports why the recording ended early when it reached no max duration.
+	StopRecording() error
 
 	//uusense
 	Dragfromtoforduration(fromX, fromY, toX, toY float64, duration float64) (err error)
@@ -1103,6 +1156,9 @@ type WebDriver interface {
 
 // WebElement defines method supported by web elements.
 type WebElement interface {
+	// WithContext Returns a copy of the element whose requests are bound to ctx.
+	WithContext(ctx context.Context) WebElement
+
 	// Click Waits for element to become stable (not move) and performs sync tap on element.
 	Click() error
 	// SendKeys Types a text into element. It will try to activate keyboard on element,
@@ -0,0 +1,205 @@
+package gwda
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// HealthState is the health of WDA as seen by the keep-alive of a driver.
+type HealthState int
+
+const (
+	// HealthStateHealthy WDA answered the last health check.
+	HealthStateHealthy HealthState = iota
+	// HealthStateDegraded WDA failed the last health checks, but fewer than lostAfterFailures.
+	HealthStateDegraded
+	// HealthStateLost WDA failed lostAfterFailures health checks in a row,
+	// a driver connected via USB reconnects to the device, and again after a growing delay
+	// as long as WDA stays lost.
+	HealthStateLost
+)
+
+func (s HealthState) String() string {
+	switch s {
+	case HealthStateHealthy:
+		return "Healthy"
+	case HealthStateDegraded:
+		return "Degraded"
+	case HealthStateLost:
+		return "Lost"
+	}
+	return "Unknown"
+}
+
+// HealthEvent is published by the keep-alive of a driver whenever the HealthState changes.
+type HealthEvent struct {
+	State HealthState
+	// Err is the failure of the last health check, nil if healthy
+	Err  error
+	Time time.Time
+}
+
+// lostAfterFailures is the number of failed health checks in a row after which WDA is lost.
+const lostAfterFailures = 3
+
+// maxReconnectBackoff is the longest delay between the reconnections to a lost device.
+const maxReconnectBackoff = time.Minute
+
+// healthEventsBuffer is the number of events kept for a slow reader,
+// the oldest ones are dropped beyond.
+const healthEventsBuffer = 16
+
+// supervisor checks the health of WDA until the driver is closed.
+type supervisor struct {
+	events chan HealthEvent
+
+	// mu guards cancel and done, which are set by the first start,
+	// and stopped, after which nothing is started
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped bool
+
+	closeOnce sync.Once
+}
+
+func newSupervisor() *supervisor {
+	return &supervisor{events: make(chan HealthEvent, healthEventsBuffer)}
+}
+
+// start checks the health of WDA every interval, nothing happens if interval <= 0,
+// if the checks are already started or if the supervisor is stopped.
+func (s *supervisor) start(wd *remoteWD, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil || s.stopped {
+		return
+	}
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	s.done = make(chan struct{})
+	done := s.done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		state, failures := HealthStateHealthy, 0
+		// while lost, the next reconnection is due at retryAt,
+		// a reconnection is reported once the health check after it passes
+		var retryAt time.Time
+		backoff, reconnected := interval, false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := wd.checkHealth(ctx, interval)
+			if ctx.Err() != nil {
+				return
+			}
+			next := HealthStateHealthy
+			if err != nil {
+				if wd.options.metrics != nil {
+					wd.options.metrics.ObserveKeepAliveFailure(wd.deviceName())
+				}
+				if failures++; failures < lostAfterFailures {
+					next = HealthStateDegraded
+				} else {
+					next = HealthStateLost
+				}
+			} else {
+				failures = 0
+			}
+			if reconnected && err == nil {
+				debugLogf(wd.options.logger, "reconnected to %s", wd.usbCli.serial)
+				if wd.options.metrics != nil {
+					wd.options.metrics.ObserveReconnect(wd.deviceName())
+				}
+			}
+			reconnected = false
+			if next != state {
+				state = next
+				s.publish(HealthEvent{State: state, Err: err, Time: time.Now()})
+			}
+
+			switch {
+			case state != HealthStateLost || wd.usbCli == nil:
+				retryAt, backoff = time.Time{}, interval
+			case !time.Now().Before(retryAt):
+				if errReconnect := wd.reconnectUSB(); errReconnect != nil {
+					debugLogf(wd.options.logger, "reconnect to %s: %v", wd.usbCli.serial, errReconnect)
+				} else {
+					reconnected = true
+				}
+				retryAt = time.Now().Add(backoff)
+				if backoff *= 2; backoff > maxReconnectBackoff {
+					backoff = maxReconnectBackoff
+				}
+			}
+		}
+	}()
+}
+
+// publish sends the event, dropping the oldest one if the buffer is full.
+func (s *supervisor) publish(event HealthEvent) {
+	for {
+		select {
+		case s.events <- event:
+			return
+		default:
+		}
+		select {
+		case <-s.events:
+		default:
+		}
+	}
+}
+
+// stop ends the health checks and closes the events.
+func (s *supervisor) stop() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.stopped = true
+		cancel, done := s.cancel, s.done
+		s.mu.Unlock()
+		if cancel != nil {
+			cancel()
+			<-done
+		}
+		close(s.events)
+	})
+}
+
+// checkHealth returns nil if WDA answers a health check within timeout.
+func (wd *remoteWD) checkHealth(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	healthy, err := wd.withContext(ctx).IsWdaHealthy()
+	if err == nil && !healthy {
+		err = errors.New("WDA is not healthy")
+	}
+	return err
+}
+
+// reconnectUSB connects to the device anew, e.g. after it was unplugged and plugged in again.
+func (wd *remoteWD) reconnectUSB() error {
+	if err := wd.usbCli.reconnect(); err != nil {
+		return err
+	}
+	if wd.mjpegClient != nil {
+		wd.mjpegClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (wd *remoteWD) HealthEvents() <-chan HealthEvent {
+	return wd.supervisor.events
+}
@@ -0,0 +1,217 @@
+package gwda
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func TestHealthEvents(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+	var down, checks int32
+	fake.Handle(http.MethodGet, "/health", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&checks, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("I-AM-ALIVE"))
+	})
+
+	metrics := NewMetrics()
+	driver, err := NewDriverWithOptions(nil, fake.URL, WithKeepAlive(5*time.Millisecond), WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := driver.HealthEvents()
+	next := func() HealthEvent {
+		t.Helper()
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("no health event")
+		}
+		return HealthEvent{}
+	}
+
+	atomic.StoreInt32(&down, 1)
+	if event := next(); event.State != HealthStateDegraded || event.Err == nil {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	if event := next(); event.State != HealthStateLost {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	atomic.StoreInt32(&down, 0)
+	if event := next(); event.State != HealthStateHealthy || event.Err != nil {
+		t.Fatalf("unexpected event %+v", event)
+	}
+
+	if err = driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("events not closed")
+	}
+	stopped := atomic.LoadInt32(&checks)
+	time.Sleep(30 * time.Millisecond)
+	if atomic.LoadInt32(&checks) != stopped {
+		t.Error("the health checks go on after Close")
+	}
+	if err = driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHealthEvents_DropOldest(t *testing.T) {
+	s := newSupervisor()
+	for i := 0; i < healthEventsBuffer+2; i++ {
+		s.publish(HealthEvent{State: HealthState(i % 3)})
+	}
+	s.stop()
+
+	var states []HealthState
+	for event := range s.events {
+		states = append(states, event.State)
+	}
+	if len(states) != healthEventsBuffer || states[0] != HealthState(2%3) {
+		t.Errorf("unexpected events %v", states)
+	}
+}
+
+// roundTripFunc answers the requests without a connection pool,
+// whose locks would hide a data race from the race detector.
+type roundTripFunc func(req *http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+// run with -race: the health checks read the session id the recovery replaces.
+func TestHealthDuringSessionRecovery(t *testing.T) {
+	sessions := 0
+	wd := newRemoteWD()
+	wd.urlPrefix, _ = url.Parse("http://wda")
+	wd.options = newDriverOptions([]DriverOption{WithHTTPClient(&http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		rec := httptest.NewRecorder()
+		if req.URL.Path == "/health" {
+			_, _ = rec.WriteString("I-AM-ALIVE")
+		} else {
+			// only the recovery creates sessions
+			sessions++
+			_, _ = fmt.Fprintf(rec, `{"value":{"sessionId":"session-%d","capabilities":{}}}`, sessions)
+		}
+		return rec.Result()
+	})})})
+	wd.supervisor.start(wd, time.Microsecond)
+	defer wd.supervisor.stop()
+
+	for deadline := time.Now().Add(50 * time.Millisecond); time.Now().Before(deadline); {
+		if err := wd.recoverSession(wd.sessionID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if wd.sessionID() != fmt.Sprintf("session-%d", sessions) {
+		t.Errorf("unexpected session %s", wd.sessionID())
+	}
+}
+
+func TestNewUSBDriver_NoSession(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"value":{"error":"session not created","message":"WDA is starting"}}`))
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	dev := newFakeDevice("00008030-0001", map[int]string{defaultPort: addr, defaultMjpegPort: addr})
+
+	driver, err := NewUSBDriver(nil, dev, WithKeepAlive(time.Millisecond))
+	if err == nil || driver != nil {
+		t.Fatalf("expected no driver, got %v, %v", driver, err)
+	}
+
+	wd := newRemoteWD()
+	wd.options = newDriverOptions([]DriverOption{dev, WithKeepAlive(time.Millisecond)})
+	if err = wd.openUSB(nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	started := func() bool {
+		wd.supervisor.mu.Lock()
+		defer wd.supervisor.mu.Unlock()
+		return wd.supervisor.cancel != nil
+	}
+	if started() {
+		t.Fatal("the health checks are started without a session")
+	}
+	// NewUSBDriver closes the driver, nothing checks its health after
+	_ = wd.Close()
+	if _, ok := <-wd.supervisor.events; ok {
+		t.Fatal("the health events are not closed")
+	}
+	if wd.supervisor.start(wd, time.Millisecond); started() {
+		t.Error("the health checks are started once the driver is closed")
+	}
+}
+
+func TestHealthReconnectUSB(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+	// WDA answers again after the fourth reconnection, as if the device was plugged in again
+	const reconnectsNeeded = 4
+	var reconnects int32
+	fake.Handle(http.MethodGet, "/health", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&reconnects) < reconnectsNeeded {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("I-AM-ALIVE"))
+	})
+	addr := strings.TrimPrefix(fake.URL, "http://")
+	dev := newFakeDevice("00008030-0001", map[int]string{defaultPort: addr, defaultMjpegPort: addr})
+
+	metrics := NewMetrics()
+	driver, err := NewUSBDriver(nil, dev, WithMetrics(metrics), WithKeepAlive(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	wd := driver.(*remoteWD)
+	wd.usbCli.newDevice = func(options ...DeviceOption) (*Device, error) {
+		atomic.AddInt32(&reconnects, 1)
+		found := newFakeDevice("00008030-0001", dev.d.(fakeUsbmuxDevice).addrs)
+		return &found, nil
+	}
+	start := time.Now()
+	wd.supervisor.start(wd, 5*time.Millisecond)
+
+	var states []HealthState
+	for event := range wd.supervisor.events {
+		if states = append(states, event.State); event.State == HealthStateHealthy {
+			break
+		}
+	}
+	if len(states) != 3 || states[1] != HealthStateLost {
+		t.Fatalf("unexpected states %v", states)
+	}
+	// the reconnections back off, 5, 10 and 20ms apart rather than with every health check
+	if elapsed := time.Since(start); elapsed < (lostAfterFailures*5+5+10+20+5)*time.Millisecond {
+		t.Errorf("reconnected %d times within %v", reconnectsNeeded, elapsed)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := atomic.LoadInt32(&reconnects); n != reconnectsNeeded {
+		t.Errorf("reconnected %d times", n)
+	}
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if n := metrics.reconnects["00008030-0001"]; n != 1 {
+		t.Errorf("%d reconnects observed", n)
+	}
+}
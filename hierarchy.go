@@ -0,0 +1,418 @@
+package gwda
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const elementTypePrefix = "XCUIElementType"
+
+// Hierarchy is a snapshot of the UI tree, as returned by Source or AccessibleSource.
+// Once taken it can be queried any number of times without a request to WDA.
+type Hierarchy struct {
+	Root *Node
+}
+
+// Node is an element of the UI tree.
+type Node struct {
+	// Type is the full element type, e.g. "XCUIElementTypeButton"
+	Type  string
+	Name  string
+	Label string
+	Value string
+	Rect  Rect
+
+	Enabled    bool
+	Visible    bool
+	Accessible bool
+
+	// Attributes holds all attributes of the element by their name in the XML source,
+	// including the ones above, e.g. "type", "enabled", "x" or "index"
+	Attributes map[string]string
+
+	Parent   *Node
+	Children []*Node
+}
+
+// ParseHierarchy parses the UI tree in either the XML or JSON format of Source,
+// or the JSON of AccessibleSource.
+func ParseHierarchy(source string) (*Hierarchy, error) {
+	trimmed := strings.TrimSpace(source)
+	switch {
+	case strings.HasPrefix(trimmed, "<"):
+		return ParseXMLHierarchy(trimmed)
+	case strings.HasPrefix(trimmed, "{"):
+		return ParseJSONHierarchy(trimmed)
+	default:
+		return nil, errors.New("hierarchy: unknown source format")
+	}
+}
+
+// ParseXMLHierarchy parses the XML format of Source.
+func ParseXMLHierarchy(source string) (*Hierarchy, error) {
+	decoder := xml.NewDecoder(strings.NewReader(source))
+	var root, current *Node
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("hierarchy: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			attributes := make(map[string]string, len(t.Attr)+1)
+			for _, attr := range t.Attr {
+				attributes[attr.Name.Local] = attr.Value
+			}
+			if attributes["type"] == "" {
+				attributes["type"] = t.Name.Local
+			}
+			n := newNode(attributes)
+			if current == nil {
+				if root != nil {
+					return nil, errors.New("hierarchy: more than one root element")
+				}
+				root = n
+			} else {
+				n.Parent = current
+				current.Children = append(current.Children, n)
+			}
+			current = n
+		case xml.EndElement:
+			if current != nil {
+				current = current.Parent
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("hierarchy: no root element")
+	}
+	return &Hierarchy{Root: root}, nil
+}
+
+// ParseJSONHierarchy parses the JSON format of Source, or the JSON of AccessibleSource.
+// Attribute names are converted to the XML ones, e.g. "isEnabled" becomes "enabled"
+// and the type gets its "XCUIElementType" prefix.
+func ParseJSONHierarchy(source string) (*Hierarchy, error) {
+	decoder := json.NewDecoder(strings.NewReader(source))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("hierarchy: %w", err)
+	}
+	root, err := newNodeFromJSON(raw, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Hierarchy{Root: root}, nil
+}
+
+var jsonAttributeNames = map[string]string{
+	"isEnabled":    "enabled",
+	"isVisible":    "visible",
+	"isAccessible": "accessible",
+	"isSelected":   "selected",
+	"isFocused":    "focused",
+	"isHittable":   "hittable",
+}
+
+func newNodeFromJSON(raw map[string]interface{}, parent *Node) (*Node, error) {
+	attributes := make(map[string]string, len(raw))
+	for k, v := range raw {
+		switch k {
+		case "children", "frame":
+			continue
+		case "rect":
+			rect, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, key := range []string{"x", "y", "width", "height"} {
+				if s := jsonScalarString(rect[key]); s != "" {
+					attributes[key] = s
+				}
+			}
+			continue
+		}
+		if name, ok := jsonAttributeNames[k]; ok {
+			k = name
+		}
+		if v != nil {
+			attributes[k] = jsonScalarString(v)
+		}
+	}
+	if t := attributes["type"]; t != "" && !strings.HasPrefix(t, elementTypePrefix) {
+		attributes["type"] = elementTypePrefix + t
+	}
+
+	n := newNode(attributes)
+	n.Parent = parent
+	if children, ok := raw["children"].([]interface{}); ok {
+		for _, c := range children {
+			child, ok := c.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("hierarchy: unexpected child %T", c)
+			}
+			childNode, err := newNodeFromJSON(child, n)
+			if err != nil {
+				return nil, err
+			}
+			n.Children = append(n.Children, childNode)
+		}
+	}
+	return n, nil
+}
+
+// jsonScalarString formats an attribute value of the JSON source as string.
+func jsonScalarString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// newNode creates a node from its XML attributes,
+// the JSON source reports booleans as "1" and "0" which are converted as well.
+func newNode(attributes map[string]string) *Node {
+	for _, key := range []string{"enabled", "visible", "accessible", "selected", "focused", "hittable"} {
+		switch attributes[key] {
+		case "1":
+			attributes[key] = "true"
+		case "0":
+			attributes[key] = "false"
+		}
+	}
+	n := &Node{
+		Type:       attributes["type"],
+		Name:       attributes["name"],
+		Label:      attributes["label"],
+		Value:      attributes["value"],
+		Enabled:    attributes["enabled"] == "true",
+		Visible:    attributes["visible"] == "true",
+		Accessible: attributes["accessible"] == "true",
+		Attributes: attributes,
+	}
+	n.Rect.X = parseCoordinate(attributes["x"])
+	n.Rect.Y = parseCoordinate(attributes["y"])
+	n.Rect.Width = parseCoordinate(attributes["width"])
+	n.Rect.Height = parseCoordinate(attributes["height"])
+	return n
+}
+
+func parseCoordinate(s string) int {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return int(math.Round(f))
+}
+
+// Walk calls fn for every node in depth-first order, starting with the root.
+// Returning false from fn skips the children of the node.
+func (h *Hierarchy) Walk(fn func(n *Node) bool) {
+	if h.Root != nil {
+		h.Root.Walk(fn)
+	}
+}
+
+// Find returns the first node in depth-first order that match reports true for, or nil.
+func (h *Hierarchy) Find(match func(n *Node) bool) *Node {
+	if h.Root == nil {
+		return nil
+	}
+	return h.Root.Find(match)
+}
+
+// FindAll returns all nodes that match reports true for, in depth-first order.
+func (h *Hierarchy) FindAll(match func(n *Node) bool) []*Node {
+	if h.Root == nil {
+		return nil
+	}
+	return h.Root.FindAll(match)
+}
+
+// FindByName returns the first node with name as its name, or nil.
+func (h *Hierarchy) FindByName(name string) *Node {
+	return h.Find(func(n *Node) bool { return n.Name == name })
+}
+
+// FindByLabel returns the first node with label as its label, or nil.
+func (h *Hierarchy) FindByLabel(label string) *Node {
+	return h.Find(func(n *Node) bool { return n.Label == label })
+}
+
+// FindAllByType returns all nodes of the element type, e.g.
+//
+//	h.FindAllByType(gwda.ElementType{Button: true})
+func (h *Hierarchy) FindAllByType(elemType ElementType) []*Node {
+	t := elemType.String()
+	return h.FindAll(func(n *Node) bool { return n.Type == t })
+}
+
+// String returns the tree in the XML format of Source.
+func (h *Hierarchy) String() string {
+	if h.Root == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	h.Root.writeXML(&buf, 0)
+	return buf.String()
+}
+
+// Walk calls fn for n and all of its descendants in depth-first order.
+// Returning false from fn skips the children of the node.
+func (n *Node) Walk(fn func(n *Node) bool) {
+	if !fn(n) {
+		return
+	}
+	for _, c := range n.Children {
+		c.Walk(fn)
+	}
+}
+
+// Find returns the first node of the subtree that match reports true for, or nil.
+func (n *Node) Find(match func(n *Node) bool) (found *Node) {
+	n.Walk(func(node *Node) bool {
+		if found == nil && match(node) {
+			found = node
+		}
+		return found == nil
+	})
+	return
+}
+
+// FindAll returns all nodes of the subtree that match reports true for.
+func (n *Node) FindAll(match func(n *Node) bool) (nodes []*Node) {
+	n.Walk(func(node *Node) bool {
+		if match(node) {
+			nodes = append(nodes, node)
+		}
+		return true
+	})
+	return
+}
+
+// Attr returns the value of the attribute with the name used in the XML source.
+func (n *Node) Attr(name string) (value string, ok bool) {
+	value, ok = n.Attributes[name]
+	return
+}
+
+// Ancestors returns the parent of n, its parent and so on up to the root.
+func (n *Node) Ancestors() (ancestors []*Node) {
+	for p := n.Parent; p != nil; p = p.Parent {
+		ancestors = append(ancestors, p)
+	}
+	return
+}
+
+// Center returns the center of the element's frame.
+func (n *Node) Center() (x, y float64) {
+	return float64(n.Rect.X) + float64(n.Rect.Width)/2, float64(n.Rect.Y) + float64(n.Rect.Height)/2
+}
+
+// XPath returns an absolute path to n, e.g. "/XCUIElementTypeApplication/XCUIElementTypeWindow[1]".
+func (n *Node) XPath() string {
+	if n.Parent == nil {
+		return "/" + n.Type
+	}
+	var position, count int
+	for _, sibling := range n.Parent.Children {
+		if sibling.Type == n.Type {
+			count++
+		}
+		if sibling == n {
+			position = count
+		}
+	}
+	return fmt.Sprintf("%s/%s[%d]", n.Parent.XPath(), n.Type, position)
+}
+
+// ClassChain returns a class chain query for n relative to the root,
+// e.g. "XCUIElementTypeWindow[1]/XCUIElementTypeButton[2]".
+func (n *Node) ClassChain() string {
+	var segments []string
+	for c := n; c.Parent != nil; c = c.Parent {
+		var position int
+		for _, sibling := range c.Parent.Children {
+			if sibling.Type == c.Type {
+				position++
+			}
+			if sibling == c {
+				break
+			}
+		}
+		segments = append([]string{fmt.Sprintf("%s[%d]", c.Type, position)}, segments...)
+	}
+	return strings.Join(segments, "/")
+}
+
+func (n *Node) String() string {
+	var buf bytes.Buffer
+	n.writeXML(&buf, 0)
+	return buf.String()
+}
+
+func (n *Node) writeXML(buf *bytes.Buffer, depth int) {
+	indent := strings.Repeat("  ", depth)
+	tag := n.Type
+	if tag == "" {
+		tag = elementTypePrefix + "Other"
+	}
+	buf.WriteString(indent + "<" + tag)
+	for _, key := range sortedKeys(n.Attributes) {
+		buf.WriteString(" " + key + `="`)
+		_ = xml.EscapeText(buf, []byte(n.Attributes[key]))
+		buf.WriteString(`"`)
+	}
+	if len(n.Children) == 0 {
+		buf.WriteString("/>\n")
+		return
+	}
+	buf.WriteString(">\n")
+	for _, c := range n.Children {
+		c.writeXML(buf, depth+1)
+	}
+	buf.WriteString(indent + "</" + tag + ">\n")
+}
+
+// sortedKeys returns the attribute names in the order of the XML source, unknown ones last.
+func sortedKeys(attributes map[string]string) []string {
+	order := []string{"type", "value", "name", "label", "enabled", "visible", "accessible", "x", "y", "width", "height", "index"}
+	keys := make([]string, 0, len(attributes))
+	known := make(map[string]bool, len(order))
+	for _, key := range order {
+		known[key] = true
+		if _, ok := attributes[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	var rest []string
+	for key := range attributes {
+		if !known[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
@@ -0,0 +1,118 @@
+package gwda
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testXMLSource = `<?xml version="1.0" encoding="UTF-8"?>
+<XCUIElementTypeApplication type="XCUIElementTypeApplication" name="Settings" label="Settings" enabled="true" visible="true" accessible="false" x="0" y="0" width="390" height="844" index="0">
+  <XCUIElementTypeWindow type="XCUIElementTypeWindow" enabled="true" visible="true" accessible="false" x="0" y="0" width="390" height="844" index="0">
+    <XCUIElementTypeButton type="XCUIElementTypeButton" name="General" label="General" enabled="true" visible="true" accessible="true" x="16" y="100" width="358" height="44" index="0"/>
+    <XCUIElementTypeButton type="XCUIElementTypeButton" name="Privacy" label="Privacy &amp; Security" enabled="false" visible="true" accessible="true" x="16" y="144.5" width="358" height="44" index="1"/>
+    <XCUIElementTypeSwitch type="XCUIElementTypeSwitch" value="1" name="Airplane Mode" label="Airplane Mode" enabled="true" visible="false" accessible="true" x="16" y="900" width="358" height="44" index="2"/>
+  </XCUIElementTypeWindow>
+</XCUIElementTypeApplication>`
+
+const testJSONSource = `{
+  "isEnabled": "1", "isVisible": "1", "isAccessible": "0", "frame": "{{0, 0}, {390, 844}}",
+  "rect": {"x": 0, "y": 0, "width": 390, "height": 844},
+  "type": "Application", "name": "Settings", "label": "Settings", "value": null, "rawIdentifier": null,
+  "children": [{
+    "isEnabled": "1", "isVisible": "1", "isAccessible": "0",
+    "rect": {"x": 0, "y": 0, "width": 390, "height": 844},
+    "type": "Window", "name": null, "label": null, "value": null,
+    "children": [
+      {"isEnabled": "1", "isVisible": "1", "isAccessible": "1", "rect": {"x": 16, "y": 100, "width": 358, "height": 44}, "type": "Button", "name": "General", "label": "General", "value": null},
+      {"isEnabled": "0", "isVisible": "1", "isAccessible": "1", "rect": {"x": 16, "y": 144.5, "width": 358, "height": 44}, "type": "Button", "name": "Privacy", "label": "Privacy & Security", "value": null},
+      {"isEnabled": "1", "isVisible": "0", "isAccessible": "1", "rect": {"x": 16, "y": 900, "width": 358, "height": 44}, "type": "Switch", "name": "Airplane Mode", "label": "Airplane Mode", "value": 1}
+    ]
+  }]
+}`
+
+func checkTestHierarchy(t *testing.T, h *Hierarchy) {
+	t.Helper()
+	if h.Root.Type != "XCUIElementTypeApplication" || h.Root.Name != "Settings" || h.Root.Parent != nil {
+		t.Fatalf("unexpected root %+v", h.Root)
+	}
+
+	buttons := h.FindAllByType(ElementType{Button: true})
+	if len(buttons) != 2 {
+		t.Fatalf("got %d buttons, want 2", len(buttons))
+	}
+	privacy := h.FindByName("Privacy")
+	if privacy != buttons[1] || privacy.Label != "Privacy & Security" || privacy.Enabled || !privacy.Visible || !privacy.Accessible {
+		t.Fatalf("unexpected node %+v", privacy)
+	}
+	if want := (Rect{Point{16, 145}, Size{358, 44}}); privacy.Rect != want {
+		t.Fatalf("got rect %+v, want %+v", privacy.Rect, want)
+	}
+	if v, _ := privacy.Attr("enabled"); v != "false" {
+		t.Fatalf("got enabled attribute %q", v)
+	}
+	if ancestors := privacy.Ancestors(); len(ancestors) != 2 || ancestors[1] != h.Root {
+		t.Fatalf("unexpected ancestors %v", ancestors)
+	}
+	if path := privacy.XPath(); path != "/XCUIElementTypeApplication/XCUIElementTypeWindow[1]/XCUIElementTypeButton[2]" {
+		t.Fatalf("got path %s", path)
+	}
+
+	airplane := h.FindByLabel("Airplane Mode")
+	if airplane == nil || airplane.Value != "1" || airplane.Visible {
+		t.Fatalf("unexpected node %+v", airplane)
+	}
+
+	var visited int
+	h.Walk(func(n *Node) bool {
+		visited++
+		return n.Type != "XCUIElementTypeWindow"
+	})
+	if visited != 2 {
+		t.Fatalf("visited %d nodes, want 2", visited)
+	}
+}
+
+func TestParseHierarchy(t *testing.T) {
+	for name, source := range map[string]string{"xml": testXMLSource, "json": testJSONSource} {
+		t.Run(name, func(t *testing.T) {
+			h, err := ParseHierarchy(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkTestHierarchy(t, h)
+
+			// the XML written by String is parsed to the same tree
+			if h, err = ParseHierarchy(h.String()); err != nil {
+				t.Fatal(err)
+			}
+			checkTestHierarchy(t, h)
+		})
+	}
+
+	if _, err := ParseHierarchy("Application, 0x600, {{0, 0}, {390, 844}}"); err == nil {
+		t.Fatal("expected an error for the description format")
+	}
+}
+
+func Test_remoteWD_Hierarchy(t *testing.T) {
+	wd := newTestDriver(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/session/test-session/source" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("format") == "json" {
+			_, _ = w.Write([]byte(`{"value":` + testJSONSource + `}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"value":"` + strings.NewReplacer(`"`, `\"`, "\n", `\n`).Replace(testXMLSource) + `"}`))
+	}))
+
+	for _, srcOpt := range []SourceOption{NewSourceOption(), NewSourceOption().WithFormatAsJson()} {
+		h, err := wd.Hierarchy(srcOpt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkTestHierarchy(t, h)
+	}
+}
@@ -0,0 +1,376 @@
+package gwda
+
+import (
+	"errors"
+	"image"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	// screenshots are PNG, or JPEG when taken by uusense
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+const defaultImageMatchThreshold = 0.9
+
+// coarse search runs on templates downsampled to about this size
+const imageMatchCoarseSize = 16
+
+// number of coarse matches refined even if they are far below the threshold
+const imageMatchMinCandidates = 64
+
+// ImageMatch is an area of the screen similar to a template image.
+type ImageMatch struct {
+	// Rect is in points when found by a WebDriver, in pixels when found by MatchTemplate.
+	Rect Rect
+	// Confidence is the normalized cross-correlation of the area and the template, 1 is a perfect match.
+	Confidence float64
+	// Scale is the factor the template was resized by for this match.
+	Scale float64
+}
+
+// Center returns the center of the matched area.
+func (m ImageMatch) Center() (x, y float64) {
+	return float64(m.Rect.X) + float64(m.Rect.Width)/2, float64(m.Rect.Y) + float64(m.Rect.Height)/2
+}
+
+type ImageMatchOption struct {
+	threshold  float64
+	scales     []float64
+	maxResults int
+	uusense    bool
+}
+
+func NewImageMatchOption() ImageMatchOption {
+	return ImageMatchOption{threshold: defaultImageMatchThreshold}
+}
+
+// WithThreshold minimum confidence of a match, between 0 and 1, defaults to 0.9
+func (opt ImageMatchOption) WithThreshold(threshold float64) ImageMatchOption {
+	opt.threshold = threshold
+	return opt
+}
+
+// WithScales also searches for the template resized by each of the factors,
+// e.g. when it was cut from a screenshot of a device with another resolution
+func (opt ImageMatchOption) WithScales(scales ...float64) ImageMatchOption {
+	opt.scales = append([]float64(nil), scales...)
+	return opt
+}
+
+// WithMaxResults limits the number of matches, the best ones are kept
+func (opt ImageMatchOption) WithMaxResults(n int) ImageMatchOption {
+	opt.maxResults = n
+	return opt
+}
+
+// WithScreenshotUUSense searches the output of ScreenshotUUSense instead of Screenshot
+func (opt ImageMatchOption) WithScreenshotUUSense() ImageMatchOption {
+	opt.uusense = true
+	return opt
+}
+
+// MatchTemplate searches screen for areas similar to template,
+// and returns them in pixels of screen ordered by confidence.
+func MatchTemplate(screen, template image.Image, matchOpt ...ImageMatchOption) ([]ImageMatch, error) {
+	opt := NewImageMatchOption()
+	if len(matchOpt) != 0 {
+		opt = matchOpt[0]
+	}
+	scales := opt.scales
+	if len(scales) == 0 {
+		scales = []float64{1}
+	}
+
+	src := newGrayImage(screen)
+	tmpl := newGrayImage(template)
+	if tmpl.w == 0 || tmpl.h == 0 {
+		return nil, errors.New("image match: empty template")
+	}
+
+	var matches []ImageMatch
+	for _, scale := range scales {
+		if scale <= 0 {
+			return nil, errors.New("image match: invalid scale")
+		}
+		t := tmpl
+		if scale != 1 {
+			t = tmpl.resize(int(math.Round(float64(tmpl.w)*scale)), int(math.Round(float64(tmpl.h)*scale)))
+		}
+		if t.w == 0 || t.h == 0 || t.w > src.w || t.h > src.h {
+			continue
+		}
+		for _, m := range matchGray(src, t, opt.threshold) {
+			m.Scale = scale
+			matches = append(matches, m)
+		}
+	}
+
+	matches = suppressOverlaps(matches)
+	if opt.maxResults > 0 && len(matches) > opt.maxResults {
+		matches = matches[:opt.maxResults]
+	}
+	return matches, nil
+}
+
+// matchGray finds the areas of src matching t, first on downsampled images,
+// then the candidates are refined on the original ones.
+func matchGray(src, t *grayImage, threshold float64) []ImageMatch {
+	side := t.w
+	if t.h < side {
+		side = t.h
+	}
+	if side < 2*imageMatchCoarseSize {
+		return suppressOverlaps(src.correlate(t, threshold))
+	}
+
+	factor := side / imageMatchCoarseSize
+	coarseSrc := src.resize(src.w/factor, src.h/factor)
+	coarseT := t.resize(t.w/factor, t.h/factor)
+
+	// downsampling blurs both images and misaligns their pixel grids, which costs some correlation,
+	// so besides all peaks close to the threshold the best ones are refined in any case
+	peaks := coarseSrc.correlate(coarseT, 0)
+	sortMatches(peaks)
+	var candidates []ImageMatch
+	for _, p := range peaks {
+		if len(candidates) >= imageMatchMinCandidates && p.Confidence < threshold-0.25 {
+			break
+		}
+		if !overlapsAny(p, candidates) {
+			candidates = append(candidates, p)
+		}
+	}
+
+	srcIntegral, tt := src.integral(), t.template()
+	var matches []ImageMatch
+	for _, c := range candidates {
+		best := ImageMatch{Confidence: -1}
+		x0, y0 := c.Rect.X*factor, c.Rect.Y*factor
+		for y := y0 - factor; y <= y0+factor; y++ {
+			for x := x0 - factor; x <= x0+factor; x++ {
+				if x < 0 || y < 0 || x+t.w > src.w || y+t.h > src.h {
+					continue
+				}
+				if score := src.ncc(srcIntegral, tt, x, y); score > best.Confidence {
+					best = ImageMatch{Rect: Rect{Point{x, y}, Size{t.w, t.h}}, Confidence: score}
+				}
+			}
+		}
+		if best.Confidence >= threshold {
+			matches = append(matches, best)
+		}
+	}
+	return matches
+}
+
+// suppressOverlaps sorts matches by confidence and drops those overlapping a better one.
+func suppressOverlaps(matches []ImageMatch) []ImageMatch {
+	sortMatches(matches)
+	kept := matches[:0]
+	for _, m := range matches {
+		if !overlapsAny(m, kept) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+func sortMatches(matches []ImageMatch) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Confidence > matches[j].Confidence
+	})
+}
+
+func overlapsAny(m ImageMatch, others []ImageMatch) bool {
+	for _, o := range others {
+		if overlapRatio(m.Rect, o.Rect) > 0.3 {
+			return true
+		}
+	}
+	return false
+}
+
+// overlapRatio is the intersection over union of a and b.
+func overlapRatio(a, b Rect) float64 {
+	ra := image.Rect(a.X, a.Y, a.X+a.Width, a.Y+a.Height)
+	rb := image.Rect(b.X, b.Y, b.X+b.Width, b.Y+b.Height)
+	inter := ra.Intersect(rb)
+	if inter.Empty() {
+		return 0
+	}
+	i := float64(inter.Dx() * inter.Dy())
+	return i / (float64(ra.Dx()*ra.Dy()+rb.Dx()*rb.Dy()) - i)
+}
+
+// grayImage holds the luminance of an image.
+type grayImage struct {
+	w, h int
+	pix  []float64
+}
+
+func newGrayImage(img image.Image) *grayImage {
+	b := img.Bounds()
+	g := &grayImage{w: b.Dx(), h: b.Dy(), pix: make([]float64, b.Dx()*b.Dy())}
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			r, gr, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			g.pix[y*g.w+x] = (0.299*float64(r) + 0.587*float64(gr) + 0.114*float64(bl)) / 257
+		}
+	}
+	return g
+}
+
+// resize scales the image to w x h by averaging the covered pixels.
+func (g *grayImage) resize(w, h int) *grayImage {
+	if w <= 0 || h <= 0 {
+		return &grayImage{}
+	}
+	out := &grayImage{w: w, h: h, pix: make([]float64, w*h)}
+	for y := 0; y < h; y++ {
+		sy0, sy1 := y*g.h/h, (y+1)*g.h/h
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < w; x++ {
+			sx0, sx1 := x*g.w/w, (x+1)*g.w/w
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+			var sum float64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					sum += g.pix[sy*g.w+sx]
+				}
+			}
+			out.pix[y*w+x] = sum / float64((sy1-sy0)*(sx1-sx0))
+		}
+	}
+	return out
+}
+
+// integralImage holds the sums of the pixels and their squares above and left of each position.
+type integralImage struct {
+	w          int
+	sum, sqSum []float64
+}
+
+func (g *grayImage) integral() *integralImage {
+	w := g.w + 1
+	ii := &integralImage{w: w, sum: make([]float64, w*(g.h+1)), sqSum: make([]float64, w*(g.h+1))}
+	for y := 0; y < g.h; y++ {
+		var rowSum, rowSqSum float64
+		for x := 0; x < g.w; x++ {
+			v := g.pix[y*g.w+x]
+			rowSum += v
+			rowSqSum += v * v
+			ii.sum[(y+1)*w+x+1] = ii.sum[y*w+x+1] + rowSum
+			ii.sqSum[(y+1)*w+x+1] = ii.sqSum[y*w+x+1] + rowSqSum
+		}
+	}
+	return ii
+}
+
+func (ii *integralImage) area(table []float64, x, y, w, h int) float64 {
+	return table[(y+h)*ii.w+x+w] - table[y*ii.w+x+w] - table[(y+h)*ii.w+x] + table[y*ii.w+x]
+}
+
+// grayTemplate is a template prepared for the correlation.
+type grayTemplate struct {
+	w, h int
+	// pix are the pixels minus their mean
+	pix         []float64
+	mean, sqSum float64
+}
+
+func (g *grayImage) template() *grayTemplate {
+	t := &grayTemplate{w: g.w, h: g.h, pix: make([]float64, len(g.pix))}
+	for _, v := range g.pix {
+		t.mean += v
+	}
+	t.mean /= float64(len(g.pix))
+	for i, v := range g.pix {
+		t.pix[i] = v - t.mean
+		t.sqSum += t.pix[i] * t.pix[i]
+	}
+	return t
+}
+
+// ncc is the normalized cross-correlation of t and the area of g at x, y.
+func (g *grayImage) ncc(ii *integralImage, t *grayTemplate, x, y int) float64 {
+	n := float64(t.w * t.h)
+	sum := ii.area(ii.sum, x, y, t.w, t.h)
+	variance := ii.area(ii.sqSum, x, y, t.w, t.h) - sum*sum/n
+	flat := variance < 1e-6*n
+	if t.sqSum < 1e-6*n {
+		// a flat template matches flat areas of the same brightness
+		if flat && math.Abs(sum/n-t.mean) < 1 {
+			return 1
+		}
+		return 0
+	}
+	if flat {
+		return 0
+	}
+	var cross float64
+	for ty := 0; ty < t.h; ty++ {
+		row := g.pix[(y+ty)*g.w+x : (y+ty)*g.w+x+t.w]
+		tRow := t.pix[ty*t.w : (ty+1)*t.w]
+		for tx, v := range row {
+			cross += v * tRow[tx]
+		}
+	}
+	return cross / math.Sqrt(variance*t.sqSum)
+}
+
+// correlate returns every position where the correlation with t reaches threshold
+// and is not exceeded by a direct neighbour.
+func (g *grayImage) correlate(t *grayImage, threshold float64) []ImageMatch {
+	if t.w == 0 || t.h == 0 || t.w > g.w || t.h > g.h {
+		return nil
+	}
+	ii := g.integral()
+	tt := t.template()
+	cols, rows := g.w-t.w+1, g.h-t.h+1
+	scores := make([]float64, cols*rows)
+	// rows are scored concurrently, every worker takes each n-th row
+	var wg sync.WaitGroup
+	n := runtime.GOMAXPROCS(0)
+	for worker := 0; worker < n; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for y := worker; y < rows; y += n {
+				for x := 0; x < cols; x++ {
+					scores[y*cols+x] = g.ncc(ii, tt, x, y)
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	var matches []ImageMatch
+	for y := 0; y < rows; y++ {
+		for x := 0; x < cols; x++ {
+			score := scores[y*cols+x]
+			if score < threshold {
+				continue
+			}
+			isPeak := true
+			for ny := y - 1; ny <= y+1 && isPeak; ny++ {
+				for nx := x - 1; nx <= x+1; nx++ {
+					if nx >= 0 && ny >= 0 && nx < cols && ny < rows && scores[ny*cols+nx] > score {
+						isPeak = false
+						break
+					}
+				}
+			}
+			if isPeak {
+				matches = append(matches, ImageMatch{Rect: Rect{Point{x, y}, Size{t.w, t.h}}, Confidence: score})
+			}
+		}
+	}
+	return matches
+}
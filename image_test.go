@@ -0,0 +1,172 @@
+package gwda
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newNoiseImage(w, h int, seed int64) *image.RGBA {
+	rnd := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(rnd.Intn(256)), G: uint8(rnd.Intn(256)), B: uint8(rnd.Intn(256)), A: 255})
+		}
+	}
+	return img
+}
+
+// upscale enlarges img by an integer factor using the nearest pixel.
+func upscale(img image.Image, factor int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()*factor, b.Dy()*factor))
+	for y := 0; y < out.Bounds().Dy(); y++ {
+		for x := 0; x < out.Bounds().Dx(); x++ {
+			out.Set(x, y, img.At(b.Min.X+x/factor, b.Min.Y+y/factor))
+		}
+	}
+	return out
+}
+
+func TestMatchTemplate(t *testing.T) {
+	screen := newNoiseImage(400, 300, 1)
+	small := newNoiseImage(20, 20, 2)
+	large := newNoiseImage(60, 40, 3)
+	draw.Draw(screen, image.Rect(30, 200, 50, 220), small, image.Point{}, draw.Src)
+	draw.Draw(screen, image.Rect(123, 77, 183, 117), large, image.Point{}, draw.Src)
+	draw.Draw(screen, image.Rect(250, 150, 290, 190), upscale(small, 2), image.Point{}, draw.Src)
+
+	matches, err := MatchTemplate(screen, large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Rect{Point{123, 77}, Size{60, 40}}
+	if len(matches) != 1 || matches[0].Rect != want || matches[0].Confidence < 0.99 {
+		t.Fatalf("got %+v, want %+v", matches, want)
+	}
+
+	matches, err = MatchTemplate(screen, small, NewImageMatchOption().WithScales(1, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("got %d matches, want 2: %+v", len(matches), matches)
+	}
+	for _, m := range matches {
+		switch m.Scale {
+		case 1:
+			want = Rect{Point{30, 200}, Size{20, 20}}
+		case 2:
+			want = Rect{Point{250, 150}, Size{40, 40}}
+		}
+		if m.Rect != want {
+			t.Fatalf("scale %v: got %+v, want %+v", m.Scale, m.Rect, want)
+		}
+	}
+
+	if matches, err = MatchTemplate(screen, newNoiseImage(30, 30, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Fatalf("expected no match, got %+v", matches)
+	}
+}
+
+func Test_remoteWD_FindImage(t *testing.T) {
+	screen := newNoiseImage(300, 400, 5)
+	button := newNoiseImage(50, 36, 6)
+	draw.Draw(screen, image.Rect(100, 200, 150, 236), button, image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, screen); err != nil {
+		t.Fatal(err)
+	}
+
+	var tapped map[string]float64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/session/test-session/screenshot", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"value": base64.StdEncoding.EncodeToString(buf.Bytes())})
+	})
+	mux.HandleFunc("/session/test-session/wda/screen", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"value":{"scale":2,"statusBarSize":{"width":150,"height":20}}}`))
+	})
+	mux.HandleFunc("/session/test-session/wda/tap/0", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&tapped)
+		_, _ = w.Write([]byte(`{"value":null}`))
+	})
+	wd := newTestDriver(t, mux)
+	var commands []string
+	wd.options = newDriverOptions([]DriverOption{WithMiddleware(func(next CommandHandler) CommandHandler {
+		return func(cmd *Command) ([]byte, error) {
+			commands = append(commands, cmd.Name)
+			return next(cmd)
+		}
+	})})
+
+	match, err := wd.FindImage(button)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Rect{Point{50, 100}, Size{25, 18}}); match.Rect != want {
+		t.Fatalf("got %+v, want %+v in points", match.Rect, want)
+	}
+
+	commands = nil
+	if err = wd.TapImage(button); err != nil {
+		t.Fatal(err)
+	}
+	if tapped["x"] != 62.5 || tapped["y"] != 109 {
+		t.Fatalf("tapped at %v", tapped)
+	}
+	// the screenshot is named after Screenshot and the tap after TapImage
+	if got := strings.Join(commands, ","); got != "Screenshot,Scale,TapImage" {
+		t.Errorf("commands %s", got)
+	}
+
+	if _, err = wd.FindImage(newNoiseImage(20, 20, 7)); err != ErrImageNotFound {
+		t.Fatalf("got %v, want %v", err, ErrImageNotFound)
+	}
+	if _, err = wd.WaitForImage(newNoiseImage(20, 20, 7), 50*time.Millisecond); !errors.Is(err, ErrImageNotFound) {
+		t.Fatalf("got %v, want %v", err, ErrImageNotFound)
+	}
+}
+
+func Test_remoteWD_WaitForImage(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, newNoiseImage(40, 40, 5)); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/session/test-session/screenshot", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"value": base64.StdEncoding.EncodeToString(buf.Bytes())})
+	})
+	mux.HandleFunc("/session/test-session/wda/screen", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"value":{"scale":2,"statusBarSize":{"width":150,"height":20}}}`))
+	})
+	wd := newTestDriver(t, mux)
+	count := map[string]int{}
+	wd.options = newDriverOptions([]DriverOption{WithWaitInterval(10 * time.Millisecond), WithMiddleware(func(next CommandHandler) CommandHandler {
+		return func(cmd *Command) ([]byte, error) {
+			count[cmd.Name]++
+			return next(cmd)
+		}
+	})})
+
+	if _, err := wd.WaitForImage(newNoiseImage(10, 10, 7), 200*time.Millisecond); !errors.Is(err, ErrImageNotFound) {
+		t.Fatalf("got %v, want %v", err, ErrImageNotFound)
+	}
+	// the scale of the screen is only requested by the first poll
+	if count["Screenshot"] < 2 || count["Scale"] != 1 {
+		t.Errorf("commands %v", count)
+	}
+}
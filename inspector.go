@@ -0,0 +1,214 @@
+package gwda
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//go:embed inspector.html
+var inspectorPage []byte
+
+// Inspector serves a web page showing the latest screenshot next to the UI tree of the device:
+// the element under the cursor is highlighted with all its attributes and BySelector values
+// ready to copy, and clicking the screenshot taps the device. The page loads nothing from
+// the internet, so it works offline.
+//
+//	driver, _ := gwda.NewUSBDriver(nil)
+//	_ = http.ListenAndServe("localhost:8200", gwda.NewInspector(driver))
+//
+// Besides the page, the inspector serves GET "/screenshot", GET "/tree" with the UI tree as JSON,
+// and POST "/tap" taking the coordinate as {"x": 10, "y": 20}.
+type Inspector struct {
+	driver WebDriver
+}
+
+// NewInspector creates an inspector of the device of driver.
+func NewInspector(driver WebDriver) *Inspector {
+	return &Inspector{driver: driver}
+}
+
+// InspectorNode is an element of the UI tree served by an Inspector.
+type InspectorNode struct {
+	Type       string              `json:"type"`
+	Name       string              `json:"name,omitempty"`
+	Label      string              `json:"label,omitempty"`
+	Value      string              `json:"value,omitempty"`
+	Rect       Rect                `json:"rect"`
+	Enabled    bool                `json:"enabled"`
+	Visible    bool                `json:"visible"`
+	Attributes map[string]string   `json:"attributes"`
+	Selectors  []InspectorSelector `json:"selectors"`
+	Children   []*InspectorNode    `json:"children,omitempty"`
+}
+
+// InspectorSelector is a way to find an element, as Go code.
+type InspectorSelector struct {
+	// Using is the strategy, e.g. "accessibility id" or "xpath"
+	Using string `json:"using"`
+	// Code is the BySelector literal, e.g. `gwda.BySelector{AccessibilityId: "OK"}`
+	Code string `json:"code"`
+	// Matches is the number of elements of the tree the selector finds
+	Matches int `json:"matches"`
+}
+
+func (in *Inspector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method + " " + r.URL.Path {
+	case "GET /", "GET /index.html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(inspectorPage)
+	case "GET /screenshot":
+		raw, err := in.driver.WithContext(r.Context()).Screenshot()
+		if err != nil {
+			writeProxyError(w, http.StatusBadGateway, "unknown error", err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", http.DetectContentType(raw.Bytes()))
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = raw.WriteTo(w)
+	case "GET /tree":
+		tree, err := in.tree(in.driver.WithContext(r.Context()))
+		if err != nil {
+			writeProxyError(w, http.StatusBadGateway, "unknown error", err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(tree)
+	case "POST /tap":
+		// other pages open in the browser must not tap the device: they can only post JSON
+		// after a preflight the inspector does not answer, and their origin differs
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			writeProxyError(w, http.StatusUnsupportedMediaType, "invalid argument", "expected Content-Type application/json")
+			return
+		}
+		if !sameOrigin(r) {
+			writeProxyError(w, http.StatusForbidden, "invalid argument", "cross origin request from "+r.Header.Get("Origin"))
+			return
+		}
+		var point struct{ X, Y *float64 }
+		if err := json.NewDecoder(r.Body).Decode(&point); err != nil || point.X == nil || point.Y == nil {
+			writeProxyError(w, http.StatusBadRequest, "invalid argument", `expected {"x": <number>, "y": <number>}`)
+			return
+		}
+		if err := in.driver.WithContext(r.Context()).TapFloat(*point.X, *point.Y); err != nil {
+			writeProxyError(w, http.StatusBadGateway, "unknown error", err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		_, _ = w.Write([]byte(`{"value":null}`))
+	default:
+		writeProxyError(w, http.StatusNotFound, "unknown command", "Unhandled endpoint: "+r.Method+" "+r.URL.Path)
+	}
+}
+
+// sameOrigin reports whether the request comes from the inspector page itself, or not from a browser.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// tree returns the UI tree with the window size in points, the scale between the screenshot and the tree.
+func (in *Inspector) tree(driver WebDriver) (interface{}, error) {
+	h, err := driver.Hierarchy()
+	if err != nil {
+		return nil, err
+	}
+	size, err := driver.WindowSize()
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Size Size           `json:"size"`
+		Root *InspectorNode `json:"root"`
+	}{size, newInspectorNode(h, h.Root)}, nil
+}
+
+func newInspectorNode(h *Hierarchy, n *Node) *InspectorNode {
+	node := &InspectorNode{
+		Type:       strings.TrimPrefix(n.Type, elementTypePrefix),
+		Name:       n.Name,
+		Label:      n.Label,
+		Value:      n.Value,
+		Rect:       n.Rect,
+		Enabled:    n.Enabled,
+		Visible:    n.Visible,
+		Attributes: n.Attributes,
+		Selectors:  inspectorSelectors(h, n),
+	}
+	for _, c := range n.Children {
+		node.Children = append(node.Children, newInspectorNode(h, c))
+	}
+	return node
+}
+
+// inspectorSelectors returns the selectors of n, the ones by identifier first.
+func inspectorSelectors(h *Hierarchy, n *Node) (selectors []InspectorSelector) {
+	add := func(using, field, value string, matches int) {
+		selectors = append(selectors, InspectorSelector{
+			Using:   using,
+			Code:    fmt.Sprintf("gwda.BySelector{%s: %s}", field, strconv.Quote(value)),
+			Matches: matches,
+		})
+	}
+
+	if n.Name != "" {
+		add("accessibility id", "AccessibilityId", n.Name, len(h.FindAll(func(c *Node) bool { return c.Name == n.Name })))
+	}
+
+	conditions := []string{"type == " + predicateQuote(n.Type)}
+	switch {
+	case n.Name != "":
+		conditions = append(conditions, "name == "+predicateQuote(n.Name))
+	case n.Label != "":
+		conditions = append(conditions, "label == "+predicateQuote(n.Label))
+	case n.Value != "":
+		conditions = append(conditions, "value == "+predicateQuote(n.Value))
+	}
+	predicate := strings.Join(conditions, " AND ")
+	if pr, err := CompilePredicate(predicate); err == nil {
+		add("predicate string", "Predicate", predicate, len(pr.Select(h)))
+	}
+
+	if n.Parent != nil {
+		add("class chain", "ClassChain", n.ClassChain(), 1)
+	}
+
+	xpath := n.XPath()
+	if n.Name != "" {
+		xpath = fmt.Sprintf("//%s[@name=%s]", n.Type, xpathQuote(n.Name))
+	}
+	if nodes, err := h.Select(xpath); err == nil {
+		add("xpath", "XPath", xpath, len(nodes))
+	}
+	return selectors
+}
+
+// predicateQuote returns s as a string literal of the NSPredicate format.
+func predicateQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// xpathQuote returns s as a string literal of XPath, which has no escapes.
+func xpathQuote(s string) string {
+	if !strings.Contains(s, `"`) {
+		return `"` + s + `"`
+	}
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	parts := strings.Split(s, `"`)
+	for i := range parts {
+		parts[i] = `"` + parts[i] + `"`
+	}
+	return "concat(" + strings.Join(parts, `, '"', `) + ")"
+}
@@ -0,0 +1,150 @@
+package gwda
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func TestInspector(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+	var tapped bool
+	fake.SetUI(&wdatest.Element{Type: "Application", Name: "Settings", Width: 390, Height: 844, Children: []*wdatest.Element{
+		{Type: "Button", Name: "OK", X: 10, Y: 20, Width: 60, Height: 44, OnClick: func() { tapped = true }},
+		{Type: "Cell", Label: `Say "hi"`, Y: 100, Width: 390, Height: 44},
+		{Type: "Cell", Label: `Say "hi"`, Y: 144, Width: 390, Height: 44},
+	}})
+	driver, err := NewDriver(nil, fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewInspector(driver))
+	defer srv.Close()
+
+	get := func(path string) (*http.Response, []byte) {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	resp, page := get("/")
+	if resp.StatusCode != http.StatusOK || !bytes.Contains(page, []byte("<title>gwda inspector</title>")) {
+		t.Fatalf("unexpected page %d", resp.StatusCode)
+	}
+	if bytes.Contains(page, []byte("http://")) || bytes.Contains(page, []byte("https://")) {
+		t.Error("the page loads resources from the internet")
+	}
+
+	if resp, shot := get("/screenshot"); resp.Header.Get("Content-Type") != "image/png" || len(shot) == 0 {
+		t.Errorf("unexpected screenshot %s", resp.Header.Get("Content-Type"))
+	}
+
+	_, body := get("/tree")
+	var tree struct {
+		Size Size
+		Root *InspectorNode
+	}
+	if err = json.Unmarshal(body, &tree); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Size.Width != 390 || tree.Root.Type != "Application" || len(tree.Root.Children) != 3 {
+		t.Fatalf("unexpected tree %s", body)
+	}
+	selectors := func(n *InspectorNode) map[string]InspectorSelector {
+		bySelector := make(map[string]InspectorSelector)
+		for _, s := range n.Selectors {
+			bySelector[s.Using] = s
+		}
+		return bySelector
+	}
+	button := selectors(tree.Root.Children[0])
+	for using, want := range map[string]string{
+		"accessibility id": `gwda.BySelector{AccessibilityId: "OK"}`,
+		"predicate string": `gwda.BySelector{Predicate: "type == 'XCUIElementTypeButton' AND name == 'OK'"}`,
+		"class chain":      `gwda.BySelector{ClassChain: "XCUIElementTypeButton[1]"}`,
+		"xpath":            `gwda.BySelector{XPath: "//XCUIElementTypeButton[@name=\"OK\"]"}`,
+	} {
+		if got := button[using]; got.Code != want || got.Matches != 1 {
+			t.Errorf("%s: got %+v, want %s", using, got, want)
+		}
+	}
+	cell := selectors(tree.Root.Children[2])
+	if got := cell["predicate string"]; got.Matches != 2 || !strings.Contains(got.Code, `label == 'Say \"hi\"'`) {
+		t.Errorf("unexpected predicate %+v", got)
+	}
+	if got := cell["xpath"]; got.Matches != 1 || got.Code != `gwda.BySelector{XPath: "/XCUIElementTypeApplication/XCUIElementTypeCell[2]"}` {
+		t.Errorf("unexpected xpath %+v", got)
+	}
+	if _, ok := cell["accessibility id"]; ok {
+		t.Error("an accessibility id for an element without name")
+	}
+
+	resp, err = http.Post(srv.URL+"/tap", "application/json", strings.NewReader(`{"x": 40, "y": 42}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !tapped {
+		t.Errorf("not tapped: %d", resp.StatusCode)
+	}
+	resp, err = http.Post(srv.URL+"/tap", "application/json", strings.NewReader(`{"x": 40}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	// other pages can neither post a simple request nor JSON from their origin
+	tapped = false
+	for _, tc := range []struct {
+		contentType, origin string
+		status              int
+	}{
+		{"text/plain", "", http.StatusUnsupportedMediaType},
+		{"text/plain", "https://example.com", http.StatusUnsupportedMediaType},
+		{"application/json", "https://example.com", http.StatusForbidden},
+		{"application/json; charset=utf-8", srv.URL, http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/tap", strings.NewReader(`{"x": 40, "y": 42}`))
+		req.Header.Set("Content-Type", tc.contentType)
+		if tc.origin != "" {
+			req.Header.Set("Origin", tc.origin)
+		}
+		if resp, err = http.DefaultClient.Do(req); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status || tapped != (tc.status == http.StatusOK) {
+			t.Errorf("%s from %q: status %d, tapped %v", tc.contentType, tc.origin, resp.StatusCode, tapped)
+		}
+	}
+	if resp, _ := get("/unknown"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unexpected status %d", resp.StatusCode)
+	}
+}
+
+func Test_xpathQuote(t *testing.T) {
+	for s, want := range map[string]string{
+		`OK`:          `"OK"`,
+		`Say "hi"`:    `'Say "hi"'`,
+		`it's "this"`: `concat("it's ", '"', "this", '"', "")`,
+	} {
+		if got := xpathQuote(s); got != want {
+			t.Errorf("%s: got %s, want %s", s, got, want)
+		}
+	}
+}
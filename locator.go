@@ -0,0 +1,232 @@
+package gwda
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Locator describes how to find an element instead of holding on to one.
+// The element is looked up anew by every action, which waits until the element
+// is there and can be acted upon, and looks it up again if it went stale.
+//
+//	login := gwda.NewLocator(driver, gwda.BySelector{Name: "Login"})
+//	err = login.Click()
+type Locator struct {
+	wd     WebDriver
+	by     BySelector
+	parent *Locator
+	// index selects one of all matches, or the first match if negative
+	index   int
+	timeout time.Duration
+}
+
+// NewLocator creates a locator for the first element matching by.
+func NewLocator(wd WebDriver, by BySelector) *Locator {
+	return &Locator{wd: wd, by: by, index: -1}
+}
+
+// Locator creates a locator for the first element matching by inside the element of l.
+func (l *Locator) Locator(by BySelector) *Locator {
+	return &Locator{wd: l.wd, by: by, parent: l, index: -1, timeout: l.timeout}
+}
+
+// Nth returns a locator for the element at index i of all matches, starting at 0.
+func (l *Locator) Nth(i int) *Locator {
+	nth := *l
+	nth.index = i
+	return &nth
+}
+
+// WithTimeout returns a locator waiting at most timeout for its element,
+// by default it waits as long as Wait of the driver.
+func (l *Locator) WithTimeout(timeout time.Duration) *Locator {
+	withTimeout := *l
+	withTimeout.timeout = timeout
+	return &withTimeout
+}
+
+func (l *Locator) String() string {
+	s := describeSelector(l.by)
+	if l.index >= 0 {
+		s += fmt.Sprintf(" [%d]", l.index)
+	}
+	if l.parent != nil {
+		s = l.parent.String() + " >> " + s
+	}
+	return s
+}
+
+// Element looks up the element right away, without waiting for it.
+func (l *Locator) Element() (WebElement, error) {
+	if l.index < 0 {
+		if l.parent == nil {
+			return l.wd.FindElement(l.by)
+		}
+		parent, err := l.parent.Element()
+		if err != nil {
+			return nil, err
+		}
+		return parent.FindElement(l.by)
+	}
+
+	elements, err := l.all()
+	if err != nil {
+		return nil, err
+	}
+	if l.index >= len(elements) {
+		return nil, fmt.Errorf("%w: %s, only %d elements found", ErrNoSuchElement, l, len(elements))
+	}
+	return elements[l.index], nil
+}
+
+// Count returns the number of elements matching right now, Nth is not taken into account.
+func (l *Locator) Count() (int, error) {
+	elements, err := l.all()
+	if errors.Is(err, ErrNoSuchElement) {
+		return 0, nil
+	}
+	return len(elements), err
+}
+
+func (l *Locator) all() ([]WebElement, error) {
+	if l.parent == nil {
+		return l.wd.FindElements(l.by)
+	}
+	parent, err := l.parent.Element()
+	if err != nil {
+		return nil, err
+	}
+	return parent.FindElements(l.by)
+}
+
+// Wait returns the explicit waits of the locator.
+func (l *Locator) Wait() LocatorWait {
+	return LocatorWait{l}
+}
+
+// Click Waits for the element to be visible and enabled, then clicks it.
+func (l *Locator) Click() error {
+	return l.act("click", func(element WebElement) error { return element.Click() })
+}
+
+// SendKeys Waits for the element to be visible and enabled, then types text into it.
+func (l *Locator) SendKeys(text string, frequency ...int) error {
+	return l.act("send keys to", func(element WebElement) error { return element.SendKeys(text, frequency...) })
+}
+
+// Clear Waits for the element to be visible and enabled, then clears its text.
+func (l *Locator) Clear() error {
+	return l.act("clear", func(element WebElement) error { return element.Clear() })
+}
+
+// Text Waits for the element and returns its text.
+func (l *Locator) Text() (text string, err error) {
+	err = l.waitFor("text of element "+l.String(), func(element WebElement) (bool, string, error) {
+		if text, err = element.Text(); err != nil {
+			return false, "", err
+		}
+		return true, fmt.Sprintf("text %q", text), nil
+	})
+	return
+}
+
+// act waits until the element is visible and enabled and action succeeds,
+// an element which is not interactable yet is retried.
+func (l *Locator) act(name string, action func(element WebElement) error) error {
+	return l.waitFor(name+" element "+l.String(), func(element WebElement) (bool, string, error) {
+		if displayed, err := element.IsDisplayed(); err != nil || !displayed {
+			return false, "not displayed", err
+		}
+		if enabled, err := element.IsEnabled(); err != nil || !enabled {
+			return false, "not enabled", err
+		}
+		if err := action(element); err != nil {
+			if errors.Is(err, ErrElementNotInteractable) {
+				return false, "not interactable", nil
+			}
+			return false, "", err
+		}
+		return true, "done", nil
+	})
+}
+
+// waitFor waits until check reports true for the element,
+// while there is no element or it went stale it is looked up again.
+func (l *Locator) waitFor(description string, check func(element WebElement) (done bool, observed string, err error)) error {
+	return l.wait(func(wd WebDriver) (bool, error) {
+		element, err := l.Element()
+		if err == nil {
+			var done bool
+			var observed string
+			if done, observed, err = check(element); err == nil {
+				report(wd, description, observed)
+				return done, nil
+			}
+		}
+		switch {
+		case errors.Is(err, ErrNoSuchElement):
+			report(wd, description, "no such element")
+			return false, nil
+		case errors.Is(err, ErrStaleElementReference):
+			report(wd, description, "stale element")
+			return false, nil
+		}
+		report(wd, description, err.Error())
+		return false, err
+	})
+}
+
+// wait polls condition for the timeout of the locator, or of the driver if none is set.
+func (l *Locator) wait(condition Condition) error {
+	if l.timeout <= 0 {
+		return l.wd.Wait(condition)
+	}
+	return l.wd.WaitWithTimeout(condition, l.timeout)
+}
+
+// LocatorWait waits for the element of a Locator to reach a state.
+type LocatorWait struct {
+	l *Locator
+}
+
+// Present Waits until the element exists.
+func (w LocatorWait) Present() error {
+	return w.l.waitFor("element present "+w.l.String(), func(WebElement) (bool, string, error) {
+		return true, "element found", nil
+	})
+}
+
+// Visible Waits until the element exists and is displayed.
+func (w LocatorWait) Visible() error {
+	return w.l.waitFor("element visible "+w.l.String(), func(element WebElement) (bool, string, error) {
+		displayed, err := element.IsDisplayed()
+		return displayed, fmt.Sprintf("displayed %v", displayed), err
+	})
+}
+
+// Enabled Waits until the element exists and is enabled.
+func (w LocatorWait) Enabled() error {
+	return w.l.waitFor("element enabled "+w.l.String(), func(element WebElement) (bool, string, error) {
+		enabled, err := element.IsEnabled()
+		return enabled, fmt.Sprintf("enabled %v", enabled), err
+	})
+}
+
+// Absent Waits until no element matches anymore.
+func (w LocatorWait) Absent() error {
+	description := "element absent " + w.l.String()
+	return w.l.wait(func(wd WebDriver) (bool, error) {
+		_, err := w.l.Element()
+		switch {
+		case err == nil:
+			report(wd, description, "element found")
+			return false, nil
+		case errors.Is(err, ErrNoSuchElement):
+			report(wd, description, "no such element")
+			return true, nil
+		}
+		report(wd, description, err.Error())
+		return false, err
+	})
+}
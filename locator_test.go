@@ -0,0 +1,110 @@
+package gwda
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocator(t *testing.T) {
+	var mu sync.Mutex
+	var lookups, clicks int
+	var clicked []string
+
+	notFound := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"value":{"error":"no such element","message":"unable to find an element"}}`))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/session/test-session/element", func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&data)
+		mu.Lock()
+		defer mu.Unlock()
+		lookups++
+		// the button shows up with the third lookup, and has a new id every time
+		if data["value"] != "Login" || lookups < 3 {
+			notFound(w)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"value": map[string]string{"ELEMENT": "login-" + string(rune('0'+lookups))}})
+	})
+	mux.HandleFunc("/session/test-session/elements", func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&data)
+		if data["value"] != "XCUIElementTypeCell" {
+			_, _ = w.Write([]byte(`{"value":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"value":[{"ELEMENT":"cell-0"},{"ELEMENT":"cell-1"},{"ELEMENT":"cell-2"}]}`))
+	})
+	mux.HandleFunc("/session/test-session/element/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/session/test-session/element/"), "/")
+		id, command := parts[0], parts[len(parts)-1]
+		mu.Lock()
+		defer mu.Unlock()
+		switch command {
+		case "displayed", "enabled":
+			_, _ = w.Write([]byte(`{"value":true}`))
+		case "text":
+			_, _ = w.Write([]byte(`{"value":"` + id + `"}`))
+		case "click":
+			clicks++
+			if clicks == 1 {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"value":{"error":"stale element reference","message":"the element is gone"}}`))
+				return
+			}
+			clicked = append(clicked, id)
+			_, _ = w.Write([]byte(`{"value":null}`))
+		case "elements":
+			_, _ = w.Write([]byte(`{"value":[{"ELEMENT":"` + id + `-child"}]}`))
+		default:
+			notFound(w)
+		}
+	})
+	wd := newTestDriver(t, mux)
+	wd.options = newDriverOptions([]DriverOption{WithWaitInterval(5 * time.Millisecond)})
+
+	login := NewLocator(wd, BySelector{Name: "Login"}).WithTimeout(time.Second)
+	if n, err := login.Count(); err != nil || n != 0 {
+		t.Fatalf("got %d, %v, want no element", n, err)
+	}
+	if err := login.Wait().Visible(); err != nil {
+		t.Fatal(err)
+	}
+	// the first click hits a stale element, the button is looked up again
+	if err := login.Click(); err != nil {
+		t.Fatal(err)
+	}
+	if len(clicked) != 1 || clicked[0] != "login-5" {
+		t.Fatalf("clicked %q", clicked)
+	}
+
+	cells := NewLocator(wd, BySelector{ClassName: ElementType{Cell: true}})
+	if n, err := cells.Count(); err != nil || n != 3 {
+		t.Fatalf("got %d, %v, want 3", n, err)
+	}
+	if text, err := cells.Nth(1).Text(); err != nil || text != "cell-1" {
+		t.Fatalf("got %q, %v", text, err)
+	}
+	if text, err := cells.Nth(2).Locator(BySelector{ClassName: ElementType{StaticText: true}}).Nth(0).Text(); err != nil || text != "cell-2-child" {
+		t.Fatalf("got %q, %v", text, err)
+	}
+
+	err := cells.Nth(3).WithTimeout(30 * time.Millisecond).Wait().Present()
+	if !errors.Is(err, ErrTimeout) || !strings.Contains(err.Error(), "[3], last observed: no such element") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err = NewLocator(wd, BySelector{Name: "Logout"}).WithTimeout(30 * time.Millisecond).Wait().Absent(); err != nil {
+		t.Fatal(err)
+	}
+	err = cells.Nth(0).WithTimeout(30 * time.Millisecond).Wait().Absent()
+	if !errors.Is(err, ErrTimeout) || !strings.Contains(err.Error(), "last observed: element found") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package gwda
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RequestLog describes a request of a driver to WDA once it completed.
+type RequestLog struct {
+	Method string
+	// Path is the path of the request URL, e.g. "/session/{id}/wda/keys"
+	Path      string
+	SessionID string
+	// Serial is the serial number of the device of a USB driver
+	Serial  string
+	Status  int
+	Latency time.Duration
+	// RequestBody and ResponseBody are truncated, see WithLogBodyLimit,
+	// and the typed text is redacted if the driver was created WithRedactedKeys.
+	RequestBody  string
+	ResponseBody string
+	// Err is set if no response was received
+	Err error
+}
+
+// RequestLogger receives a RequestLog for every request of a driver created WithRequestLogger.
+type RequestLogger interface {
+	LogRequest(entry RequestLog)
+}
+
+// RequestLoggerFunc is a function used as RequestLogger.
+type RequestLoggerFunc func(entry RequestLog)
+
+func (f RequestLoggerFunc) LogRequest(entry RequestLog) {
+	f(entry)
+}
+
+// DefaultLogBodyLimit is the number of bytes of the bodies logged unless changed WithLogBodyLimit.
+const DefaultLogBodyLimit = 1024
+
+// WithRequestLogger passes a RequestLog of every request of the driver to logger,
+// in addition to the debug output.
+func WithRequestLogger(logger RequestLogger) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.requestLogger = logger
+	})
+}
+
+// WithLogBodyLimit truncates the logged request and response bodies to limit bytes,
+// by default DefaultLogBodyLimit. A negative limit logs them in full.
+func WithLogBodyLimit(limit int) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.logBodyLimit = &limit
+	})
+}
+
+// WithRedactedKeys keeps the text typed by SendKeys and AlertSendKeys out of the logs,
+// e.g. because it is a password.
+func WithRedactedKeys() DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.redactKeys = true
+	})
+}
+
+// redacted replaces the text typed by the request.
+const redacted = "[REDACTED]"
+
+// requestLogging is how the requests of a driver are logged, the zero value logs in debug mode only.
+type requestLogging struct {
+	logger        Logger
+	requestLogger RequestLogger
+	bodyLimit     *int
+	redactKeys    bool
+	serial        string
+}
+
+func (l *requestLogging) enabled() bool {
+	return l != nil && (l.logger != nil || l.requestLogger != nil) || debugFlag
+}
+
+// before writes the request about to be sent to the debug output.
+func (l *requestLogging) before(method, rawURL string, rawBody []byte) {
+	if !l.enabled() {
+		return
+	}
+	debugLogf(l.debugLogger(), "--> %s %s\n%s", method, redactURL(rawURL), l.requestBody(method, rawURL, rawBody))
+}
+
+// after writes the completed request to the debug output and passes it to the RequestLogger.
+func (l *requestLogging) after(method, rawURL string, rawBody []byte, status int, latency time.Duration, rawResp []byte, err error) {
+	if !l.enabled() {
+		return
+	}
+	respBody := truncateBody(rawResp, l.limit())
+	if err != nil {
+		debugLogf(l.debugLogger(), "<-- %s %s %s %v\n%s\n", method, redactURL(rawURL), latency, err, respBody)
+	} else {
+		debugLogf(l.debugLogger(), "<-- %s %s %d %s\n%s\n", method, redactURL(rawURL), status, latency, respBody)
+	}
+	if l == nil || l.requestLogger == nil {
+		return
+	}
+
+	entry := RequestLog{
+		Method:       method,
+		Path:         commandPath(rawURL),
+		Serial:       l.serial,
+		Status:       status,
+		Latency:      latency,
+		RequestBody:  l.requestBody(method, rawURL, rawBody),
+		ResponseBody: respBody,
+		Err:          err,
+	}
+	if segments := strings.Split(strings.TrimPrefix(entry.Path, "/"), "/"); len(segments) > 1 && segments[0] == "session" {
+		entry.SessionID = segments[1]
+	}
+	l.requestLogger.LogRequest(entry)
+}
+
+func (l *requestLogging) debugLogger() Logger {
+	if l == nil {
+		return nil
+	}
+	return l.logger
+}
+
+func (l *requestLogging) limit() int {
+	if l == nil || l.bodyLimit == nil {
+		return DefaultLogBodyLimit
+	}
+	return *l.bodyLimit
+}
+
+// requestBody returns the body to log, with the typed text redacted if requested.
+func (l *requestLogging) requestBody(method, rawURL string, rawBody []byte) string {
+	if l != nil && l.redactKeys && typesKeys(method, rawURL) {
+		var data map[string]interface{}
+		if json.Unmarshal(rawBody, &data) == nil {
+			if _, ok := data["value"]; ok {
+				data["value"] = redacted
+			}
+			if _, ok := data["text"]; ok {
+				data["text"] = redacted
+			}
+			rawBody, _ = json.Marshal(data)
+		} else {
+			rawBody = []byte(redacted)
+		}
+	}
+	return truncateBody(rawBody, l.limit())
+}
+
+// typesKeys reports whether the request types text, as sent by SendKeys, AlertSendKeys,
+// InputUUSense and the SendKeys of elements, including the active one.
+func typesKeys(method, rawURL string) bool {
+	if method != "POST" {
+		return false
+	}
+	segments := strings.Split(strings.TrimSuffix(commandPath(rawURL), "/"), "/")
+	if len(segments) < 2 {
+		return false
+	}
+	last := segments[len(segments)-2] + "/" + segments[len(segments)-1]
+	return last == "wda/keys" || last == "alert/text" || last == "uusense/globalInput" ||
+		segments[len(segments)-1] == "value" && len(segments) >= 3 && segments[len(segments)-3] == "element"
+}
+
+// redactURL hides the password of the URL, e.g. the token of a ProxyServer.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+// truncateBody returns at most limit bytes of body, noting the full size of a truncated one.
+func truncateBody(body []byte, limit int) string {
+	if limit < 0 || len(body) <= limit {
+		return string(body)
+	}
+	return fmt.Sprintf("%s... (%d bytes)", body[:limit], len(body))
+}
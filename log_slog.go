@@ -0,0 +1,49 @@
+//go:build go1.21
+// +build go1.21
+
+package gwda
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SlogRequestLogger returns a RequestLogger writing to logger, e.g.
+//
+//	driver, err := gwda.NewUSBDriver(nil, gwda.WithRequestLogger(gwda.SlogRequestLogger(slog.Default())))
+//
+// Requests are logged at debug level, the ones which failed at warn level.
+func SlogRequestLogger(logger *slog.Logger) RequestLogger {
+	return RequestLoggerFunc(func(entry RequestLog) {
+		level := slog.LevelDebug
+		if entry.Err != nil || entry.Status >= 400 {
+			level = slog.LevelWarn
+		}
+		ctx := context.Background()
+		if !logger.Enabled(ctx, level) {
+			return
+		}
+		attrs := []slog.Attr{
+			slog.String("method", entry.Method),
+			slog.String("path", entry.Path),
+			slog.Int("status", entry.Status),
+			slog.Duration("latency", entry.Latency),
+		}
+		if entry.SessionID != "" {
+			attrs = append(attrs, slog.String("session", entry.SessionID))
+		}
+		if entry.Serial != "" {
+			attrs = append(attrs, slog.String("serial", entry.Serial))
+		}
+		if entry.RequestBody != "" {
+			attrs = append(attrs, slog.String("request", entry.RequestBody))
+		}
+		if entry.ResponseBody != "" {
+			attrs = append(attrs, slog.String("response", entry.ResponseBody))
+		}
+		if entry.Err != nil {
+			attrs = append(attrs, slog.String("error", entry.Err.Error()))
+		}
+		logger.LogAttrs(ctx, level, "wda request", attrs...)
+	})
+}
@@ -0,0 +1,46 @@
+//go:build go1.21
+// +build go1.21
+
+package gwda
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestSlogRequestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := SlogRequestLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	logger.LogRequest(RequestLog{
+		Method:      "POST",
+		Path:        "/session/s/wda/keys",
+		SessionID:   "s",
+		Serial:      "00008030",
+		Status:      200,
+		Latency:     12 * time.Millisecond,
+		RequestBody: `{"value":"[REDACTED]"}`,
+	})
+	logger.LogRequest(RequestLog{Method: "GET", Path: "/status", Err: errors.New("connection refused")})
+
+	decoder := json.NewDecoder(&buf)
+	var ok, failed map[string]interface{}
+	if err := decoder.Decode(&ok); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&failed); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok["level"] != "DEBUG" || ok["method"] != "POST" || ok["session"] != "s" || ok["serial"] != "00008030" ||
+		ok["status"] != float64(200) || ok["request"] != `{"value":"[REDACTED]"}` {
+		t.Errorf("unexpected entry %v", ok)
+	}
+	if failed["level"] != "WARN" || failed["error"] != "connection refused" {
+		t.Errorf("unexpected entry %v", failed)
+	}
+}
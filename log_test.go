@@ -0,0 +1,150 @@
+package gwda
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+type requestLogRecorder struct {
+	mu      sync.Mutex
+	entries []RequestLog
+}
+
+func (r *requestLogRecorder) LogRequest(entry RequestLog) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry)
+}
+
+// last returns the last entry for the path suffix.
+func (r *requestLogRecorder) last(t *testing.T, method, suffix string) RequestLog {
+	t.Helper()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		if entry := r.entries[i]; entry.Method == method && strings.HasSuffix(entry.Path, suffix) {
+			return entry
+		}
+	}
+	t.Fatalf("no request %s %s logged", method, suffix)
+	return RequestLog{}
+}
+
+func TestRequestLogger(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+	fake.SetAlert("Password", "OK")
+	fake.SetUI(&wdatest.Element{Type: "Application", Name: "Login", Width: 390, Height: 844, Children: []*wdatest.Element{
+		{Type: "TextField", Name: "Password", X: 20, Y: 100, Width: 350, Height: 44},
+	}})
+	fake.SetScreenshot(bytes.Repeat([]byte{0x89}, 4096))
+
+	recorder := new(requestLogRecorder)
+	logger := new(bufferLogger)
+	driver, err := NewDriverWithOptions(nil, fake.URL,
+		WithLogger(logger),
+		WithRequestLogger(recorder),
+		WithRedactedKeys(),
+		WithLogBodyLimit(64),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = driver.SendKeys("secret1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = driver.AlertSendKeys("secret2"); err != nil {
+		t.Fatal(err)
+	}
+	if err = driver.InputUUSense("secret3"); err != nil {
+		t.Fatal(err)
+	}
+	field, err := driver.FindElement(BySelector{ClassName: ElementType{TextField: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = field.SendKeys("secret4"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = driver.Screenshot(); err != nil {
+		t.Fatal(err)
+	}
+	if err = driver.AlertAccept(); err != nil {
+		t.Fatal(err)
+	}
+	if err = driver.AlertAccept(); err == nil {
+		t.Fatal("expected an error without alert")
+	}
+
+	keys := recorder.last(t, "POST", "/wda/keys")
+	if keys.Path != "/session/"+fake.SessionID()+"/wda/keys" || keys.SessionID != fake.SessionID() {
+		t.Errorf("path %q, session %q", keys.Path, keys.SessionID)
+	}
+	if keys.Status != 200 || keys.Latency <= 0 {
+		t.Errorf("status %d, latency %v", keys.Status, keys.Latency)
+	}
+	if !strings.Contains(keys.RequestBody, redacted) {
+		t.Errorf("request body %s", keys.RequestBody)
+	}
+	for _, suffix := range []string{"/alert/text", "/uusense/globalInput", "/value"} {
+		if typed := recorder.last(t, "POST", suffix); !strings.Contains(typed.RequestBody, redacted) {
+			t.Errorf("%s: request body %s", suffix, typed.RequestBody)
+		}
+	}
+
+	screenshot := recorder.last(t, "GET", "/screenshot")
+	if !strings.HasSuffix(screenshot.ResponseBody, "bytes)") || len(screenshot.ResponseBody) > 100 {
+		t.Errorf("response body not truncated: %s", screenshot.ResponseBody)
+	}
+
+	if failed := recorder.last(t, "POST", "/alert/accept"); failed.Status != 400 {
+		t.Errorf("status %d", failed.Status)
+	}
+
+	if output := logger.String(); strings.Contains(output, "secret") {
+		t.Errorf("typed text logged:\n%s", output)
+	} else if !strings.Contains(output, "bytes)") {
+		t.Errorf("debug output not truncated:\n%s", output)
+	}
+}
+
+func Test_typesKeys(t *testing.T) {
+	tests := []struct {
+		method string
+		rawURL string
+		want   bool
+	}{
+		{"POST", "http://localhost:8100/session/s/wda/keys", true},
+		{"POST", "http://localhost:8100/session/s/alert/text", true},
+		{"GET", "http://localhost:8100/session/s/alert/text", false},
+		{"POST", "http://localhost:8100/session/s/element/e/value", true},
+		{"POST", "http://localhost:8100/session/s/element/active/value", true},
+		{"POST", "http://localhost:8100/uusense/globalInput", true},
+		{"POST", "http://proxy/00008030-0001/uusense/globalInput", true},
+		{"POST", "http://localhost:8100/uusense/screenshot", false},
+		{"POST", "http://localhost:8100/session/s/element/e/click", false},
+		{"POST", "http://localhost:8100/session/s/wda/apps/launch", false},
+	}
+	for _, tt := range tests {
+		if got := typesKeys(tt.method, tt.rawURL); got != tt.want {
+			t.Errorf("typesKeys(%s, %s) = %v, want %v", tt.method, tt.rawURL, got, tt.want)
+		}
+	}
+}
+
+func Test_truncateBody(t *testing.T) {
+	if got := truncateBody([]byte("abcdef"), 3); got != "abc... (6 bytes)" {
+		t.Error(got)
+	}
+	if got := truncateBody([]byte("abcdef"), 6); got != "abcdef" {
+		t.Error(got)
+	}
+	if got := truncateBody([]byte("abcdef"), -1); got != "abcdef" {
+		t.Error(got)
+	}
+}
@@ -0,0 +1,283 @@
+package gwda
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsCollector receives the measurements of the drivers created WithMetrics,
+// device is the serial number of a USB driver or the host of WDA otherwise.
+type MetricsCollector interface {
+	// ObserveCommand is called for every request, see Command for the name.
+	// outcome is "ok", the W3C error code reported by WDA, e.g. "no such element",
+	// "canceled", "timeout" or "error" if no response was received.
+	ObserveCommand(device, command, outcome string, latency time.Duration)
+	// ObserveReconnect is called once a new session was created after the session was lost,
+	// and once WDA answers again after a driver connected via USB reconnected to its device.
+	ObserveReconnect(device string)
+	// ObserveKeepAliveFailure is called when the health check of the keep-alive fails.
+	ObserveKeepAliveFailure(device string)
+	// ObserveScreenshot is called with the size of every screenshot taken.
+	ObserveScreenshot(device string, size int)
+}
+
+// WithMetrics reports the commands, reconnections, keep-alive failures
+// and screenshots of the driver to collector, e.g. a *Metrics.
+func WithMetrics(collector MetricsCollector) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.metrics = collector
+	})
+}
+
+// metricsMiddleware observes the commands passing through it.
+func metricsMiddleware(collector MetricsCollector, device string) Middleware {
+	return func(next CommandHandler) CommandHandler {
+		return func(cmd *Command) ([]byte, error) {
+			start := time.Now()
+			response, err := next(cmd)
+			collector.ObserveCommand(device, cmd.Name, commandOutcome(err), time.Since(start))
+			return response, err
+		}
+	}
+}
+
+func commandOutcome(err error) string {
+	var wdaErr *WDAError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &wdaErr) && wdaErr.Code != "":
+		return wdaErr.Code
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return "error"
+}
+
+// deviceName is the device label of the metrics of the driver.
+func (wd *remoteWD) deviceName() string {
+	if wd.usbCli != nil {
+		return wd.usbCli.serial
+	}
+	if wd.urlPrefix != nil {
+		return wd.urlPrefix.Host
+	}
+	return ""
+}
+
+func (wd *remoteWD) observeScreenshot(size int) {
+	if wd.options.metrics != nil {
+		wd.options.metrics.ObserveScreenshot(wd.deviceName(), size)
+	}
+}
+
+// The buckets of the histograms of Metrics, in seconds and bytes.
+var (
+	DefaultLatencyBuckets    = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	DefaultScreenshotBuckets = []float64{16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+)
+
+// Metrics is a MetricsCollector keeping the measurements in memory and serving them
+// in the Prometheus text exposition format, e.g.
+//
+//	metrics := gwda.NewMetrics()
+//	http.Handle("/metrics", metrics)
+//	driver, err := gwda.NewUSBDriver(nil, gwda.WithMetrics(metrics))
+type Metrics struct {
+	mu                sync.Mutex
+	commands          map[commandMetric]uint64
+	latencies         map[commandMetric]*histogram
+	reconnects        map[string]uint64
+	keepAliveFailures map[string]uint64
+	screenshots       map[string]*histogram
+}
+
+type commandMetric struct {
+	device, command, outcome string
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// NewMetrics creates an empty collector.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		commands:          make(map[commandMetric]uint64),
+		latencies:         make(map[commandMetric]*histogram),
+		reconnects:        make(map[string]uint64),
+		keepAliveFailures: make(map[string]uint64),
+		screenshots:       make(map[string]*histogram),
+	}
+}
+
+func (m *Metrics) ObserveCommand(device, command, outcome string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands[commandMetric{device, command, outcome}]++
+	key := commandMetric{device: device, command: command}
+	h, ok := m.latencies[key]
+	if !ok {
+		h = newHistogram(DefaultLatencyBuckets)
+		m.latencies[key] = h
+	}
+	h.observe(latency.Seconds())
+}
+
+func (m *Metrics) ObserveReconnect(device string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconnects[device]++
+}
+
+func (m *Metrics) ObserveKeepAliveFailure(device string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keepAliveFailures[device]++
+}
+
+func (m *Metrics) ObserveScreenshot(device string, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.screenshots[device]
+	if !ok {
+		h = newHistogram(DefaultScreenshotBuckets)
+		m.screenshots[device] = h
+	}
+	h.observe(float64(size))
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.WriteText(w)
+}
+
+// WriteText writes the metrics in the Prometheus text exposition format to w.
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	buf := bufio.NewWriter(w)
+
+	writeHeader(buf, "gwda_commands_total", "counter", "WDA commands by device, command and outcome.")
+	commands := make([]commandMetric, 0, len(m.commands))
+	for key := range m.commands {
+		commands = append(commands, key)
+	}
+	sortCommandMetrics(commands)
+	for _, key := range commands {
+		writeSample(buf, "gwda_commands_total", labels("device", key.device, "command", key.command, "outcome", key.outcome), float64(m.commands[key]))
+	}
+
+	writeHeader(buf, "gwda_command_duration_seconds", "histogram", "Latency of the WDA commands by device and command.")
+	commands = commands[:0]
+	for key := range m.latencies {
+		commands = append(commands, key)
+	}
+	sortCommandMetrics(commands)
+	for _, key := range commands {
+		writeHistogram(buf, "gwda_command_duration_seconds", labels("device", key.device, "command", key.command), m.latencies[key])
+	}
+
+	writeHeader(buf, "gwda_reconnects_total", "counter", "Sessions created anew after the session was lost and USB reconnections, by device.")
+	for _, device := range sortedDevices(m.reconnects) {
+		writeSample(buf, "gwda_reconnects_total", labels("device", device), float64(m.reconnects[device]))
+	}
+
+	writeHeader(buf, "gwda_keepalive_failures_total", "counter", "Failed health checks of the keep-alive by device.")
+	for _, device := range sortedDevices(m.keepAliveFailures) {
+		writeSample(buf, "gwda_keepalive_failures_total", labels("device", device), float64(m.keepAliveFailures[device]))
+	}
+
+	writeHeader(buf, "gwda_screenshot_bytes", "histogram", "Size of the screenshots by device.")
+	devices := make([]string, 0, len(m.screenshots))
+	for device := range m.screenshots {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	for _, device := range devices {
+		writeHistogram(buf, "gwda_screenshot_bytes", labels("device", device), m.screenshots[device])
+	}
+	return buf.Flush()
+}
+
+func sortCommandMetrics(keys []commandMetric) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.device != b.device {
+			return a.device < b.device
+		}
+		if a.command != b.command {
+			return a.command < b.command
+		}
+		return a.outcome < b.outcome
+	})
+}
+
+func sortedDevices(counts map[string]uint64) []string {
+	devices := make([]string, 0, len(counts))
+	for device := range counts {
+		devices = append(devices, device)
+	}
+	sort.Strings(devices)
+	return devices
+}
+
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeSample(w io.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%s{%s} %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func writeHistogram(w io.Writer, name, labels string, h *histogram) {
+	for i, bound := range h.buckets {
+		writeSample(w, name+"_bucket", labels+`,le="`+strconv.FormatFloat(bound, 'g', -1, 64)+`"`, float64(h.counts[i]))
+	}
+	writeSample(w, name+"_bucket", labels+`,le="+Inf"`, float64(h.count))
+	writeSample(w, name+"_sum", labels, h.sum)
+	writeSample(w, name+"_count", labels, float64(h.count))
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats pairs of label names and values.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i] + `="` + labelValueReplacer.Replace(pairs[i+1]) + `"`)
+	}
+	return b.String()
+}
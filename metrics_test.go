@@ -0,0 +1,99 @@
+package gwda
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func TestWithMetrics(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+	fake.SetScreenshot(bytes.Repeat([]byte{0x89}, 20000))
+
+	metrics := NewMetrics()
+	driver, err := NewDriverWithOptions(nil, fake.URL, WithMetrics(metrics), WithSessionRecovery(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = driver.FindElement(BySelector{Name: "missing"}); err == nil {
+		t.Fatal("expected no such element")
+	}
+	if _, err = driver.Screenshot(); err != nil {
+		t.Fatal(err)
+	}
+	fake.ExpireSession()
+	if _, err = driver.Status(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = driver.ActiveAppInfo(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(metrics)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", contentType)
+	}
+	raw, _ := ioutil.ReadAll(resp.Body)
+	text := string(raw)
+
+	device := strings.TrimPrefix(fake.URL, "http://")
+	for _, want := range []string{
+		`gwda_commands_total{device="` + device + `",command="FindElement",outcome="no such element"} 1`,
+		`gwda_commands_total{device="` + device + `",command="Screenshot",outcome="ok"} 1`,
+		`gwda_commands_total{device="` + device + `",command="ActiveAppInfo",outcome="invalid session id"} 1`,
+		`gwda_commands_total{device="` + device + `",command="NewSession",outcome="ok"} 2`,
+		`gwda_command_duration_seconds_count{device="` + device + `",command="FindElement"} 1`,
+		`gwda_command_duration_seconds_bucket{device="` + device + `",command="FindElement",le="+Inf"} 1`,
+		`gwda_reconnects_total{device="` + device + `"} 1`,
+		`gwda_screenshot_bytes_bucket{device="` + device + `",le="16384"} 0`,
+		`gwda_screenshot_bytes_bucket{device="` + device + `",le="65536"} 1`,
+		`gwda_screenshot_bytes_sum{device="` + device + `"} 20000`,
+		"# TYPE gwda_keepalive_failures_total counter",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %s in\n%s", want, text)
+		}
+	}
+}
+
+func TestWithMetrics_KeepAliveFailure(t *testing.T) {
+	fake := wdatest.NewServer()
+	metrics := NewMetrics()
+	if _, err := NewDriverWithOptions(nil, fake.URL, WithMetrics(metrics), WithKeepAlive(5*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	fake.Close()
+
+	device := strings.TrimPrefix(fake.URL, "http://")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var buf bytes.Buffer
+		_ = metrics.WriteText(&buf)
+		if strings.Contains(buf.String(), `gwda_keepalive_failures_total{device="`+device+`"} 1`) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no keep-alive failure counted:\n%s", buf.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func Test_labels(t *testing.T) {
+	if got := labels("a", `x"y`, "b", "1\\2\n"); got != `a="x\"y",b="1\\2\n"` {
+		t.Error(got)
+	}
+}
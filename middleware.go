@@ -0,0 +1,72 @@
+package gwda
+
+import (
+	"context"
+	"net/http"
+)
+
+// Command is a request of a driver to WDA as it passes through the middleware.
+type Command struct {
+	// Name is the logical command, the name of the method issuing the request,
+	// e.g. "FindElement" or "Tap" of the driver and "Element.Click" of an element.
+	// The requests a method leaves to other methods carry their names,
+	// e.g. TapImage takes a "Screenshot" before it taps as "TapImage".
+	Name   string
+	Method string
+	URL    string
+	Body   []byte
+	// Header holds headers added to the request, e.g. by middleware
+	Header  http.Header
+	Context context.Context
+}
+
+// CommandHandler sends a command and returns the raw response of WDA.
+type CommandHandler func(cmd *Command) (response []byte, err error)
+
+// Middleware wraps the handler of the commands of a driver, e.g. to measure them,
+// add headers, inject faults or limit their rate:
+//
+//	func(next gwda.CommandHandler) gwda.CommandHandler {
+//		return func(cmd *gwda.Command) ([]byte, error) {
+//			start := time.Now()
+//			response, err := next(cmd)
+//			log.Printf("%s took %s", cmd.Name, time.Since(start))
+//			return response, err
+//		}
+//	}
+//
+// Middleware may return without calling next, the request is not sent then.
+type Middleware func(next CommandHandler) CommandHandler
+
+// WithMiddleware passes every request of the driver through middleware,
+// the first one given is the outermost.
+// Retries of the session recovery are separate commands.
+func WithMiddleware(middleware ...Middleware) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.middleware = append(opts.middleware, middleware...)
+	})
+}
+
+// runMiddleware passes the request through the middleware of the driver to send.
+func (wd *remoteWD) runMiddleware(command string, method string, rawURL string, rawBody []byte, send CommandHandler) (rawResponse, error) {
+	handler := send
+	// the metrics are innermost to measure the requests themselves
+	if wd.options.metrics != nil {
+		handler = metricsMiddleware(wd.options.metrics, wd.deviceName())(handler)
+	}
+	if wd.options.tracer != nil {
+		handler = tracingMiddleware(wd.options.tracer, wd.deviceName())(handler)
+	}
+	for i := len(wd.options.middleware) - 1; i >= 0; i-- {
+		handler = wd.options.middleware[i](handler)
+	}
+	rawResp, err := handler(&Command{
+		Name:    command,
+		Method:  method,
+		URL:     rawURL,
+		Body:    rawBody,
+		Header:  make(http.Header),
+		Context: wd.context(),
+	})
+	return rawResp, err
+}
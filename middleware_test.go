@@ -0,0 +1,98 @@
+package gwda
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func TestWithMiddleware(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+	fake.SetUI(&wdatest.Element{Type: "Application", Width: 390, Height: 844, Children: []*wdatest.Element{
+		{Type: "Button", Name: "Login", X: 10, Y: 10, Width: 100, Height: 40},
+	}})
+	var tapHeader string
+	fake.Handle(http.MethodPost, "/wda/tap/0", func(w http.ResponseWriter, r *http.Request) {
+		tapHeader = r.Header.Get("X-Test-Run")
+		_, _ = w.Write([]byte(`{"value":null}`))
+	})
+
+	var mu sync.Mutex
+	var names, order []string
+	errInjected := errors.New("injected")
+	driver, err := NewDriverWithOptions(nil, fake.URL,
+		WithKeepAlive(0),
+		WithMiddleware(
+			func(next CommandHandler) CommandHandler {
+				return func(cmd *Command) ([]byte, error) {
+					mu.Lock()
+					names = append(names, cmd.Name)
+					order = append(order, "outer")
+					mu.Unlock()
+					cmd.Header.Set("X-Test-Run", "42")
+					return next(cmd)
+				}
+			},
+			func(next CommandHandler) CommandHandler {
+				return func(cmd *Command) ([]byte, error) {
+					mu.Lock()
+					order = append(order, "inner")
+					mu.Unlock()
+					if cmd.Name == "PressButton" {
+						return nil, errInjected
+					}
+					return next(cmd)
+				}
+			},
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	names, order = nil, nil
+	mu.Unlock()
+
+	element, err := driver.FindElement(BySelector{Name: "Login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = element.Click(); err != nil {
+		t.Fatal(err)
+	}
+	if err = driver.Tap(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err = driver.PressButton(DeviceButtonHome); !errors.Is(err, errInjected) {
+		t.Fatalf("expected the injected error, got %v", err)
+	}
+	for _, r := range fake.Requests() {
+		if r.Route() == "/wda/pressButton" {
+			t.Error("the request of the failed command was sent")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"FindElement", "Element.Click", "Tap", "PressButton"}
+	if len(names) != len(want) {
+		t.Fatalf("names %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("names %v, want %v", names, want)
+			break
+		}
+	}
+	if order[0] != "outer" || order[1] != "inner" {
+		t.Errorf("order %v", order)
+	}
+	if tapHeader != "42" {
+		t.Errorf("header %q", tapHeader)
+	}
+}
@@ -0,0 +1,319 @@
+package gwda
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMjpegBufferSize = 1
+
+// maxMjpegFrameSize bounds the frames read, a corrupt Content-Length must not allocate gigabytes.
+const maxMjpegFrameSize = 32 << 20
+
+// MjpegFrame is a single JPEG image of the screen broadcast.
+type MjpegFrame struct {
+	// Data is the raw JPEG encoded image.
+	Data []byte
+	// Timestamp is the time the frame was completely received.
+	Timestamp time.Time
+	// Seq numbers the frames read from the stream, starting at 1,
+	// gaps show frames that were dropped.
+	Seq int
+}
+
+// Image decodes the JPEG data of the frame.
+func (f MjpegFrame) Image() (image.Image, error) {
+	return jpeg.Decode(bytes.NewReader(f.Data))
+}
+
+type MjpegStreamOption func(s *MjpegStream)
+
+// WithMjpegBufferSize sets how many frames are buffered for Frames, the default is 1.
+func WithMjpegBufferSize(n int) MjpegStreamOption {
+	return func(s *MjpegStream) {
+		if n >= 0 {
+			s.bufferSize = n
+		}
+	}
+}
+
+// WithMjpegDropFrames drops the oldest buffered frame when the buffer is full,
+// instead of pausing the reading of the stream until the receiver catches up.
+func WithMjpegDropFrames() MjpegStreamOption {
+	return func(s *MjpegStream) {
+		s.dropFrames = true
+	}
+}
+
+// WithMjpegFrameHandler delivers frames to fn rather than to the Frames channel,
+// fn is called on the reading goroutine, so the stream is paused while it runs.
+func WithMjpegFrameHandler(fn func(frame MjpegFrame)) MjpegStreamOption {
+	return func(s *MjpegStream) {
+		s.handler = fn
+	}
+}
+
+// withMjpegLogger logs the request of the stream to the logger of its driver.
+func withMjpegLogger(logger Logger) MjpegStreamOption {
+	return func(s *MjpegStream) {
+		s.logger = logger
+	}
+}
+
+// MjpegStream decodes the multipart/x-mixed-replace screen broadcast of the WDA MJPEG server.
+type MjpegStream struct {
+	bufferSize int
+	dropFrames bool
+	handler    func(frame MjpegFrame)
+	logger     Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	body   io.ReadCloser
+	frames chan MjpegFrame
+	done   chan struct{}
+
+	boundary     string
+	atPartHeader bool
+	atEnd        bool
+	seq          int
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+// NewMjpegStream requests rawURL with client and starts reading frames from the response,
+// the stream ends when ctx is done, Close is called or the server closes the connection.
+func NewMjpegStream(ctx context.Context, client *http.Client, rawURL string, options ...MjpegStreamOption) (stream *MjpegStream, err error) {
+	if client == nil {
+		return nil, errors.New("mjpeg: no HTTP client")
+	}
+	stream = &MjpegStream{bufferSize: defaultMjpegBufferSize}
+	for _, option := range options {
+		option(stream)
+	}
+
+	stream.ctx, stream.cancel = context.WithCancel(ctx)
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(stream.ctx, http.MethodGet, rawURL, nil); err != nil {
+		stream.cancel()
+		return nil, err
+	}
+	debugLogf(stream.logger, "--> %s %s", req.Method, redactURL(rawURL))
+
+	var resp *http.Response
+	if resp, err = client.Do(req); err != nil {
+		stream.cancel()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		stream.cancel()
+		return nil, fmt.Errorf("mjpeg: unexpected status %d", resp.StatusCode)
+	}
+	if mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && strings.HasPrefix(mediaType, "multipart/") {
+		stream.boundary = params["boundary"]
+	}
+
+	stream.body = resp.Body
+	stream.frames = make(chan MjpegFrame, stream.bufferSize)
+	stream.done = make(chan struct{})
+	go stream.run()
+	return stream, nil
+}
+
+// Frames returns the channel the frames are delivered on, it is closed when the stream ends.
+func (s *MjpegStream) Frames() <-chan MjpegFrame {
+	return s.frames
+}
+
+// Done returns a channel that is closed when the stream ended.
+func (s *MjpegStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the stream ended: nil after Close, the context's error,
+// io.EOF when the server ended the broadcast or a read error.
+func (s *MjpegStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops reading the stream and waits until the frames channel is closed.
+func (s *MjpegStream) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	s.cancel()
+	err := s.body.Close()
+	<-s.done
+	return err
+}
+
+func (s *MjpegStream) run() {
+	defer close(s.done)
+	defer close(s.frames)
+	defer s.body.Close()
+
+	r := bufio.NewReader(s.body)
+	for {
+		data, err := s.readFrame(r)
+		if err != nil {
+			s.finish(err)
+			return
+		}
+		s.seq++
+		frame := MjpegFrame{Data: data, Timestamp: time.Now(), Seq: s.seq}
+		if !s.deliver(frame) {
+			s.finish(s.ctx.Err())
+			return
+		}
+	}
+}
+
+func (s *MjpegStream) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.closed:
+		s.err = nil
+	case s.ctx.Err() != nil:
+		s.err = s.ctx.Err()
+	default:
+		s.err = err
+	}
+}
+
+// deliver passes frame to the handler or the frames channel,
+// and reports false if the stream was canceled in the meantime.
+func (s *MjpegStream) deliver(frame MjpegFrame) bool {
+	if s.handler != nil {
+		s.handler(frame)
+		return s.ctx.Err() == nil
+	}
+
+	if !s.dropFrames {
+		select {
+		case s.frames <- frame:
+			return true
+		case <-s.ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		select {
+		case s.frames <- frame:
+			return true
+		case <-s.ctx.Done():
+			return false
+		default:
+		}
+		// the buffer is full (or unbuffered with nobody receiving), discard the oldest frame
+		select {
+		case <-s.frames:
+		default:
+			if s.bufferSize == 0 {
+				return true
+			}
+		}
+	}
+}
+
+// readFrame reads the next body part of the multipart response.
+//
+// WDA announces the boundary "--BoundaryString" but delimits the parts with "--BoundaryString"
+// instead of "----BoundaryString", so the bare boundary is accepted as delimiter as well.
+func (s *MjpegStream) readFrame(r *bufio.Reader) (data []byte, err error) {
+	if s.atEnd {
+		return nil, io.EOF
+	}
+	if !s.atPartHeader {
+		for {
+			var line []byte
+			if line, err = r.ReadBytes('\n'); err != nil {
+				return nil, err
+			}
+			if last, ok := s.isDelimiter(line); ok {
+				if last {
+					return nil, io.EOF
+				}
+				break
+			}
+		}
+	}
+	s.atPartHeader = false
+
+	var header textproto.MIMEHeader
+	if header, err = textproto.NewReader(r).ReadMIMEHeader(); err != nil {
+		return nil, err
+	}
+
+	if n, err := strconv.Atoi(header.Get("Content-Length")); err == nil && n >= 0 {
+		if n > maxMjpegFrameSize {
+			return nil, fmt.Errorf("mjpeg frame of %d bytes exceeds %d bytes", n, maxMjpegFrameSize)
+		}
+		data = make([]byte, n)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+
+	// without a Content-Length the part runs up to the next delimiter
+	var buf bytes.Buffer
+	for {
+		var line []byte
+		if line, err = r.ReadBytes('\n'); err != nil {
+			return nil, err
+		}
+		if last, ok := s.isDelimiter(line); ok {
+			s.atPartHeader, s.atEnd = !last, last
+			data = buf.Bytes()
+			data = bytes.TrimSuffix(data, []byte("\n"))
+			data = bytes.TrimSuffix(data, []byte("\r"))
+			return data, nil
+		}
+		if buf.Len()+len(line) > maxMjpegFrameSize {
+			return nil, fmt.Errorf("mjpeg frame exceeds %d bytes", maxMjpegFrameSize)
+		}
+		buf.Write(line)
+	}
+}
+
+// isDelimiter reports whether line delimits a body part, and if it is the closing delimiter.
+// Without a boundary from the Content-Type the first line starting with "--" defines it.
+func (s *MjpegStream) isDelimiter(line []byte) (last, ok bool) {
+	l := string(bytes.TrimRight(line, " \t\r\n"))
+	if s.boundary == "" {
+		if !strings.HasPrefix(l, "--") || len(l) == 2 {
+			return false, false
+		}
+		s.boundary = strings.TrimPrefix(l, "--")
+	}
+	for _, delimiter := range []string{"--" + s.boundary, s.boundary} {
+		switch l {
+		case delimiter:
+			return false, true
+		case delimiter + "--":
+			return true, true
+		}
+	}
+	return false, false
+}
@@ -0,0 +1,176 @@
+package gwda
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestJPEG(t *testing.T, c color.Color) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newTestMjpegServer broadcasts frames, formatted like WDA when contentLength is set.
+func newTestMjpegServer(t *testing.T, frames [][]byte, contentLength, endless bool) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentLength {
+			w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=--BoundaryString")
+		} else {
+			w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=frame")
+		}
+		for i := 0; ; i++ {
+			if i == len(frames) {
+				if !endless {
+					if !contentLength {
+						_, _ = io.WriteString(w, "--frame--\r\n")
+					}
+					return
+				}
+				i = 0
+			}
+			var err error
+			if contentLength {
+				_, err = fmt.Fprintf(w, "--BoundaryString\r\nContent-type: image/jpg\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n", len(frames[i]), frames[i])
+			} else {
+				_, err = fmt.Fprintf(w, "--frame\r\nContent-Type: image/jpeg\r\n\r\n%s\r\n", frames[i])
+			}
+			if err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMjpegStream(t *testing.T) {
+	frames := [][]byte{
+		newTestJPEG(t, color.RGBA{R: 255, A: 255}),
+		newTestJPEG(t, color.RGBA{G: 255, A: 255}),
+		newTestJPEG(t, color.RGBA{B: 255, A: 255}),
+	}
+
+	for _, contentLength := range []bool{true, false} {
+		t.Run(fmt.Sprintf("contentLength=%v", contentLength), func(t *testing.T) {
+			srv := newTestMjpegServer(t, frames, contentLength, false)
+			stream, err := NewMjpegStream(context.Background(), http.DefaultClient, srv.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var i int
+			for frame := range stream.Frames() {
+				if !bytes.Equal(frame.Data, frames[i]) {
+					t.Fatalf("frame %d: data mismatch", i)
+				}
+				if frame.Seq != i+1 || frame.Timestamp.IsZero() {
+					t.Fatalf("frame %d: seq %d, timestamp %v", i, frame.Seq, frame.Timestamp)
+				}
+				if _, err := frame.Image(); err != nil {
+					t.Fatal(err)
+				}
+				i++
+			}
+			if i != len(frames) {
+				t.Fatalf("got %d frames, want %d", i, len(frames))
+			}
+			if err := stream.Err(); err != io.EOF {
+				t.Fatalf("got error %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestMjpegStream_DropFrames(t *testing.T) {
+	srv := newTestMjpegServer(t, [][]byte{newTestJPEG(t, color.White)}, true, true)
+	stream, err := NewMjpegStream(context.Background(), http.DefaultClient, srv.URL, WithMjpegDropFrames())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := <-stream.Frames()
+	time.Sleep(100 * time.Millisecond)
+	second := <-stream.Frames()
+	if second.Seq-first.Seq < 2 {
+		t.Fatalf("expected frames to be dropped, got seq %d after %d", second.Seq, first.Seq)
+	}
+
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for range stream.Frames() {
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("got error %v after Close", err)
+	}
+}
+
+func TestMjpegStream_Context(t *testing.T) {
+	srv := newTestMjpegServer(t, [][]byte{newTestJPEG(t, color.Black)}, true, true)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	received := make(chan struct{}, 1)
+	stream, err := NewMjpegStream(ctx, http.DefaultClient, srv.URL, WithMjpegFrameHandler(func(frame MjpegFrame) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	<-received
+	cancel()
+	select {
+	case <-stream.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream did not stop")
+	}
+	if err := stream.Err(); err != context.Canceled {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMjpegStream_FrameSize(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary=--BoundaryString")
+		_, _ = io.WriteString(w, "--BoundaryString\r\nContent-type: image/jpg\r\nContent-Length: 68719476736\r\n\r\n")
+	}))
+	defer srv.Close()
+	stream, err := NewMjpegStream(context.Background(), http.DefaultClient, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range stream.Frames() {
+		t.Fatal("unexpected frame")
+	}
+	if err := stream.Err(); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("got error %v", err)
+	}
+}
@@ -0,0 +1,554 @@
+package gwda
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This file implements the subset of the NSPredicate format WDA accepts for
+// "predicate string" lookups: comparisons of element attributes with literals,
+// the string operators with [c] and [d] modifiers, IN, BETWEEN and the logical operators.
+// [d] (diacritic insensitivity) is accepted, but has no effect.
+
+// Predicate is a compiled NSPredicate expression.
+type Predicate struct {
+	expr predicateExpr
+	src  string
+}
+
+// CompilePredicate parses an NSPredicate expression as used with BySelector.Predicate.
+func CompilePredicate(expr string) (*Predicate, error) {
+	tokens, err := predicateTokenize(expr)
+	if err != nil {
+		return nil, fmt.Errorf("predicate %q: %w", expr, err)
+	}
+	p := &predicateParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("predicate %q: %w", expr, err)
+	}
+	return &Predicate{expr: e, src: expr}, nil
+}
+
+func (pr *Predicate) String() string {
+	return pr.src
+}
+
+// Match reports whether n fulfills the predicate.
+func (pr *Predicate) Match(n *Node) bool {
+	return pr.expr.match(n)
+}
+
+// Select returns the descendants of the root fulfilling the predicate in document order,
+// like WDA the root itself (the application) is not searched.
+func (pr *Predicate) Select(h *Hierarchy) []*Node {
+	if h.Root == nil {
+		return nil
+	}
+	var nodes []*Node
+	for _, c := range h.Root.Children {
+		nodes = append(nodes, c.FindAll(pr.Match)...)
+	}
+	return nodes
+}
+
+// predicateKeys maps the key paths to the attribute names of the XML source.
+var predicateKeys = map[string]string{
+	"type": "type", "wdType": "type",
+	"name": "name", "wdName": "name", "identifier": "name",
+	"label": "label", "wdLabel": "label",
+	"value": "value", "wdValue": "value",
+	"placeholderValue": "placeholderValue", "wdPlaceholderValue": "placeholderValue",
+	"enabled": "enabled", "isEnabled": "enabled", "wdEnabled": "enabled",
+	"visible": "visible", "isVisible": "visible", "wdVisible": "visible",
+	"accessible": "accessible", "isAccessible": "accessible", "wdAccessible": "accessible", "isWDAccessible": "accessible",
+	"selected": "selected", "isSelected": "selected", "wdSelected": "selected",
+	"focused": "focused", "hasFocus": "focused", "wdFocused": "focused",
+	"hittable": "hittable", "isHittable": "hittable", "wdHittable": "hittable",
+	"index": "index", "wdIndex": "index",
+	"UID": "UID", "wdUID": "UID",
+	"rect.x": "x", "rect.y": "y", "rect.width": "width", "rect.height": "height",
+	"wdRect.x": "x", "wdRect.y": "y", "wdRect.width": "width", "wdRect.height": "height",
+	"frame.origin.x": "x", "frame.origin.y": "y", "frame.size.width": "width", "frame.size.height": "height",
+}
+
+type predicateExpr interface {
+	match(n *Node) bool
+}
+
+type predicateConst bool
+
+func (c predicateConst) match(*Node) bool { return bool(c) }
+
+type predicateLogical struct {
+	and         bool
+	left, right predicateExpr
+}
+
+func (e predicateLogical) match(n *Node) bool {
+	if e.and {
+		return e.left.match(n) && e.right.match(n)
+	}
+	return e.left.match(n) || e.right.match(n)
+}
+
+type predicateNot struct{ expr predicateExpr }
+
+func (e predicateNot) match(n *Node) bool { return !e.expr.match(n) }
+
+// predicateOperand is either the attribute of the element named by key, or a literal.
+type predicateOperand struct {
+	key     string
+	literal interface{} // string, float64, bool, nil or []interface{} of those
+}
+
+func (o predicateOperand) value(n *Node) interface{} {
+	if o.key == "" {
+		return o.literal
+	}
+	v, ok := n.Attributes[o.key]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+type predicateComparison struct {
+	op              string
+	caseInsensitive bool
+	left, right     predicateOperand
+	pattern         *regexp.Regexp
+}
+
+func (e predicateComparison) match(n *Node) bool {
+	left, right := e.left.value(n), e.right.value(n)
+	switch e.op {
+	case "IN":
+		list, ok := right.([]interface{})
+		if !ok {
+			// "'x' IN name" tests for a substring
+			return left != nil && right != nil &&
+				strings.Contains(predicateString(right, e.caseInsensitive), predicateString(left, e.caseInsensitive))
+		}
+		for _, item := range list {
+			if predicateEqual(left, item, e.caseInsensitive) {
+				return true
+			}
+		}
+		return false
+	case "BETWEEN":
+		list, ok := right.([]interface{})
+		if !ok || len(list) != 2 {
+			return false
+		}
+		x, okX := predicateNumber(left)
+		lo, okLo := predicateNumber(list[0])
+		hi, okHi := predicateNumber(list[1])
+		return okX && okLo && okHi && lo <= x && x <= hi
+	case "==":
+		return predicateEqual(left, right, e.caseInsensitive)
+	case "!=":
+		return !predicateEqual(left, right, e.caseInsensitive)
+	case "<", "<=", ">", ">=":
+		x, okX := predicateNumber(left)
+		y, okY := predicateNumber(right)
+		if !okX || !okY {
+			if left == nil || right == nil {
+				return false
+			}
+			cmp := strings.Compare(predicateString(left, e.caseInsensitive), predicateString(right, e.caseInsensitive))
+			x, y = float64(cmp), 0
+		}
+		switch e.op {
+		case "<":
+			return x < y
+		case "<=":
+			return x <= y
+		case ">":
+			return x > y
+		default:
+			return x >= y
+		}
+	}
+
+	if left == nil || right == nil {
+		return false
+	}
+	s, sub := predicateString(left, e.caseInsensitive), predicateString(right, e.caseInsensitive)
+	switch e.op {
+	case "BEGINSWITH":
+		return strings.HasPrefix(s, sub)
+	case "ENDSWITH":
+		return strings.HasSuffix(s, sub)
+	case "CONTAINS":
+		return strings.Contains(s, sub)
+	case "LIKE", "MATCHES":
+		if e.pattern != nil {
+			return e.pattern.MatchString(predicateString(left, false))
+		}
+	}
+	return false
+}
+
+func predicateString(v interface{}, caseInsensitive bool) string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		s = v
+	case bool:
+		s = strconv.FormatBool(v)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if caseInsensitive {
+		s = strings.ToLower(s)
+	}
+	return s
+}
+
+func predicateNumber(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		switch v {
+		case "true":
+			return 1, true
+		case "false":
+			return 0, true
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// predicateEqual compares attribute values, which are strings, with literals of any type.
+func predicateEqual(a, b interface{}, caseInsensitive bool) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	_, aStr := a.(string)
+	_, bStr := b.(string)
+	if !aStr || !bStr {
+		x, okX := predicateNumber(a)
+		y, okY := predicateNumber(b)
+		if okX && okY {
+			return x == y
+		}
+	}
+	return predicateString(a, caseInsensitive) == predicateString(b, caseInsensitive)
+}
+
+// tokens
+
+type predicateTokenKind int
+
+const (
+	predicateTokenOperator predicateTokenKind = iota
+	predicateTokenIdent
+	predicateTokenString
+	predicateTokenNumber
+)
+
+type predicateToken struct {
+	kind predicateTokenKind
+	text string
+}
+
+func predicateTokenize(s string) (tokens []predicateToken, err error) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(s) && s[j] != c; j++ {
+				if s[j] == '\\' && j+1 < len(s) {
+					j++
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string literal")
+			}
+			tokens = append(tokens, predicateToken{predicateTokenString, b.String()})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '-' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i + 1
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, predicateToken{predicateTokenNumber, s[i:j]})
+			i = j
+		case c == '_' || c == '$' || c == '#' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || unicode.IsLetter(rune(s[j])) || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, predicateToken{predicateTokenIdent, strings.TrimPrefix(s[i:j], "#")})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<>", "<=", "=<", ">=", "=>", "&&", "||", "=", "<", ">", "!", "(", ")", "{", "}", "[", "]", ","} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			tokens = append(tokens, predicateToken{predicateTokenOperator, op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// parser
+
+type predicateParser struct {
+	tokens []predicateToken
+	pos    int
+}
+
+func (p *predicateParser) peek() (predicateToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return predicateToken{}, false
+}
+
+// acceptKeyword consumes the next token if it is one of words, keywords are case insensitive.
+func (p *predicateParser) acceptKeyword(words ...string) (string, bool) {
+	t, ok := p.peek()
+	if !ok {
+		return "", false
+	}
+	for _, w := range words {
+		if t.kind == predicateTokenOperator && t.text == w ||
+			t.kind == predicateTokenIdent && strings.EqualFold(t.text, w) {
+			p.pos++
+			return w, true
+		}
+	}
+	return "", false
+}
+
+func (p *predicateParser) expect(op string) error {
+	if _, ok := p.acceptKeyword(op); ok {
+		return nil
+	}
+	if t, ok := p.peek(); ok {
+		return fmt.Errorf("expected %q, got %q", op, t.text)
+	}
+	return fmt.Errorf("expected %q at the end", op)
+}
+
+func (p *predicateParser) parseOr() (predicateExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptKeyword("OR", "||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = predicateLogical{left: left, right: right}
+	}
+}
+
+func (p *predicateParser) parseAnd() (predicateExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptKeyword("AND", "&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = predicateLogical{and: true, left: left, right: right}
+	}
+}
+
+func (p *predicateParser) parseNot() (predicateExpr, error) {
+	if _, ok := p.acceptKeyword("NOT", "!"); ok {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return predicateNot{e}, nil
+	}
+	if _, ok := p.acceptKeyword("("); ok {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+	if _, ok := p.acceptKeyword("TRUEPREDICATE"); ok {
+		return predicateConst(true), nil
+	}
+	if _, ok := p.acceptKeyword("FALSEPREDICATE"); ok {
+		return predicateConst(false), nil
+	}
+	return p.parseComparison()
+}
+
+var predicateOperators = map[string]string{
+	"==": "==", "=": "==", "!=": "!=", "<>": "!=",
+	"<": "<", "<=": "<=", "=<": "<=", ">": ">", ">=": ">=", "=>": ">=",
+	"BEGINSWITH": "BEGINSWITH", "ENDSWITH": "ENDSWITH", "CONTAINS": "CONTAINS",
+	"LIKE": "LIKE", "MATCHES": "MATCHES", "IN": "IN", "BETWEEN": "BETWEEN",
+}
+
+func (p *predicateParser) parseComparison() (predicateExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("expected an operator at the end")
+	}
+	op, ok := predicateOperators[strings.ToUpper(t.text)]
+	if !ok || t.kind == predicateTokenString || t.kind == predicateTokenNumber {
+		return nil, fmt.Errorf("expected an operator, got %q", t.text)
+	}
+	p.pos++
+	e := predicateComparison{op: op, left: left}
+
+	// modifiers: [c] case, [d] diacritic insensitive
+	if _, ok := p.acceptKeyword("["); ok {
+		m, ok := p.peek()
+		if !ok || m.kind != predicateTokenIdent || strings.Trim(strings.ToLower(m.text), "cd") != "" {
+			return nil, errors.New("invalid operator modifier")
+		}
+		e.caseInsensitive = strings.ContainsAny(strings.ToLower(m.text), "c")
+		p.pos++
+		if err = p.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+
+	if e.right, err = p.parseOperand(); err != nil {
+		return nil, err
+	}
+	if op == "LIKE" || op == "MATCHES" {
+		pattern, ok := e.right.literal.(string)
+		if !ok || e.right.key != "" {
+			return nil, fmt.Errorf("%s needs a string literal", op)
+		}
+		if op == "LIKE" {
+			pattern = likeToRegexp(pattern)
+		}
+		if e.caseInsensitive {
+			pattern = "(?i)" + pattern
+		}
+		if e.pattern, err = regexp.Compile("^(?:" + pattern + ")$"); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// likeToRegexp converts the wildcards of LIKE, "*" and "?", to a regular expression.
+func likeToRegexp(pattern string) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return "(?s)" + b.String()
+}
+
+func (p *predicateParser) parseOperand() (o predicateOperand, err error) {
+	t, ok := p.peek()
+	if !ok {
+		return o, errors.New("unexpected end of expression")
+	}
+	p.pos++
+	switch t.kind {
+	case predicateTokenString:
+		o.literal = t.text
+		return o, nil
+	case predicateTokenNumber:
+		var f float64
+		if f, err = strconv.ParseFloat(t.text, 64); err != nil {
+			return o, fmt.Errorf("invalid number %q", t.text)
+		}
+		o.literal = f
+		return o, nil
+	case predicateTokenOperator:
+		if t.text != "{" {
+			return o, fmt.Errorf("unexpected %q", t.text)
+		}
+		var list []interface{}
+		for {
+			var item predicateOperand
+			if item, err = p.parseOperand(); err != nil {
+				return o, err
+			}
+			if item.key != "" {
+				return o, errors.New("aggregates may only contain literals")
+			}
+			list = append(list, item.literal)
+			if _, ok := p.acceptKeyword(","); !ok {
+				break
+			}
+		}
+		o.literal = list
+		return o, p.expect("}")
+	}
+
+	switch strings.ToUpper(t.text) {
+	case "TRUE", "YES":
+		o.literal = true
+		return o, nil
+	case "FALSE", "NO":
+		o.literal = false
+		return o, nil
+	case "NIL", "NULL":
+		return o, nil
+	}
+	key, ok := predicateKeys[t.text]
+	if !ok {
+		return o, fmt.Errorf("unsupported key path %q", t.text)
+	}
+	o.key = key
+	return o, nil
+}
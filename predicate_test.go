@@ -0,0 +1,65 @@
+package gwda
+
+import (
+	"testing"
+)
+
+func TestPredicate_Select(t *testing.T) {
+	h, err := ParseXMLHierarchy(testXMLSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{`type == 'XCUIElementTypeButton'`, []string{"General", "Privacy"}},
+		{`type == "XCUIElementTypeButton" AND enabled == true`, []string{"General"}},
+		{`type == 'XCUIElementTypeButton' && isEnabled == NO`, []string{"Privacy"}},
+		{`name == 'General' OR name == 'Airplane Mode'`, []string{"General", "Airplane Mode"}},
+		{`NOT visible == 1 AND accessible == true`, []string{"Airplane Mode"}},
+		{`label BEGINSWITH[c] 'privacy'`, []string{"Privacy"}},
+		{`label ENDSWITH 'Mode'`, []string{"Airplane Mode"}},
+		{`label CONTAINS[cd] '&'`, []string{"Privacy"}},
+		{`label LIKE 'Gen*'`, []string{"General"}},
+		{`label LIKE 'Gen?ral'`, []string{"General"}},
+		{`name MATCHES '(General|Privacy)'`, []string{"General", "Privacy"}},
+		{`name IN {'General', 'Nothing'}`, []string{"General"}},
+		{`'Mode' IN label`, []string{"Airplane Mode"}},
+		{`rect.y BETWEEN {100, 150}`, []string{"General", "Privacy"}},
+		{`rect.y > 140 AND wdRect.height >= 44`, []string{"Privacy", "Airplane Mode"}},
+		{`value == 1`, []string{"Airplane Mode"}},
+		{`value == nil AND (name == 'General' || name == 'Privacy')`, []string{"General", "Privacy"}},
+		{`name != 'General' AND type != 'XCUIElementTypeWindow'`, []string{"Privacy", "Airplane Mode"}},
+		{`FALSEPREDICATE`, nil},
+	}
+	for _, tt := range tests {
+		pr, err := CompilePredicate(tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		var got []string
+		for _, n := range pr.Select(h) {
+			got = append(got, n.Name)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: got %q, want %q", tt.expr, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("%s: got %q, want %q", tt.expr, got, tt.want)
+			}
+		}
+	}
+
+	if nodes := (&Predicate{expr: predicateConst(true)}).Select(h); len(nodes) != 4 {
+		t.Fatalf("TRUEPREDICATE selected %d nodes, the root is not searched", len(nodes))
+	}
+
+	for _, expr := range []string{``, `name ==`, `name == 'x`, `unknown == 1`, `name 'x'`, `(name == 'x'`, `name LIKE label`, `name ==[x] 'y'`} {
+		if _, err := CompilePredicate(expr); err == nil {
+			t.Fatalf("%q: expected an error", expr)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package gwda
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func TestProxyServer(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+	fake.SetUI(&wdatest.Element{Type: "Application", Width: 390, Height: 844, Children: []*wdatest.Element{
+		{Type: "Button", Name: "Login", X: 10, Y: 10, Width: 100, Height: 40},
+	}})
+	frame := newTestJPEG(t, color.RGBA{R: 255, A: 255})
+	mjpeg := newTestMjpegServer(t, [][]byte{frame}, true, true)
+
+	const serial = "00008030-0001"
+	proxy := NewProxyServer(WithProxyToken("secret"))
+	proxy.Add(newFakeDevice(serial, map[int]string{
+		defaultPort:      strings.TrimPrefix(fake.URL, "http://"),
+		defaultMjpegPort: strings.TrimPrefix(mjpeg.URL, "http://"),
+	}))
+	srv := httptest.NewServer(proxy)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	driver, err := NewDriver(nil, "http://gwda:secret@"+host+"/"+serial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	element, err := driver.FindElement(BySelector{Name: "Login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = element.Click(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = driver.FindElement(BySelector{Name: "missing"}); !errors.Is(err, ErrNoSuchElement) {
+		t.Fatalf("expected no such element, got %v", err)
+	}
+
+	stream, err := driver.MjpegStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received := <-stream.Frames(); !bytes.Equal(received.Data, frame) {
+		t.Error("frame mismatch")
+	}
+	_ = stream.Close()
+
+	if _, err = NewDriver(nil, "http://gwda:wrong@"+host+"/"+serial); err == nil || !strings.Contains(err.Error(), "unauthorized") {
+		t.Errorf("expected unauthorized, got %v", err)
+	}
+	if _, err = NewDriver(nil, "http://gwda:secret@"+host+"/unknown"); err == nil || !strings.Contains(err.Error(), "not attached") {
+		t.Errorf("expected an unknown device, got %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list struct{ Value []string }
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Value) != 1 || list.Value[0] != serial {
+		t.Errorf("unexpected devices %v", list.Value)
+	}
+
+	proxy.Remove(serial)
+	if serials := proxy.SerialNumbers(); len(serials) != 0 {
+		t.Errorf("unexpected devices %v", serials)
+	}
+}
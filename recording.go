@@ -0,0 +1,395 @@
+package gwda
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image/jpeg"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultRecordingFrameRate is the time base of AVI recordings without a frame rate cap.
+const defaultRecordingFrameRate = 30
+
+const recordingManifestName = "manifest.json"
+
+type recordingFormat int
+
+const (
+	recordingFormatAVI recordingFormat = iota
+	recordingFormatFrames
+)
+
+type RecordingOption struct {
+	format       recordingFormat
+	maxDuration  time.Duration
+	maxFrameRate float64
+}
+
+func NewRecordingOption() RecordingOption {
+	return RecordingOption{}
+}
+
+// WithFormatAsAVI Motion-JPEG AVI file, the default
+func (opt RecordingOption) WithFormatAsAVI() RecordingOption {
+	opt.format = recordingFormatAVI
+	return opt
+}
+
+// WithFormatAsFrames directory of numbered JPEG files,
+// along with a manifest.json holding the time of every frame
+func (opt RecordingOption) WithFormatAsFrames() RecordingOption {
+	opt.format = recordingFormatFrames
+	return opt
+}
+
+// WithMaxDuration stops the recording after d
+func (opt RecordingOption) WithMaxDuration(d time.Duration) RecordingOption {
+	opt.maxDuration = d
+	return opt
+}
+
+// WithMaxFrameRate discards frames exceeding fps frames per second
+func (opt RecordingOption) WithMaxFrameRate(fps float64) RecordingOption {
+	opt.maxFrameRate = fps
+	return opt
+}
+
+type frameWriter interface {
+	// WriteFrame writes frame, which is shown from the given slot of the time base on.
+	WriteFrame(frame MjpegFrame, slot int) error
+	Close() error
+}
+
+type recorder struct {
+	writer    frameWriter
+	stream    *MjpegStream
+	timer     *time.Timer
+	frameRate float64
+
+	firstFrame time.Time
+	lastSlot   int
+	err        error
+
+	ready chan struct{}
+	once  sync.Once
+	done  chan struct{}
+}
+
+func newRecorder(path string, opt RecordingOption) (rec *recorder, err error) {
+	if opt.maxFrameRate < 0 || math.IsNaN(opt.maxFrameRate) || math.IsInf(opt.maxFrameRate, 0) {
+		return nil, fmt.Errorf("invalid frame rate: %v", opt.maxFrameRate)
+	}
+	rec = &recorder{frameRate: opt.maxFrameRate, lastSlot: -1, ready: make(chan struct{}), done: make(chan struct{})}
+	switch opt.format {
+	case recordingFormatFrames:
+		rec.writer, err = newFramesWriter(path, opt.maxFrameRate)
+	default:
+		if rec.frameRate == 0 {
+			rec.frameRate = defaultRecordingFrameRate
+		}
+		rec.writer, err = newAVIWriter(path, rec.frameRate)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// start records the MJPEG stream of wd until finish is called or maxDuration elapsed.
+func (rec *recorder) start(wd *remoteWD, maxDuration time.Duration) (err error) {
+	if rec.stream, err = wd.MjpegStream(WithMjpegFrameHandler(rec.handleFrame)); err != nil {
+		_ = rec.writer.Close()
+		return err
+	}
+	if maxDuration > 0 {
+		rec.timer = time.AfterFunc(maxDuration, rec.finish)
+	}
+	close(rec.ready)
+
+	go func() {
+		<-rec.stream.Done()
+		rec.finish()
+	}()
+	return nil
+}
+
+// handleFrame runs on the reading goroutine of the stream.
+func (rec *recorder) handleFrame(frame MjpegFrame) {
+	if rec.err != nil {
+		return
+	}
+	if rec.firstFrame.IsZero() {
+		rec.firstFrame = frame.Timestamp
+	}
+
+	slot := rec.lastSlot + 1
+	if rec.frameRate > 0 {
+		slot = int(math.Round(frame.Timestamp.Sub(rec.firstFrame).Seconds() * rec.frameRate))
+		if slot <= rec.lastSlot {
+			return
+		}
+	}
+	if rec.err = rec.writer.WriteFrame(frame, slot); rec.err != nil {
+		// Close of the stream waits for this handler to return
+		go rec.finish()
+		return
+	}
+	rec.lastSlot = slot
+}
+
+// finish stops the stream and completes the file, it is safe to call more than once.
+func (rec *recorder) finish() {
+	<-rec.ready
+	rec.once.Do(func() {
+		if rec.timer != nil {
+			rec.timer.Stop()
+		}
+		_ = rec.stream.Close()
+		err := rec.writer.Close()
+		if rec.err == nil {
+			rec.err = rec.stream.Err()
+		}
+		if rec.err == nil {
+			rec.err = err
+		}
+		close(rec.done)
+	})
+	<-rec.done
+}
+
+// aviWriter writes a Motion-JPEG AVI with a constant time base,
+// slots without a new frame get an empty chunk, which repeats the previous frame.
+type aviWriter struct {
+	file      *os.File
+	frameRate float64
+
+	width, height int
+	maxChunkSize  int
+	slots         int
+	moviSize      int
+	index         bytes.Buffer
+}
+
+const (
+	aviHeaderSize = 224
+
+	aviHasIndex = 0x10
+	aviKeyFrame = 0x10
+)
+
+func newAVIWriter(path string, frameRate float64) (w *aviWriter, err error) {
+	w = &aviWriter{frameRate: frameRate, moviSize: 4}
+	if w.file, err = os.Create(path); err != nil {
+		return nil, err
+	}
+	if _, err = w.file.Write(make([]byte, aviHeaderSize)); err != nil {
+		_ = w.file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *aviWriter) WriteFrame(frame MjpegFrame, slot int) error {
+	if w.width == 0 {
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(frame.Data))
+		if err != nil {
+			return fmt.Errorf("recording: decode frame %d: %w", frame.Seq, err)
+		}
+		w.width, w.height = cfg.Width, cfg.Height
+	}
+	for w.slots < slot {
+		if err := w.writeChunk(nil); err != nil {
+			return err
+		}
+	}
+	return w.writeChunk(frame.Data)
+}
+
+func (w *aviWriter) writeChunk(data []byte) error {
+	var flags uint32
+	if len(data) != 0 {
+		flags = aviKeyFrame
+	}
+	_ = binary.Write(&w.index, binary.LittleEndian, struct {
+		ID            [4]byte
+		Flags, Offset uint32
+		Size          uint32
+	}{fourCC("00dc"), flags, uint32(w.moviSize), uint32(len(data))})
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) + 9)
+	buf.WriteString("00dc")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if len(data)%2 == 1 {
+		buf.WriteByte(0)
+	}
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	w.moviSize += buf.Len()
+	w.slots++
+	if len(data) > w.maxChunkSize {
+		w.maxChunkSize = len(data)
+	}
+	return nil
+}
+
+func (w *aviWriter) Close() (err error) {
+	defer func() {
+		if e := w.file.Close(); err == nil {
+			err = e
+		}
+	}()
+
+	var idx bytes.Buffer
+	idx.WriteString("idx1")
+	_ = binary.Write(&idx, binary.LittleEndian, uint32(w.index.Len()))
+	idx.Write(w.index.Bytes())
+	if _, err = w.file.Write(idx.Bytes()); err != nil {
+		return err
+	}
+
+	fileSize := aviHeaderSize - 8 + w.moviSize - 4 + idx.Len()
+	_, err = w.file.WriteAt(w.header(fileSize), 0)
+	return err
+}
+
+func (w *aviWriter) header(riffSize int) []byte {
+	type rect struct{ Left, Top, Right, Bottom int16 }
+	scale := uint32(1000)
+	rate := uint32(math.Round(w.frameRate * float64(scale)))
+	width, height := uint32(w.width), uint32(w.height)
+
+	var buf bytes.Buffer
+	write := func(data ...interface{}) {
+		for _, d := range data {
+			if s, ok := d.(string); ok {
+				buf.WriteString(s)
+				continue
+			}
+			_ = binary.Write(&buf, binary.LittleEndian, d)
+		}
+	}
+
+	write("RIFF", uint32(riffSize), "AVI ")
+	write("LIST", uint32(192), "hdrl")
+	write("avih", uint32(56), struct {
+		MicroSecPerFrame, MaxBytesPerSec, PaddingGranularity, Flags uint32
+		TotalFrames, InitialFrames, Streams, SuggestedBufferSize    uint32
+		Width, Height                                               uint32
+		Reserved                                                    [4]uint32
+	}{
+		MicroSecPerFrame:    uint32(math.Round(1e6 / w.frameRate)),
+		MaxBytesPerSec:      uint32(math.Min(float64(w.maxChunkSize)*w.frameRate, math.MaxUint32)),
+		Flags:               aviHasIndex,
+		TotalFrames:         uint32(w.slots),
+		Streams:             1,
+		SuggestedBufferSize: uint32(w.maxChunkSize),
+		Width:               width,
+		Height:              height,
+	})
+	write("LIST", uint32(116), "strl")
+	write("strh", uint32(56), struct {
+		Type, Handler                  [4]byte
+		Flags                          uint32
+		Priority, Language             uint16
+		InitialFrames, Scale, Rate     uint32
+		Start, Length, SuggestedBuffer uint32
+		Quality, SampleSize            uint32
+		Frame                          rect
+	}{
+		Type:            fourCC("vids"),
+		Handler:         fourCC("MJPG"),
+		Scale:           scale,
+		Rate:            rate,
+		Length:          uint32(w.slots),
+		SuggestedBuffer: uint32(w.maxChunkSize),
+		Quality:         math.MaxUint32,
+		Frame:           rect{Right: int16(w.width), Bottom: int16(w.height)},
+	})
+	write("strf", uint32(40), struct {
+		Size                         uint32
+		Width, Height                int32
+		Planes, BitCount             uint16
+		Compression                  [4]byte
+		SizeImage                    uint32
+		XPelsPerMeter, YPelsPerMeter int32
+		ClrUsed, ClrImportant        uint32
+	}{
+		Size:        40,
+		Width:       int32(w.width),
+		Height:      int32(w.height),
+		Planes:      1,
+		BitCount:    24,
+		Compression: fourCC("MJPG"),
+		SizeImage:   width * height * 3,
+	})
+	write("LIST", uint32(w.moviSize), "movi")
+	return buf.Bytes()
+}
+
+func fourCC(s string) (cc [4]byte) {
+	copy(cc[:], s)
+	return
+}
+
+// framesWriter writes every frame to a numbered JPEG file and their times to the manifest.
+type framesWriter struct {
+	dir      string
+	manifest recordingManifest
+}
+
+type recordingManifest struct {
+	StartedAt    time.Time               `json:"startedAt"`
+	Duration     float64                 `json:"duration"`
+	MaxFrameRate float64                 `json:"maxFrameRate,omitempty"`
+	Frames       []recordingManifestItem `json:"frames"`
+}
+
+type recordingManifestItem struct {
+	File      string    `json:"file"`
+	Timestamp time.Time `json:"timestamp"`
+	// Offset is the time since the first frame in seconds.
+	Offset float64 `json:"offset"`
+}
+
+func newFramesWriter(dir string, maxFrameRate float64) (*framesWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &framesWriter{
+		dir:      dir,
+		manifest: recordingManifest{MaxFrameRate: maxFrameRate, Frames: []recordingManifestItem{}},
+	}, nil
+}
+
+func (w *framesWriter) WriteFrame(frame MjpegFrame, _ int) error {
+	if len(w.manifest.Frames) == 0 {
+		w.manifest.StartedAt = frame.Timestamp
+	}
+	name := fmt.Sprintf("frame-%06d.jpg", len(w.manifest.Frames)+1)
+	if err := ioutil.WriteFile(filepath.Join(w.dir, name), frame.Data, 0o644); err != nil {
+		return err
+	}
+	offset := frame.Timestamp.Sub(w.manifest.StartedAt).Seconds()
+	w.manifest.Frames = append(w.manifest.Frames, recordingManifestItem{File: name, Timestamp: frame.Timestamp, Offset: offset})
+	w.manifest.Duration = offset
+	return nil
+}
+
+func (w *framesWriter) Close() error {
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(w.dir, recordingManifestName), data, 0o644)
+}
@@ -0,0 +1,152 @@
+package gwda
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"image/color"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestRecordingDriver(t *testing.T) *remoteWD {
+	srv := newTestMjpegServer(t, [][]byte{newTestJPEG(t, color.White), newTestJPEG(t, color.Black)}, true, true)
+	wd := newTestDriver(t, http.NotFoundHandler())
+	wd.mjpegClient = http.DefaultClient
+	wd.mjpegURL = srv.URL
+	return wd
+}
+
+// checkAVI verifies the chunk sizes of an AVI file and returns its index entries.
+func checkAVI(t *testing.T, path string) (width, height, frames int, index [][4]uint32) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "AVI " {
+		t.Fatalf("not an AVI file: %q", data[:12])
+	}
+	if size := int(le.Uint32(data[4:])); size != len(data)-8 {
+		t.Fatalf("RIFF size %d, file size %d", size, len(data))
+	}
+	if string(data[212:216]) != "LIST" || string(data[220:224]) != "movi" {
+		t.Fatalf("movi list not found: %q", data[212:224])
+	}
+
+	width, height = int(le.Uint32(data[64:])), int(le.Uint32(data[68:]))
+	frames = int(le.Uint32(data[48:]))
+
+	idx := 216 + 4 + int(le.Uint32(data[216:]))
+	if string(data[idx:idx+4]) != "idx1" {
+		t.Fatalf("idx1 not found at %d: %q", idx, data[idx:idx+4])
+	}
+	entries := data[idx+8:]
+	if len(entries) != int(le.Uint32(data[idx+4:])) {
+		t.Fatalf("idx1 size %d, remaining %d", le.Uint32(data[idx+4:]), len(entries))
+	}
+	for ; len(entries) >= 16; entries = entries[16:] {
+		entry := [4]uint32{le.Uint32(entries), le.Uint32(entries[4:]), le.Uint32(entries[8:]), le.Uint32(entries[12:])}
+		chunk := 220 + int(entry[2])
+		if string(data[chunk:chunk+4]) != "00dc" || le.Uint32(data[chunk+4:]) != entry[3] {
+			t.Fatalf("index entry %v does not match chunk %q", entry, data[chunk:chunk+8])
+		}
+		index = append(index, entry)
+	}
+	return
+}
+
+func Test_aviWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "screen.avi")
+	w, err := newAVIWriter(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jpg := newTestJPEG(t, color.White)
+	for _, slot := range []int{0, 3, 4} {
+		if err = w.WriteFrame(MjpegFrame{Data: jpg}, slot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	width, height, frames, index := checkAVI(t, path)
+	if width != 8 || height != 8 {
+		t.Fatalf("got size %dx%d", width, height)
+	}
+	if frames != 5 || len(index) != 5 {
+		t.Fatalf("got %d frames and %d index entries, want 5", frames, len(index))
+	}
+	for i, entry := range index {
+		if empty := entry[3] == 0; empty != (i == 1 || i == 2) {
+			t.Fatalf("index entry %d: size %d", i, entry[3])
+		}
+	}
+}
+
+func Test_remoteWD_Recording(t *testing.T) {
+	wd := newTestRecordingDriver(t)
+	dir := filepath.Join(t.TempDir(), "frames")
+
+	if err := wd.StartRecording(dir, NewRecordingOption().WithFormatAsFrames().WithMaxFrameRate(50)); err != nil {
+		t.Fatal(err)
+	}
+	if err := wd.StartRecording(dir); err == nil {
+		t.Fatal("expected an error starting a second recording")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := wd.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+	if err := wd.StopRecording(); err == nil {
+		t.Fatal("expected an error without recording")
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, recordingManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest recordingManifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(manifest.Frames); n < 2 || n > 12 {
+		t.Fatalf("got %d frames in 200ms at 50 fps max", n)
+	}
+	for i, frame := range manifest.Frames {
+		if _, err = os.Stat(filepath.Join(dir, frame.File)); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && frame.Offset <= manifest.Frames[i-1].Offset {
+			t.Fatalf("frame %d: offset %v after %v", i, frame.Offset, manifest.Frames[i-1].Offset)
+		}
+	}
+}
+
+func Test_remoteWD_Recording_MaxDuration(t *testing.T) {
+	wd := newTestRecordingDriver(t)
+	path := filepath.Join(t.TempDir(), "screen.avi")
+
+	if err := wd.StartRecording(path, NewRecordingOption().WithMaxDuration(100*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-wd.recorder.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("recording did not stop")
+	}
+	if err := wd.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, frames, index := checkAVI(t, path)
+	if frames == 0 || frames != len(index) {
+		t.Fatalf("got %d frames and %d index entries", frames, len(index))
+	}
+}
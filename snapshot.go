@@ -0,0 +1,189 @@
+package gwda
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// snapshotCache holds the Hierarchy reused by the local queries.
+type snapshotCache struct {
+	mu        sync.Mutex
+	hierarchy *Hierarchy
+	takenAt   time.Time
+	// generation is increased by every invalidation, so a snapshot taken
+	// while the screen was changed is not cached
+	generation uint64
+}
+
+// WithLocalQueries Evaluates the XPath and Predicate selectors of FindElement and FindElements
+// against a snapshot of Source instead of letting WDA evaluate them, which is slow on big trees.
+// The matches are resolved to elements by their UID if the source reports one, by a class chain otherwise.
+//
+// A snapshot is reused for at most maxAge, and dropped by InvalidateSnapshot and by every request
+// which may change the screen, that is any request but GET requests and element lookups.
+// Elements found in a reused snapshot are checked against their current frame,
+// if it moved the lookup is repeated with a new snapshot.
+func WithLocalQueries(maxAge time.Duration) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.localQueries = true
+		opts.snapshotMaxAge = maxAge
+	})
+}
+
+func (wd *remoteWD) InvalidateSnapshot() {
+	wd.snapshot.mu.Lock()
+	defer wd.snapshot.mu.Unlock()
+	wd.snapshot.hierarchy = nil
+	wd.snapshot.generation++
+}
+
+// currentSnapshot returns the cached snapshot if it is younger than maxAge, otherwise a new one,
+// reused reports whether the snapshot was taken before this call.
+func (wd *remoteWD) currentSnapshot(maxAge time.Duration) (h *Hierarchy, reused bool, err error) {
+	s := &wd.snapshot
+	s.mu.Lock()
+	if s.hierarchy != nil && time.Since(s.takenAt) <= maxAge {
+		h = s.hierarchy
+		s.mu.Unlock()
+		return h, true, nil
+	}
+	generation := s.generation
+	s.mu.Unlock()
+
+	takenAt := time.Now()
+	if h, err = wd.Hierarchy(); err != nil {
+		return nil, false, err
+	}
+
+	s.mu.Lock()
+	if s.generation == generation {
+		s.hierarchy, s.takenAt = h, takenAt
+	}
+	s.mu.Unlock()
+	return h, false, nil
+}
+
+func (wd *remoteWD) FindNodes(by BySelector) (nodes []*Node, err error) {
+	using, value := by.getUsingAndValue()
+	var query func(h *Hierarchy) ([]*Node, error)
+	if query, err = compileLocalQuery(using, value); err != nil {
+		return nil, err
+	}
+	var h *Hierarchy
+	if h, _, err = wd.currentSnapshot(wd.options.snapshotMaxAge); err != nil {
+		return nil, err
+	}
+	return query(h)
+}
+
+func (wd *remoteWD) queriesLocally(using string) bool {
+	return wd.options.localQueries && (using == "xpath" || using == "predicate string")
+}
+
+func compileLocalQuery(using, value string) (func(h *Hierarchy) ([]*Node, error), error) {
+	switch using {
+	case "xpath":
+		x, err := CompileXPath(value)
+		if err != nil {
+			return nil, err
+		}
+		return x.Select, nil
+	case "predicate string":
+		pr, err := CompilePredicate(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(h *Hierarchy) ([]*Node, error) { return pr.Select(h), nil }, nil
+	}
+	return nil, fmt.Errorf("using '%s' cannot be evaluated locally, only xpath and predicate string", using)
+}
+
+// findLocal evaluates the query against the snapshot and resolves the matches to elements,
+// with first set only the first match is resolved.
+func (wd *remoteWD) findLocal(using, value string, first bool) (elements []WebElement, err error) {
+	var query func(h *Hierarchy) ([]*Node, error)
+	if query, err = compileLocalQuery(using, value); err != nil {
+		return nil, err
+	}
+
+	maxAge := wd.options.snapshotMaxAge
+	for {
+		var h *Hierarchy
+		var reused bool
+		if h, reused, err = wd.currentSnapshot(maxAge); err != nil {
+			return nil, err
+		}
+		var nodes []*Node
+		if nodes, err = query(h); err != nil {
+			return nil, err
+		}
+		if first && len(nodes) > 1 {
+			nodes = nodes[:1]
+		}
+
+		stale := false
+		elements = make([]WebElement, 0, len(nodes))
+		for _, n := range nodes {
+			var we *remoteWE
+			if we, err = wd.resolveNode(n); err == nil && reused {
+				var moved bool
+				if moved, err = wd.elementMoved(we, n); err == nil && moved {
+					err = ErrStaleElementReference
+				}
+			}
+			if err != nil {
+				if reused && (errors.Is(err, ErrNoSuchElement) || errors.Is(err, ErrStaleElementReference)) {
+					stale = true
+					break
+				}
+				return nil, err
+			}
+			elements = append(elements, we)
+		}
+		if !stale {
+			return elements, nil
+		}
+		// the screen changed since the snapshot was taken, a new one is not checked again
+		wd.InvalidateSnapshot()
+		maxAge = -1
+	}
+}
+
+// resolveNode looks up the element of n by its UID or class chain.
+func (wd *remoteWD) resolveNode(n *Node) (*remoteWE, error) {
+	var by BySelector
+	switch {
+	case n.Attributes["UID"] != "":
+		by.LinkText = NewElementAttribute().WithUID(n.Attributes["UID"])
+	case n.Parent == nil:
+		return nil, errors.New("the root element cannot be resolved by a class chain")
+	default:
+		by.ClassChain = n.ClassChain()
+	}
+	element, err := wd.FindElement(by)
+	if err != nil {
+		return nil, err
+	}
+	return element.(*remoteWE), nil
+}
+
+// elementMoved reports whether the frame of the element differs from the one in the snapshot.
+func (wd *remoteWD) elementMoved(we *remoteWE, n *Node) (moved bool, err error) {
+	var rawResp rawResponse
+	if rawResp, err = wd.executeGet("Element.Rect", "/session", wd.sessionID(), "/element", we.id, "/rect"); err != nil {
+		return false, err
+	}
+	var reply = new(struct {
+		Value struct{ X, Y, Width, Height float64 }
+	})
+	if err = json.Unmarshal(rawResp, reply); err != nil {
+		return false, err
+	}
+	differs := func(a float64, b int) bool { return math.Abs(a-float64(b)) > 1 }
+	r := reply.Value
+	return differs(r.X, n.Rect.X) || differs(r.Y, n.Rect.Y) || differs(r.Width, n.Rect.Width) || differs(r.Height, n.Rect.Height), nil
+}
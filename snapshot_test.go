@@ -0,0 +1,131 @@
+package gwda
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_remoteWD_LocalQueries(t *testing.T) {
+	var mu sync.Mutex
+	var sourceRequests, rectRequests int
+	var lookups []string
+	rects := map[string]map[string]float64{
+		"XCUIElementTypeWindow[1]/XCUIElementTypeButton[1]": {"x": 16, "y": 100, "width": 358, "height": 44},
+		"XCUIElementTypeWindow[1]/XCUIElementTypeButton[2]": {"x": 16, "y": 144.5, "width": 358, "height": 44},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/session/test-session/source", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sourceRequests++
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"value":"` + strings.NewReplacer(`"`, `\"`, "\n", `\n`).Replace(testXMLSource) + `"}`))
+	})
+	mux.HandleFunc("/session/test-session/element", func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&data)
+		mu.Lock()
+		lookups = append(lookups, data["using"]+": "+data["value"])
+		mu.Unlock()
+		if data["using"] != "class chain" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"value": map[string]string{"ELEMENT": data["value"]}})
+	})
+	mux.HandleFunc("/session/test-session/element/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/session/test-session/element/"), "/rect")
+		mu.Lock()
+		rectRequests++
+		rect := rects[id]
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"value": rect})
+	})
+	mux.HandleFunc("/session/test-session/wda/tap/0", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"value":null}`))
+	})
+	wd := newTestDriver(t, mux)
+	wd.options = newDriverOptions([]DriverOption{WithLocalQueries(time.Minute)})
+
+	check := func(wantSources, wantRects int, wantLookups ...string) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if sourceRequests != wantSources || rectRequests != wantRects {
+			t.Fatalf("got %d source and %d rect requests, want %d and %d", sourceRequests, rectRequests, wantSources, wantRects)
+		}
+		if strings.Join(lookups, "; ") != strings.Join(wantLookups, "; ") {
+			t.Fatalf("got lookups %q, want %q", lookups, wantLookups)
+		}
+		lookups = nil
+	}
+
+	// a fresh snapshot, the element is not checked
+	element, err := wd.FindElement(BySelector{XPath: "//XCUIElementTypeButton[@name='Privacy']"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := element.(*remoteWE).id; id != "XCUIElementTypeWindow[1]/XCUIElementTypeButton[2]" {
+		t.Fatalf("unexpected element %s", id)
+	}
+	check(1, 0, "class chain: XCUIElementTypeWindow[1]/XCUIElementTypeButton[2]")
+
+	// the snapshot is reused, the elements are checked
+	elements, err := wd.FindElements(BySelector{Predicate: "type == 'XCUIElementTypeButton'"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elements) != 2 {
+		t.Fatalf("got %d elements, want 2", len(elements))
+	}
+	check(1, 2, "class chain: XCUIElementTypeWindow[1]/XCUIElementTypeButton[1]", "class chain: XCUIElementTypeWindow[1]/XCUIElementTypeButton[2]")
+
+	// the element moved, the lookup is repeated with a new snapshot
+	mu.Lock()
+	rects["XCUIElementTypeWindow[1]/XCUIElementTypeButton[1]"]["y"] = 300
+	mu.Unlock()
+	if _, err = wd.FindElement(BySelector{Predicate: "name == 'General'"}); err != nil {
+		t.Fatal(err)
+	}
+	check(2, 3, "class chain: XCUIElementTypeWindow[1]/XCUIElementTypeButton[1]", "class chain: XCUIElementTypeWindow[1]/XCUIElementTypeButton[1]")
+
+	// no match and no request
+	if _, err = wd.FindElement(BySelector{XPath: "//XCUIElementTypeCell"}); !errors.Is(err, ErrNoSuchElement) {
+		t.Fatalf("got %v, want %v", err, ErrNoSuchElement)
+	}
+	if elements, err = wd.FindElements(BySelector{XPath: "//XCUIElementTypeCell"}); err != nil || len(elements) != 0 {
+		t.Fatalf("got %v, %v, want no elements", elements, err)
+	}
+	check(2, 3)
+
+	// a tap invalidates the snapshot
+	if err = wd.Tap(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	nodes, err := wd.FindNodes(BySelector{XPath: "//XCUIElementTypeSwitch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].Name != "Airplane Mode" {
+		t.Fatalf("unexpected nodes %v", nodes)
+	}
+	check(3, 3)
+
+	wd.InvalidateSnapshot()
+	if _, err = wd.FindNodes(BySelector{Predicate: "name == 'General'"}); err != nil {
+		t.Fatal(err)
+	}
+	check(4, 3)
+
+	if _, err = wd.FindNodes(BySelector{ClassChain: "**/XCUIElementTypeButton"}); err == nil {
+		t.Fatal("expected an error for a class chain")
+	}
+	if _, err = wd.FindElement(BySelector{XPath: "//XCUIElementTypeButton["}); err == nil {
+		t.Fatal("expected an error for an invalid xpath")
+	}
+}
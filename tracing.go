@@ -0,0 +1,205 @@
+package gwda
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer starts spans, the tracer of OpenTelemetry fits with a small adapter:
+//
+//	type otelTracer struct{ trace.Tracer }
+//
+//	func (t otelTracer) Start(ctx context.Context, name string) (context.Context, gwda.Span) {
+//		ctx, span := t.Tracer.Start(ctx, name)
+//		return ctx, otelSpan{span}
+//	}
+//
+//	type otelSpan struct{ trace.Span }
+//
+//	func (s otelSpan) SetAttribute(key string, value interface{}) {
+//		s.Span.SetAttributes(attribute.String(key, fmt.Sprint(value)))
+//	}
+//
+//	func (s otelSpan) RecordError(err error) {
+//		s.Span.RecordError(err)
+//		s.Span.SetStatus(codes.Error, err.Error())
+//	}
+//
+//	func (s otelSpan) End() { s.Span.End() }
+type Tracer interface {
+	// Start starts a span which is a child of the span in ctx if any,
+	// the returned context holds the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is an operation started by a Tracer.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// WithTracer starts a span for every request of the driver, named after the command, e.g. "gwda.FindElement".
+// The spans are children of the span in the context of the driver, see WebDriver.WithContext,
+// and carry the attributes
+//
+//	gwda.command     the name of the command, see Command
+//	gwda.device      the serial number of a USB driver, or the host of WDA
+//	gwda.selector    the selector of the lookups, e.g. "name=Login"
+//	gwda.element_id  the id of the element of element commands
+//	gwda.x, gwda.y   the coordinates of gestures, or gwda.from_x, gwda.from_y, gwda.to_x and gwda.to_y
+//	gwda.error_code  the W3C error code reported by WDA on failure
+func WithTracer(tracer Tracer) DriverOption {
+	return driverOptionFunc(func(opts *driverOptions) {
+		opts.tracer = tracer
+	})
+}
+
+// tracingMiddleware runs the commands passing through it in spans.
+func tracingMiddleware(tracer Tracer, device string) Middleware {
+	return func(next CommandHandler) CommandHandler {
+		return func(cmd *Command) ([]byte, error) {
+			name := cmd.Name
+			if name == "" {
+				name = cmd.Method + " " + commandPath(cmd.URL)
+			}
+			ctx, span := tracer.Start(cmd.Context, "gwda."+name)
+			defer span.End()
+			cmd.Context = ctx
+
+			span.SetAttribute("gwda.command", name)
+			span.SetAttribute("gwda.device", device)
+			setCommandAttributes(span, cmd)
+
+			response, err := next(cmd)
+			if err != nil {
+				var wdaErr *WDAError
+				if errors.As(err, &wdaErr) && wdaErr.Code != "" {
+					span.SetAttribute("gwda.error_code", wdaErr.Code)
+				}
+				span.RecordError(err)
+			}
+			return response, err
+		}
+	}
+}
+
+// setCommandAttributes sets the selector, element id and coordinates found in the request.
+func setCommandAttributes(span Span, cmd *Command) {
+	segments := strings.Split(commandPath(cmd.URL), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i] == "element" && segments[i+1] != "active" {
+			span.SetAttribute("gwda.element_id", segments[i+1])
+			break
+		}
+	}
+
+	var data map[string]interface{}
+	if len(cmd.Body) == 0 || json.Unmarshal(cmd.Body, &data) != nil {
+		return
+	}
+	using, okUsing := data["using"].(string)
+	value, okValue := data["value"].(string)
+	if okUsing && okValue {
+		span.SetAttribute("gwda.selector", using+"="+value)
+	}
+	for _, key := range []string{"x", "y", "fromX", "fromY", "toX", "toY"} {
+		if v, ok := data[key].(float64); ok {
+			span.SetAttribute("gwda."+coordinateAttributes[key], v)
+		}
+	}
+}
+
+var coordinateAttributes = map[string]string{
+	"x": "x", "y": "y", "fromX": "from_x", "fromY": "from_y", "toX": "to_x", "toY": "to_y",
+}
+
+func commandPath(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Path
+	}
+	return rawURL
+}
+
+// SpanRecorder is a Tracer keeping the spans in memory, e.g. to assert on them in tests.
+type SpanRecorder struct {
+	mu     sync.Mutex
+	nextID int
+	spans  []*RecordedSpan
+}
+
+// RecordedSpan is a span started by a SpanRecorder.
+type RecordedSpan struct {
+	// ID is unique among the spans of the recorder, ParentID is 0 for root spans
+	ID             int
+	ParentID       int
+	Name           string
+	Attributes     map[string]interface{}
+	Err            error
+	Started, Ended time.Time
+
+	recorder *SpanRecorder
+}
+
+type recordedSpanKey struct{}
+
+// NewSpanRecorder creates a recorder without spans.
+func NewSpanRecorder() *SpanRecorder {
+	return new(SpanRecorder)
+}
+
+func (r *SpanRecorder) Start(ctx context.Context, name string) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	span := &RecordedSpan{ID: r.nextID, Name: name, Attributes: make(map[string]interface{}), Started: time.Now(), recorder: r}
+	if parent, ok := ctx.Value(recordedSpanKey{}).(*RecordedSpan); ok {
+		span.ParentID = parent.ID
+	}
+	r.spans = append(r.spans, span)
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+// Spans returns copies of the spans ended so far, in the order they were started.
+func (r *SpanRecorder) Spans() []RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var spans []RecordedSpan
+	for _, span := range r.spans {
+		if span.Ended.IsZero() {
+			continue
+		}
+		copied := *span
+		copied.Attributes = make(map[string]interface{}, len(span.Attributes))
+		for k, v := range span.Attributes {
+			copied.Attributes[k] = v
+		}
+		spans = append(spans, copied)
+	}
+	return spans
+}
+
+func (s *RecordedSpan) SetAttribute(key string, value interface{}) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+func (s *RecordedSpan) RecordError(err error) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.Err = err
+}
+
+func (s *RecordedSpan) End() {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	if s.Ended.IsZero() {
+		s.Ended = time.Now()
+	}
+}
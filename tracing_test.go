@@ -0,0 +1,70 @@
+package gwda
+
+import (
+	"context"
+	"testing"
+
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func TestWithTracer(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+	fake.SetUI(&wdatest.Element{Type: "Application", Width: 390, Height: 844, Children: []*wdatest.Element{
+		{Type: "Button", Name: "Login", X: 10, Y: 10, Width: 100, Height: 40},
+	}})
+
+	recorder := NewSpanRecorder()
+	driver, err := NewDriverWithOptions(nil, fake.URL, WithTracer(recorder), WithKeepAlive(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := recorder.Start(context.Background(), "login test")
+	traced := driver.WithContext(ctx)
+	element, err := traced.FindElement(BySelector{Name: "Login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = element.Click(); err != nil {
+		t.Fatal(err)
+	}
+	if err = traced.Tap(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = traced.FindElement(BySelector{Name: "missing"}); err == nil {
+		t.Fatal("expected no such element")
+	}
+	parent.End()
+
+	spans := recorder.Spans()
+	// the session of NewDriver, the four commands and the parent
+	if len(spans) != 6 {
+		t.Fatalf("%d spans recorded: %v", len(spans), spans)
+	}
+	if spans[0].Name != "gwda.NewSession" || spans[0].ParentID != 0 {
+		t.Errorf("unexpected span %+v", spans[0])
+	}
+	for _, span := range spans[2:] {
+		if span.ParentID != spans[1].ID {
+			t.Errorf("span %s is not a child of %s", span.Name, spans[1].Name)
+		}
+		if span.Attributes["gwda.device"] != fake.URL[len("http://"):] {
+			t.Errorf("device %v", span.Attributes["gwda.device"])
+		}
+	}
+
+	find, click, tap, missing := spans[2], spans[3], spans[4], spans[5]
+	if find.Name != "gwda.FindElement" || find.Attributes["gwda.selector"] != "name=Login" || find.Err != nil {
+		t.Errorf("unexpected span %+v", find)
+	}
+	if click.Name != "gwda.Element.Click" || click.Attributes["gwda.element_id"] != element.(*remoteWE).id {
+		t.Errorf("unexpected span %+v", click)
+	}
+	if tap.Name != "gwda.Tap" || tap.Attributes["gwda.x"] != float64(1) || tap.Attributes["gwda.y"] != float64(2) {
+		t.Errorf("unexpected span %+v", tap)
+	}
+	if missing.Err == nil || missing.Attributes["gwda.error_code"] != "no such element" {
+		t.Errorf("unexpected span %+v", missing)
+	}
+}
@@ -0,0 +1,710 @@
+// Package wdatest provides a fake WebDriverAgent for hermetic tests of code built on gwda.
+//
+//	fake := wdatest.NewServer()
+//	defer fake.Close()
+//	fake.SetUI(&wdatest.Element{Type: "Application", Name: "Demo", Width: 390, Height: 844, Children: []*wdatest.Element{
+//		{Type: "Button", Name: "Login", X: 20, Y: 100, Width: 350, Height: 44, OnClick: func() { loggedIn = true }},
+//	}})
+//	driver, err := gwda.NewDriver(nil, fake.URL)
+//
+// The fake serves the routes used by gwda against a UI tree: sessions, status, element lookups
+// and their commands, source, screenshot, alerts, apps and the uusense endpoints.
+// Taps and gestures are accepted, a tap or click calls the OnClick of the element hit.
+// XPath and predicate lookups are not evaluated by the fake, but work with gwda.WithLocalQueries.
+package wdatest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Request is a request received by the fake.
+type Request struct {
+	Method string
+	// Path is the URL path including the session, e.g. "/session/<id>/wda/tap/0"
+	Path  string
+	Query url.Values
+	Body  []byte
+}
+
+// Route returns the path without the session, e.g. "/wda/tap/0".
+func (r Request) Route() string {
+	route, _ := splitSession(r.Path)
+	return route
+}
+
+// Decode unmarshals the JSON body into v.
+func (r Request) Decode(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Server is a fake WebDriverAgent listening on a local address.
+type Server struct {
+	// URL is the base URL of the fake, e.g. "http://127.0.0.1:51234"
+	URL string
+
+	srv *httptest.Server
+
+	mu          sync.Mutex
+	sessionId   string
+	sessions    int
+	root        *Element
+	ids         map[*Element]string
+	elements    map[string]*Element
+	alert       *alert
+	apps        map[string]int
+	activeApp   string
+	screenshot  []byte
+	scale       float64
+	orientation string
+	locked      bool
+	settings    map[string]interface{}
+	requests    []Request
+	handlers    map[string]http.HandlerFunc
+}
+
+type alert struct {
+	text    string
+	buttons []string
+}
+
+// NewServer starts a fake with a session, an empty application and the home screen in front.
+func NewServer() *Server {
+	s := &Server{
+		ids:         make(map[*Element]string),
+		elements:    make(map[string]*Element),
+		apps:        map[string]int{springboard: appStateRunningFront},
+		activeApp:   springboard,
+		scale:       2,
+		orientation: "PORTRAIT",
+		settings:    make(map[string]interface{}),
+		handlers:    make(map[string]http.HandlerFunc),
+	}
+	s.newSession()
+	s.root = &Element{Type: "Application", Name: "Fake", Label: "Fake", Width: 390, Height: 844}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+const (
+	springboard = "com.apple.springboard"
+
+	appStateNotRunning   = 1
+	appStateRunningBack  = 3
+	appStateRunningFront = 4
+)
+
+// Close shuts the fake down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// SessionID returns the id of the current session.
+func (s *Server) SessionID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessionId
+}
+
+// ExpireSession makes the current session invalid, like a restart of WDA does,
+// requests with its id fail with "invalid session id" until a new session is created.
+func (s *Server) ExpireSession() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessionId = ""
+}
+
+// SetUI replaces the UI tree, root is usually of type "Application"
+// and its size is reported as the window size.
+func (s *Server) SetUI(root *Element) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	root.parent = nil
+	root.link()
+	s.root = root
+}
+
+// Update calls fn while no request is processed, so that elements of the UI tree can be changed.
+func (s *Server) Update(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+	s.root.link()
+}
+
+// SetAlert shows an alert, it is gone once accepted or dismissed.
+func (s *Server) SetAlert(text string, buttons ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alert = &alert{text: text, buttons: buttons}
+}
+
+// AlertShown reports whether an alert is shown.
+func (s *Server) AlertShown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.alert != nil
+}
+
+// SetAppState sets the state of an application using the values of gwda.AppState,
+// an application in the foreground becomes the active one.
+func (s *Server) SetAppState(bundleId string, state int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setAppState(bundleId, state)
+}
+
+// AppState returns the state of an application using the values of gwda.AppState.
+func (s *Server) AppState(bundleId string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appState(bundleId)
+}
+
+// ActiveApp returns the bundle id of the application in the foreground.
+func (s *Server) ActiveApp() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeApp
+}
+
+// SetScreenshot sets the PNG or JPEG returned as screenshot,
+// by default it is a gray image of the window size in pixels.
+func (s *Server) SetScreenshot(raw []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.screenshot = raw
+}
+
+// SetScale sets the scale of the screen, i.e. pixels per point, by default 2.
+func (s *Server) SetScale(scale float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scale = scale
+	s.screenshot = nil
+}
+
+// Handle replaces the response of the fake to method and route,
+// the route is the path without the session, e.g. "/wda/tap/0".
+// The request is recorded before handler is called.
+func (s *Server) Handle(method, route string, handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method+" "+route] = handler
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// ResetRequests forgets the requests received so far.
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+func (s *Server) newSession() {
+	s.sessions++
+	s.sessionId = fmt.Sprintf("00000000-0000-0000-0000-%012d", s.sessions)
+}
+
+func (s *Server) appState(bundleId string) int {
+	if state, ok := s.apps[bundleId]; ok {
+		return state
+	}
+	return appStateNotRunning
+}
+
+func (s *Server) setAppState(bundleId string, state int) {
+	s.apps[bundleId] = state
+	switch {
+	case state == appStateRunningFront && bundleId != s.activeApp:
+		if s.activeApp != springboard {
+			s.apps[s.activeApp] = appStateRunningBack
+		}
+		s.activeApp = bundleId
+	case state != appStateRunningFront && bundleId == s.activeApp:
+		s.activeApp = springboard
+	}
+}
+
+// splitSession splits "/session/<id>/route" into the route and the session id.
+func splitSession(path string) (route, sessionId string) {
+	if path == "/session" {
+		return path, ""
+	}
+	if !strings.HasPrefix(path, "/session/") {
+		return path, ""
+	}
+	rest := strings.TrimPrefix(path, "/session/")
+	if i := strings.Index(rest, "/"); i >= 0 {
+		return rest[i:], rest[:i]
+	}
+	return "", rest
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	// paths like "uusense/screenshot" are joined to "//uusense/screenshot" by some clients
+	path := "/" + strings.TrimLeft(r.URL.Path, "/")
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: path, Query: r.URL.Query(), Body: body})
+	route, sessionId := splitSession(path)
+	handler := s.handlers[r.Method+" "+route]
+	s.mu.Unlock()
+
+	if handler != nil {
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		handler(w, r)
+		return
+	}
+
+	var data map[string]interface{}
+	if len(body) != 0 {
+		if err := json.Unmarshal(body, &data); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid argument", err.Error())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	if sessionId != "" && sessionId != s.sessionId {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "invalid session id", "Session does not exist")
+		return
+	}
+	resp := s.route(r.Method, route, r.URL.Query(), data)
+	s.mu.Unlock()
+
+	if resp.onClick != nil {
+		resp.onClick()
+	}
+	resp.write(w, s.SessionID())
+}
+
+// response is prepared while the server is locked, and written afterwards.
+type response struct {
+	status  int
+	value   interface{}
+	raw     []byte
+	code    string
+	onClick func()
+}
+
+func ok(value interface{}) response {
+	return response{status: http.StatusOK, value: value}
+}
+
+func fail(status int, code, format string, a ...interface{}) response {
+	return response{status: status, code: code, value: fmt.Sprintf(format, a...)}
+}
+
+func (resp response) write(w http.ResponseWriter, sessionId string) {
+	if resp.raw != nil {
+		w.Header().Set("Content-Type", http.DetectContentType(resp.raw))
+		_, _ = w.Write(resp.raw)
+		return
+	}
+	if resp.code != "" {
+		writeError(w, resp.status, resp.code, resp.value.(string))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"value": resp.value, "sessionId": sessionId})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"value": map[string]string{"error": code, "message": message, "traceback": ""},
+	})
+}
+
+// acceptedRoutes are gestures and commands the fake accepts without any effect.
+var acceptedRoutes = map[string]bool{
+	"/actions": true, "/url": true, "/wda/doubleTap": true, "/wda/dragfromtoforduration": true,
+	"/wda/expectNotification": true, "/wda/keyboard/dismiss": true, "/wda/performIoHidEvent": true,
+	"/wda/pressButton": true, "/wda/resetAppAuth": true, "/wda/siri/activate": true,
+	"/wda/touch/multi/perform": true, "/wda/touchAndHold": true, "/wda/touch_id": true,
+	"/uusense/dragfromtoforduration": true, "/uusense/doubleMove": true, "/uusense/move": true,
+	"/uusense/globalInput": true, "/wda/keys": true,
+}
+
+func (s *Server) route(method, route string, query url.Values, data map[string]interface{}) response {
+	if method == http.MethodPost && acceptedRoutes[route] {
+		return ok(nil)
+	}
+	if strings.HasPrefix(route, "/element/") || strings.HasPrefix(route, "/wda/element/") {
+		return s.routeElement(method, route, data)
+	}
+
+	switch method + " " + route {
+	case "POST /session":
+		s.newSession()
+		if bundleId := capabilityBundleId(data); bundleId != "" {
+			s.setAppState(bundleId, appStateRunningFront)
+		}
+		return ok(s.sessionInfo())
+	case "GET ":
+		// the session itself
+		return ok(s.sessionInfo())
+	case "DELETE ":
+		s.sessionId = ""
+		return ok(nil)
+	case "GET /status":
+		return ok(map[string]interface{}{
+			"message": "WebDriverAgent is ready to accept commands",
+			"state":   "success",
+			"ready":   true,
+			"os":      map[string]interface{}{"name": "iOS", "version": "16.0", "sdkVersion": "16.0"},
+			"ios":     map[string]interface{}{"ip": "127.0.0.1"},
+			"build":   map[string]interface{}{"productBundleIdentifier": "com.facebook.WebDriverAgentRunner"},
+		})
+	case "GET /health":
+		return response{status: http.StatusOK, raw: []byte("I-AM-ALIVE")}
+	case "GET /wda/healthcheck", "GET /wda/shutdown":
+		return ok(nil)
+	case "POST /wda/homescreen":
+		if s.activeApp != springboard {
+			s.apps[s.activeApp] = appStateRunningBack
+		}
+		s.activeApp = springboard
+		return ok(nil)
+	case "POST /wda/lock":
+		s.locked = true
+		return ok(nil)
+	case "POST /wda/unlock":
+		s.locked = false
+		return ok(nil)
+	case "GET /wda/locked":
+		return ok(s.locked)
+
+	case "GET /source":
+		if query.Get("format") == "json" {
+			return ok(jsonSource(s.root))
+		}
+		return ok(xmlSource(s.root))
+	case "GET /wda/accessibleSource":
+		return ok(jsonSource(s.root))
+	case "GET /screenshot":
+		return ok(base64.StdEncoding.EncodeToString(s.currentScreenshot()))
+	case "POST /uusense/screenshot":
+		return response{status: http.StatusOK, raw: s.currentScreenshot()}
+	case "GET /window/size":
+		return ok(map[string]float64{"width": s.root.Width, "height": s.root.Height})
+	case "GET /wda/screen":
+		return ok(map[string]interface{}{
+			"scale":         s.scale,
+			"statusBarSize": map[string]float64{"width": s.root.Width, "height": 47},
+		})
+	case "GET /orientation":
+		return ok(s.orientation)
+	case "POST /orientation":
+		if orientation, _ := data["orientation"].(string); orientation != "" {
+			s.orientation = orientation
+		}
+		return ok(nil)
+	case "GET /rotation":
+		return ok(map[string]int{"x": 0, "y": 0, "z": 0})
+	case "POST /rotation":
+		return ok(nil)
+	case "GET /appium/settings":
+		return ok(s.settings)
+	case "POST /appium/settings":
+		if settings, ok := data["settings"].(map[string]interface{}); ok {
+			for k, v := range settings {
+				s.settings[k] = v
+			}
+		}
+		return ok(s.settings)
+	case "GET /wda/batteryInfo":
+		return ok(map[string]interface{}{"level": 1, "state": 2})
+	case "GET /wda/device/info":
+		return ok(map[string]interface{}{
+			"timeZone": "GMT", "currentLocale": "en_US", "model": "iPhone", "uuid": "00000000-0000-0000-0000-000000000000",
+			"userInterfaceIdiom": 0, "userInterfaceStyle": "light", "name": "Fake iPhone", "isSimulator": false,
+		})
+	case "GET /wda/device/location":
+		return ok(map[string]interface{}{"authorizationStatus": 0, "latitude": 0, "longitude": 0, "altitude": 0})
+	case "POST /wda/getPasteboard":
+		return ok("")
+	case "POST /wda/setPasteboard":
+		return ok(nil)
+
+	case "GET /alert/text":
+		if s.alert == nil {
+			return fail(http.StatusBadRequest, "no such alert", "An attempt was made to operate on a modal dialog when one was not open")
+		}
+		return ok(s.alert.text)
+	case "POST /alert/text":
+		if s.alert == nil {
+			return fail(http.StatusBadRequest, "no such alert", "An attempt was made to operate on a modal dialog when one was not open")
+		}
+		return ok(nil)
+	case "GET /wda/alert/buttons":
+		if s.alert == nil {
+			return fail(http.StatusBadRequest, "no such alert", "An attempt was made to operate on a modal dialog when one was not open")
+		}
+		return ok(s.alert.buttons)
+	case "POST /alert/accept", "POST /alert/dismiss":
+		if s.alert == nil {
+			return fail(http.StatusBadRequest, "no such alert", "An attempt was made to operate on a modal dialog when one was not open")
+		}
+		s.alert = nil
+		return ok(nil)
+
+	case "GET /wda/activeAppInfo":
+		name := "SpringBoard"
+		if s.activeApp != springboard {
+			name = s.root.Name
+		}
+		return ok(map[string]interface{}{
+			"processArguments": map[string]interface{}{"env": map[string]string{}, "args": []string{}},
+			"name":             name,
+			"pid":              s.pid(s.activeApp),
+			"bundleId":         s.activeApp,
+		})
+	case "GET /wda/apps/list":
+		var apps []map[string]interface{}
+		for bundleId, state := range s.apps {
+			if state != appStateNotRunning && bundleId != springboard {
+				apps = append(apps, map[string]interface{}{"pid": s.pid(bundleId), "bundleId": bundleId})
+			}
+		}
+		return ok(apps)
+	case "POST /wda/apps/launch", "POST /wda/apps/launchUnattached", "POST /wda/apps/activate":
+		bundleId, _ := data["bundleId"].(string)
+		if bundleId == "" {
+			return fail(http.StatusBadRequest, "invalid argument", "'bundleId' is required")
+		}
+		s.setAppState(bundleId, appStateRunningFront)
+		return ok(nil)
+	case "POST /wda/apps/terminate":
+		bundleId, _ := data["bundleId"].(string)
+		wasRunning := s.appState(bundleId) != appStateNotRunning
+		s.setAppState(bundleId, appStateNotRunning)
+		return ok(wasRunning)
+	case "POST /wda/apps/state":
+		bundleId, _ := data["bundleId"].(string)
+		return ok(s.appState(bundleId))
+	case "POST /wda/deactivateApp":
+		return ok(nil)
+
+	case "POST /element", "POST /elements":
+		return s.findElements(s.root, route == "/elements", data)
+	case "GET /element/active":
+		return fail(http.StatusNotFound, "no such element", "No element is focused")
+	case "POST /wda/tap/0":
+		x, _ := data["x"].(float64)
+		y, _ := data["y"].(float64)
+		return s.click(s.root.hitTest(x, y))
+	}
+
+	if method == http.MethodPost && strings.HasPrefix(route, "/wda/tap/") {
+		e, resp := s.element(strings.TrimPrefix(route, "/wda/tap/"))
+		if e == nil {
+			return resp
+		}
+		return s.click(e)
+	}
+	if method == http.MethodPost && strings.HasPrefix(route, "/wda/pickerwheel/") {
+		return ok(nil)
+	}
+	return fail(http.StatusNotFound, "unknown command", "Unhandled endpoint: %s %s", method, route)
+}
+
+func (s *Server) routeElement(method, route string, data map[string]interface{}) response {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimPrefix(route, "/wda"), "/element/"), "/")
+	id, command := parts[0], strings.Join(parts[1:], "/")
+	e, resp := s.element(id)
+	if e == nil {
+		return resp
+	}
+
+	switch method + " " + command {
+	case "GET rect":
+		return ok(e.rect())
+	case "GET text":
+		if e.Value != "" {
+			return ok(e.Value)
+		}
+		return ok(e.Label)
+	case "GET name":
+		return ok(e.fullType())
+	case "GET displayed":
+		return ok(!e.Hidden)
+	case "GET enabled":
+		return ok(!e.Disabled)
+	case "GET selected":
+		return ok(e.Selected)
+	case "GET accessible":
+		return ok(e.accessible())
+	case "GET accessibilityContainer":
+		return ok(!e.accessible() && len(e.Children) != 0)
+	case "GET screenshot":
+		return ok(base64.StdEncoding.EncodeToString(s.currentScreenshot()))
+	case "GET getVisibleCells":
+		var cells []map[string]string
+		e.walk(func(c *Element) {
+			if c.fullType() == elementTypePrefix+"Cell" && !c.Hidden {
+				cells = append(cells, s.reference(c))
+			}
+		})
+		return ok(cells)
+	case "POST click", "POST doubleTap", "POST tapWithNumberOfTaps":
+		return s.click(e)
+	case "POST value":
+		var text strings.Builder
+		if chars, ok := data["value"].([]interface{}); ok {
+			for _, c := range chars {
+				text.WriteString(fmt.Sprint(c))
+			}
+		}
+		e.Value += text.String()
+		return ok(nil)
+	case "POST clear":
+		e.Value = ""
+		return ok(nil)
+	case "POST element", "POST elements":
+		return s.findElements(e, command == "elements", data)
+	}
+
+	if strings.HasPrefix(command, "attribute/") && method == http.MethodGet {
+		name := strings.TrimPrefix(command, "attribute/")
+		if name == "UID" {
+			return ok(id)
+		}
+		value, known := e.attribute(name)
+		if !known {
+			return ok(nil)
+		}
+		return ok(value)
+	}
+	if method == http.MethodPost {
+		// the remaining gestures, e.g. swipe, pinch or scroll
+		return ok(nil)
+	}
+	return fail(http.StatusNotFound, "unknown command", "Unhandled endpoint: %s %s", method, route)
+}
+
+// element returns the element with the id, or the error response if it is unknown or gone.
+func (s *Server) element(id string) (*Element, response) {
+	e, known := s.elements[id]
+	if !known {
+		return nil, fail(http.StatusNotFound, "no such element", "The element '%s' is not linked to the current session", id)
+	}
+	if !e.isDescendantOf(s.root) {
+		return nil, fail(http.StatusNotFound, "stale element reference", "The previously found element \"%s\" is not present in the current view anymore", id)
+	}
+	return e, response{}
+}
+
+func (s *Server) findElements(parent *Element, all bool, data map[string]interface{}) response {
+	using, _ := data["using"].(string)
+	value, _ := data["value"].(string)
+	found, err := parent.find(using, value)
+	if err != nil {
+		return fail(http.StatusBadRequest, "invalid selector", "%s", err)
+	}
+	if !all {
+		if len(found) == 0 {
+			return fail(http.StatusNotFound, "no such element", "unable to find an element using '%s', value '%s'", using, value)
+		}
+		return ok(s.reference(found[0]))
+	}
+	references := make([]map[string]string, 0, len(found))
+	for _, e := range found {
+		references = append(references, s.reference(e))
+	}
+	return ok(references)
+}
+
+// reference returns the element reference of e, elements keep their id while they are in the tree.
+func (s *Server) reference(e *Element) map[string]string {
+	id, ok := s.ids[e]
+	if !ok {
+		id = fmt.Sprintf("00000000-0000-0000-0000-%012X", len(s.ids)+1)
+		s.ids[e] = id
+		s.elements[id] = e
+	}
+	return map[string]string{"ELEMENT": id, "element-6066-11e4-a52e-4f735466cecf": id}
+}
+
+// click calls the OnClick of e or its closest ancestor having one, once the server is unlocked.
+func (s *Server) click(e *Element) response {
+	for ; e != nil; e = e.parent {
+		if e.OnClick != nil {
+			return response{status: http.StatusOK, onClick: e.OnClick}
+		}
+	}
+	return ok(nil)
+}
+
+func (s *Server) sessionInfo() map[string]interface{} {
+	return map[string]interface{}{
+		"sessionId": s.sessionId,
+		"capabilities": map[string]interface{}{
+			"device":             "iphone",
+			"browserName":        s.root.Name,
+			"sdkVersion":         "16.0",
+			"CFBundleIdentifier": s.activeApp,
+		},
+	}
+}
+
+func (s *Server) pid(bundleId string) int {
+	var pid int
+	for _, c := range bundleId {
+		pid = (pid*31 + int(c)) % 60000
+	}
+	return pid + 1000
+}
+
+func (s *Server) currentScreenshot() []byte {
+	if s.screenshot == nil {
+		width, height := int(s.root.Width*s.scale), int(s.root.Height*s.scale)
+		if width <= 0 || height <= 0 {
+			width, height = 1, 1
+		}
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		for i := range img.Pix {
+			img.Pix[i] = color.Gray{Y: 0xcc}.Y
+		}
+		var buf bytes.Buffer
+		_ = png.Encode(&buf, img)
+		s.screenshot = buf.Bytes()
+	}
+	return s.screenshot
+}
+
+// capabilityBundleId returns the bundle id of the capabilities of a new session.
+func capabilityBundleId(data map[string]interface{}) string {
+	capabilities, _ := data["capabilities"].(map[string]interface{})
+	for _, m := range []interface{}{capabilities["alwaysMatch"], capabilities, data["desiredCapabilities"]} {
+		if m, ok := m.(map[string]interface{}); ok {
+			if bundleId, ok := m["bundleId"].(string); ok && bundleId != "" {
+				return bundleId
+			}
+		}
+	}
+	return ""
+}
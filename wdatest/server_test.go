@@ -0,0 +1,136 @@
+package wdatest_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/electricbubble/gwda"
+	"github.com/electricbubble/gwda/wdatest"
+)
+
+func TestServer(t *testing.T) {
+	fake := wdatest.NewServer()
+	defer fake.Close()
+
+	var clicked int
+	login := &wdatest.Element{Type: "Button", Name: "Login", Label: "Log in", X: 20, Y: 100, Width: 350, Height: 44, OnClick: func() { clicked++ }}
+	field := &wdatest.Element{Type: "TextField", Name: "User", X: 20, Y: 40, Width: 350, Height: 44}
+	fake.SetUI(&wdatest.Element{Type: "Application", Name: "Demo", Width: 390, Height: 844, Children: []*wdatest.Element{
+		{Type: "Window", Width: 390, Height: 844, Children: []*wdatest.Element{field, login}},
+	}})
+
+	driver, err := gwda.NewDriver(gwda.NewCapabilities().WithDefaultAlertAction(gwda.AlertActionAccept), fake.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = driver.Status(); err != nil {
+		t.Fatal(err)
+	}
+	size, err := driver.WindowSize()
+	if err != nil || size.Width != 390 || size.Height != 844 {
+		t.Fatalf("got %+v, %v", size, err)
+	}
+
+	button, err := driver.FindElement(gwda.BySelector{Name: "Login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = button.Click(); err != nil {
+		t.Fatal(err)
+	}
+	if text, err := button.Text(); err != nil || text != "Log in" {
+		t.Fatalf("got %q, %v", text, err)
+	}
+	if err = driver.Tap(100, 120); err != nil {
+		t.Fatal(err)
+	}
+	if clicked != 2 {
+		t.Fatalf("clicked %d times, want 2", clicked)
+	}
+
+	input, err := driver.FindElement(gwda.BySelector{ClassChain: "**/XCUIElementTypeTextField[1]"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = input.SendKeys("alice"); err != nil {
+		t.Fatal(err)
+	}
+	fake.Update(func() {
+		if field.Value != "alice" {
+			t.Errorf("typed %q", field.Value)
+		}
+	})
+
+	if _, err = driver.FindElement(gwda.BySelector{Name: "Logout"}); !errors.Is(err, gwda.ErrNoSuchElement) {
+		t.Fatalf("got %v, want %v", err, gwda.ErrNoSuchElement)
+	}
+	fake.Update(func() { login.Hidden = true })
+	if displayed, err := button.IsDisplayed(); err != nil || displayed {
+		t.Fatalf("got %v, %v", displayed, err)
+	}
+
+	h, err := driver.Hierarchy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := h.FindByName("User"); n == nil || n.Value != "alice" {
+		t.Fatalf("unexpected source %s", h)
+	}
+	if _, err = driver.Screenshot(); err != nil {
+		t.Fatal(err)
+	}
+
+	// elements removed from the tree are stale
+	fake.Update(func() { login.Hidden = false })
+	fake.SetUI(&wdatest.Element{Type: "Application", Name: "Demo", Width: 390, Height: 844})
+	if err = button.Click(); !errors.Is(err, gwda.ErrStaleElementReference) {
+		t.Fatalf("got %v, want %v", err, gwda.ErrStaleElementReference)
+	}
+
+	fake.SetAlert("Allow?", "Don't Allow", "OK")
+	if err = driver.Wait(gwda.AlertPresent()); err != nil {
+		t.Fatal(err)
+	}
+	if buttons, err := driver.AlertButtons(); err != nil || len(buttons) != 2 {
+		t.Fatalf("got %q, %v", buttons, err)
+	}
+	if err = driver.AlertAccept(); err != nil || fake.AlertShown() {
+		t.Fatalf("alert not accepted: %v", err)
+	}
+
+	if err = driver.AppLaunch("com.example.demo"); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := driver.AppState("com.example.demo"); err != nil || state != gwda.AppStateRunningFront {
+		t.Fatalf("got %v, %v", state, err)
+	}
+	if info, err := driver.ActiveAppInfo(); err != nil || info.BundleId != "com.example.demo" {
+		t.Fatalf("got %+v, %v", info, err)
+	}
+	if _, err = driver.AppTerminate("com.example.demo"); err != nil || fake.AppState("com.example.demo") != int(gwda.AppStateNotRunning) {
+		t.Fatalf("app not terminated: %v", err)
+	}
+	if _, err = driver.ScreenshotUUSense(0, 0, 0, 0, 0, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	var taps int
+	for _, r := range fake.Requests() {
+		if r.Route() == "/wda/tap/0" {
+			var data map[string]float64
+			if err = r.Decode(&data); err != nil || data["x"] != 100 || data["y"] != 120 {
+				t.Fatalf("unexpected tap %s", r.Body)
+			}
+			taps++
+		}
+	}
+	if taps != 1 {
+		t.Fatalf("got %d taps, want 1", taps)
+	}
+
+	fake.ExpireSession()
+	if _, err = driver.WindowSize(); !errors.Is(err, gwda.ErrInvalidSessionID) {
+		t.Fatalf("got %v, want %v", err, gwda.ErrInvalidSessionID)
+	}
+}
@@ -0,0 +1,300 @@
+package wdatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const elementTypePrefix = "XCUIElementType"
+
+// Element is an element of the fake UI tree.
+// Its fields may only be changed inside Server.Update once the tree is in use.
+type Element struct {
+	// Type is the element type with or without its "XCUIElementType" prefix, e.g. "Button"
+	Type  string
+	Name  string
+	Label string
+	Value string
+
+	X, Y, Width, Height float64
+
+	// Disabled and Hidden elements are reported as not enabled and not visible
+	Disabled bool
+	Hidden   bool
+	Selected bool
+
+	Children []*Element
+
+	// OnClick is called when the element is clicked or tapped, outside of Server.Update
+	OnClick func()
+
+	parent *Element
+}
+
+func (e *Element) fullType() string {
+	if e.Type == "" {
+		return elementTypePrefix + "Other"
+	}
+	if strings.HasPrefix(e.Type, elementTypePrefix) {
+		return e.Type
+	}
+	return elementTypePrefix + e.Type
+}
+
+func (e *Element) accessible() bool {
+	return len(e.Children) == 0 && (e.Name != "" || e.Label != "")
+}
+
+func (e *Element) contains(x, y float64) bool {
+	return x >= e.X && y >= e.Y && x < e.X+e.Width && y < e.Y+e.Height
+}
+
+// attribute returns the attribute by its WDA name, ok is false for unknown ones.
+func (e *Element) attribute(name string) (value string, ok bool) {
+	switch name {
+	case "type", "wdType":
+		return e.fullType(), true
+	case "name", "wdName", "identifier":
+		return e.Name, true
+	case "label", "wdLabel":
+		return e.Label, true
+	case "value", "wdValue":
+		return e.Value, true
+	case "enabled", "wdEnabled", "isEnabled":
+		return strconv.FormatBool(!e.Disabled), true
+	case "visible", "wdVisible", "isVisible":
+		return strconv.FormatBool(!e.Hidden), true
+	case "accessible", "wdAccessible", "isAccessible":
+		return strconv.FormatBool(e.accessible()), true
+	case "selected", "wdSelected", "isSelected":
+		return strconv.FormatBool(e.Selected), true
+	}
+	return "", false
+}
+
+// link sets the parents of the subtree.
+func (e *Element) link() {
+	for _, c := range e.Children {
+		c.parent = e
+		c.link()
+	}
+}
+
+// walk calls fn for the descendants of e in depth-first order.
+func (e *Element) walk(fn func(c *Element)) {
+	for _, c := range e.Children {
+		fn(c)
+		c.walk(fn)
+	}
+}
+
+func (e *Element) isDescendantOf(root *Element) bool {
+	for p := e; p != nil; p = p.parent {
+		if p == root {
+			return true
+		}
+	}
+	return false
+}
+
+// hitTest returns the deepest visible element containing the point, or nil.
+func (e *Element) hitTest(x, y float64) *Element {
+	if e.Hidden || !e.contains(x, y) {
+		return nil
+	}
+	for i := len(e.Children) - 1; i >= 0; i-- {
+		if hit := e.Children[i].hitTest(x, y); hit != nil {
+			return hit
+		}
+	}
+	return e
+}
+
+// find returns the descendants of e matching the WDA lookup strategy.
+func (e *Element) find(using, value string) ([]*Element, error) {
+	var match func(c *Element) bool
+	switch using {
+	case "id", "name", "accessibility id":
+		match = func(c *Element) bool { return c.Name == value }
+	case "class name":
+		match = func(c *Element) bool { return c.fullType() == value }
+	case "link text", "partial link text":
+		i := strings.Index(value, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("'%s' is not a valid %s, expected 'attribute=value'", value, using)
+		}
+		name, expected := value[:i], value[i+1:]
+		match = func(c *Element) bool {
+			actual, ok := c.attribute(name)
+			if using == "partial link text" {
+				return ok && strings.Contains(actual, expected)
+			}
+			return ok && actual == expected
+		}
+	case "class chain":
+		return e.findClassChain(value)
+	default:
+		return nil, fmt.Errorf("the fake WDA does not evaluate '%s' lookups, consider gwda.WithLocalQueries", using)
+	}
+
+	var found []*Element
+	e.walk(func(c *Element) {
+		if match(c) {
+			found = append(found, c)
+		}
+	})
+	return found, nil
+}
+
+// findClassChain evaluates class chains made of types or "*" with an optional index,
+// and "**" for any number of levels, e.g. "**/XCUIElementTypeCell[2]/*".
+func (e *Element) findClassChain(chain string) ([]*Element, error) {
+	current := []*Element{e}
+	anyDepth := false
+	for _, segment := range strings.Split(chain, "/") {
+		if segment == "**" {
+			anyDepth = true
+			continue
+		}
+		elementType, index := segment, 0
+		if i := strings.Index(segment, "["); i >= 0 && strings.HasSuffix(segment, "]") {
+			n, err := strconv.Atoi(segment[i+1 : len(segment)-1])
+			if err != nil || n == 0 {
+				return nil, fmt.Errorf("'%s' is not supported by the fake WDA, only numeric indexes are", segment)
+			}
+			elementType, index = segment[:i], n
+		}
+		if strings.ContainsAny(elementType, "`$[]") || elementType == "" {
+			return nil, fmt.Errorf("'%s' is not supported by the fake WDA, only numeric indexes are", segment)
+		}
+		if elementType != "*" && !strings.HasPrefix(elementType, elementTypePrefix) {
+			elementType = elementTypePrefix + elementType
+		}
+
+		var next []*Element
+		for _, parent := range current {
+			var candidates []*Element
+			collect := func(c *Element) {
+				if elementType == "*" || c.fullType() == elementType {
+					candidates = append(candidates, c)
+				}
+			}
+			if anyDepth {
+				parent.walk(collect)
+			} else {
+				for _, c := range parent.Children {
+					collect(c)
+				}
+			}
+			switch {
+			case index > 0 && index <= len(candidates):
+				next = append(next, candidates[index-1])
+			case index < 0 && -index <= len(candidates):
+				next = append(next, candidates[len(candidates)+index])
+			case index == 0:
+				next = append(next, candidates...)
+			}
+		}
+		current, anyDepth = next, false
+	}
+	if anyDepth {
+		return nil, fmt.Errorf("class chain '%s' must not end with '**'", chain)
+	}
+	return current, nil
+}
+
+func (e *Element) writeXML(buf *bytes.Buffer, index, depth int) {
+	indent := strings.Repeat("  ", depth)
+	buf.WriteString(indent + "<" + e.fullType())
+	attr := func(name, value string) {
+		buf.WriteString(" " + name + `="`)
+		_ = xml.EscapeText(buf, []byte(value))
+		buf.WriteString(`"`)
+	}
+	attr("type", e.fullType())
+	if e.Value != "" {
+		attr("value", e.Value)
+	}
+	if e.Name != "" {
+		attr("name", e.Name)
+	}
+	if e.Label != "" {
+		attr("label", e.Label)
+	}
+	attr("enabled", strconv.FormatBool(!e.Disabled))
+	attr("visible", strconv.FormatBool(!e.Hidden))
+	attr("accessible", strconv.FormatBool(e.accessible()))
+	attr("x", formatFloat(e.X))
+	attr("y", formatFloat(e.Y))
+	attr("width", formatFloat(e.Width))
+	attr("height", formatFloat(e.Height))
+	attr("index", strconv.Itoa(index))
+	if len(e.Children) == 0 {
+		buf.WriteString("/>\n")
+		return
+	}
+	buf.WriteString(">\n")
+	for i, c := range e.Children {
+		c.writeXML(buf, i, depth+1)
+	}
+	buf.WriteString(indent + "</" + e.fullType() + ">\n")
+}
+
+// jsonSource returns the element in the JSON format of the source.
+func (e *Element) jsonSource() map[string]interface{} {
+	nullable := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	flag := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return "0"
+	}
+	m := map[string]interface{}{
+		"type":         strings.TrimPrefix(e.fullType(), elementTypePrefix),
+		"name":         nullable(e.Name),
+		"label":        nullable(e.Label),
+		"value":        nullable(e.Value),
+		"isEnabled":    flag(!e.Disabled),
+		"isVisible":    flag(!e.Hidden),
+		"isAccessible": flag(e.accessible()),
+		"rect":         e.rect(),
+		"frame":        fmt.Sprintf("{{%s, %s}, {%s, %s}}", formatFloat(e.X), formatFloat(e.Y), formatFloat(e.Width), formatFloat(e.Height)),
+	}
+	if len(e.Children) != 0 {
+		children := make([]interface{}, len(e.Children))
+		for i, c := range e.Children {
+			children[i] = c.jsonSource()
+		}
+		m["children"] = children
+	}
+	return m
+}
+
+func (e *Element) rect() map[string]float64 {
+	return map[string]float64{"x": e.X, "y": e.Y, "width": e.Width, "height": e.Height}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func xmlSource(root *Element) string {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	root.writeXML(&buf, 0, 0)
+	return buf.String()
+}
+
+func jsonSource(root *Element) json.RawMessage {
+	raw, _ := json.Marshal(root.jsonSource())
+	return raw
+}
@@ -0,0 +1,1152 @@
+package gwda
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This file implements the subset of XPath 1.0 needed to query a Hierarchy:
+// location paths with all axes but namespace, predicates, the operators and
+// the core functions working on strings, numbers, booleans and node-sets.
+// The tree has no text nodes, so text() never matches.
+
+// XPath is a compiled XPath expression.
+type XPath struct {
+	expr xpathExpr
+	src  string
+}
+
+// CompileXPath parses an XPath expression.
+func CompileXPath(expr string) (*XPath, error) {
+	tokens, err := xpathTokenize(expr)
+	if err != nil {
+		return nil, fmt.Errorf("xpath %q: %w", expr, err)
+	}
+	p := &xpathParser{tokens: tokens}
+	e, err := p.parseExpr()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("xpath %q: %w", expr, err)
+	}
+	return &XPath{expr: e, src: expr}, nil
+}
+
+func (x *XPath) String() string {
+	return x.src
+}
+
+// Select evaluates the expression with the document as context
+// and returns the selected elements in document order.
+func (x *XPath) Select(h *Hierarchy) ([]*Node, error) {
+	if h.Root == nil {
+		return nil, nil
+	}
+	doc := newXPathDocument(h.Root)
+	v, err := x.expr.eval(&xpathContext{node: xpathNode{}, position: 1, size: 1, doc: doc})
+	if err != nil {
+		return nil, fmt.Errorf("xpath %q: %w", x.src, err)
+	}
+	set, ok := v.(xpathNodeSet)
+	if !ok {
+		return nil, fmt.Errorf("xpath %q: result is not a node-set", x.src)
+	}
+	var nodes []*Node
+	for _, n := range set {
+		if n.node == nil || n.attr != "" {
+			return nil, fmt.Errorf("xpath %q: result contains nodes other than elements", x.src)
+		}
+		nodes = append(nodes, n.node)
+	}
+	return nodes, nil
+}
+
+// Select returns the elements of the hierarchy selected by the XPath expression.
+func (h *Hierarchy) Select(xpath string) ([]*Node, error) {
+	x, err := CompileXPath(xpath)
+	if err != nil {
+		return nil, err
+	}
+	return x.Select(h)
+}
+
+// xpathNode is an element, one of its attributes or the document node if node is nil.
+type xpathNode struct {
+	node *Node
+	attr string
+}
+
+func (n xpathNode) isElement() bool {
+	return n.node != nil && n.attr == ""
+}
+
+func (n xpathNode) name() string {
+	switch {
+	case n.node == nil:
+		return ""
+	case n.attr != "":
+		return n.attr
+	case n.node.Type == "":
+		return elementTypePrefix + "Other"
+	default:
+		return n.node.Type
+	}
+}
+
+// stringValue is the value of an attribute, elements have no text content.
+func (n xpathNode) stringValue() string {
+	if n.node != nil && n.attr != "" {
+		return n.node.Attributes[n.attr]
+	}
+	return ""
+}
+
+type xpathDocument struct {
+	root  *Node
+	all   []*Node
+	order map[*Node]int
+}
+
+func newXPathDocument(root *Node) *xpathDocument {
+	doc := &xpathDocument{root: root, order: make(map[*Node]int)}
+	root.Walk(func(n *Node) bool {
+		doc.all = append(doc.all, n)
+		doc.order[n] = len(doc.all)
+		return true
+	})
+	return doc
+}
+
+// position orders the nodes in document order, attributes follow their element.
+func (doc *xpathDocument) position(n xpathNode) (int, string) {
+	if n.node == nil {
+		return 0, ""
+	}
+	return doc.order[n.node], n.attr
+}
+
+func (doc *xpathDocument) parent(n xpathNode) (xpathNode, bool) {
+	switch {
+	case n.node == nil:
+		return xpathNode{}, false
+	case n.attr != "":
+		return xpathNode{node: n.node}, true
+	case n.node == doc.root || n.node.Parent == nil:
+		return xpathNode{}, true
+	default:
+		return xpathNode{node: n.node.Parent}, true
+	}
+}
+
+func (doc *xpathDocument) children(n xpathNode) []*Node {
+	switch {
+	case n.node == nil:
+		return []*Node{doc.root}
+	case n.attr != "":
+		return nil
+	default:
+		return n.node.Children
+	}
+}
+
+func (doc *xpathDocument) descendants(n xpathNode, fn func(c *Node)) {
+	for _, c := range doc.children(n) {
+		c.Walk(func(d *Node) bool {
+			fn(d)
+			return true
+		})
+	}
+}
+
+// axis returns the nodes of the axis in proximity order, reverse axes start with the nearest node.
+func (doc *xpathDocument) axis(name string, n xpathNode) (nodes []xpathNode, err error) {
+	elements := func(list []*Node) {
+		for _, c := range list {
+			nodes = append(nodes, xpathNode{node: c})
+		}
+	}
+	switch name {
+	case "self":
+		nodes = append(nodes, n)
+	case "child":
+		elements(doc.children(n))
+	case "descendant-or-self":
+		nodes = append(nodes, n)
+		fallthrough
+	case "descendant":
+		doc.descendants(n, func(c *Node) { nodes = append(nodes, xpathNode{node: c}) })
+	case "parent":
+		if p, ok := doc.parent(n); ok {
+			nodes = append(nodes, p)
+		}
+	case "ancestor-or-self":
+		nodes = append(nodes, n)
+		fallthrough
+	case "ancestor":
+		for p, ok := doc.parent(n); ok; p, ok = doc.parent(p) {
+			nodes = append(nodes, p)
+		}
+	case "following-sibling", "preceding-sibling":
+		if !n.isElement() {
+			return nil, nil
+		}
+		p, _ := doc.parent(n)
+		siblings := doc.children(p)
+		for i, s := range siblings {
+			if s != n.node {
+				continue
+			}
+			if name == "following-sibling" {
+				elements(siblings[i+1:])
+			} else {
+				for j := i - 1; j >= 0; j-- {
+					nodes = append(nodes, xpathNode{node: siblings[j]})
+				}
+			}
+			break
+		}
+	case "following", "preceding":
+		if n.node == nil {
+			return nil, nil
+		}
+		ancestors := make(map[*Node]bool)
+		for p := n.node; p != nil; p = p.Parent {
+			ancestors[p] = true
+		}
+		if name == "following" {
+			descendants := make(map[*Node]bool)
+			if n.attr == "" {
+				n.node.Walk(func(d *Node) bool {
+					descendants[d] = true
+					return true
+				})
+			}
+			for _, c := range doc.all[doc.order[n.node]:] {
+				if !descendants[c] {
+					nodes = append(nodes, xpathNode{node: c})
+				}
+			}
+		} else {
+			for i := doc.order[n.node] - 2; i >= 0; i-- {
+				if c := doc.all[i]; !ancestors[c] {
+					nodes = append(nodes, xpathNode{node: c})
+				}
+			}
+		}
+	case "attribute":
+		if n.isElement() {
+			for _, key := range sortedKeys(n.node.Attributes) {
+				nodes = append(nodes, xpathNode{node: n.node, attr: key})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported axis %q", name)
+	}
+	return nodes, nil
+}
+
+// values
+
+type xpathValue interface{}
+
+type xpathNodeSet []xpathNode
+
+func xpathString(v xpathValue) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		case v == math.Trunc(v) && math.Abs(v) < 1e15:
+			return strconv.FormatInt(int64(v), 10)
+		default:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	case bool:
+		return strconv.FormatBool(v)
+	case xpathNodeSet:
+		if len(v) == 0 {
+			return ""
+		}
+		return v[0].stringValue()
+	}
+	return ""
+}
+
+func xpathNumber(v xpathValue) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	default:
+		f, err := strconv.ParseFloat(strings.TrimSpace(xpathString(v)), 64)
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	}
+}
+
+func xpathBoolean(v xpathValue) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case xpathNodeSet:
+		return len(v) != 0
+	}
+	return false
+}
+
+// compare implements the comparisons of XPath 1.0, node-sets compare true if any of their nodes does.
+func xpathCompare(op string, a, b xpathValue) bool {
+	if set, ok := a.(xpathNodeSet); ok {
+		if _, isBool := b.(bool); isBool {
+			return xpathCompareAtoms(op, xpathBoolean(set), b)
+		}
+		for _, n := range set {
+			if xpathCompare(op, n.stringValue(), b) {
+				return true
+			}
+		}
+		return false
+	}
+	if set, ok := b.(xpathNodeSet); ok {
+		if _, isBool := a.(bool); isBool {
+			return xpathCompareAtoms(op, a, xpathBoolean(set))
+		}
+		for _, n := range set {
+			if xpathCompare(op, a, n.stringValue()) {
+				return true
+			}
+		}
+		return false
+	}
+	return xpathCompareAtoms(op, a, b)
+}
+
+func xpathCompareAtoms(op string, a, b xpathValue) bool {
+	if op == "=" || op == "!=" {
+		var equal bool
+		_, aBool := a.(bool)
+		_, bBool := b.(bool)
+		_, aNum := a.(float64)
+		_, bNum := b.(float64)
+		switch {
+		case aBool || bBool:
+			equal = xpathBoolean(a) == xpathBoolean(b)
+		case aNum || bNum:
+			equal = xpathNumber(a) == xpathNumber(b)
+		default:
+			equal = xpathString(a) == xpathString(b)
+		}
+		return equal == (op == "=")
+	}
+	x, y := xpathNumber(a), xpathNumber(b)
+	switch op {
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">":
+		return x > y
+	case ">=":
+		return x >= y
+	}
+	return false
+}
+
+// expressions
+
+type xpathContext struct {
+	node           xpathNode
+	position, size int
+	doc            *xpathDocument
+}
+
+type xpathExpr interface {
+	eval(ctx *xpathContext) (xpathValue, error)
+}
+
+type xpathLiteral struct{ value xpathValue }
+
+func (e xpathLiteral) eval(*xpathContext) (xpathValue, error) { return e.value, nil }
+
+type xpathBinary struct {
+	op          string
+	left, right xpathExpr
+}
+
+func (e xpathBinary) eval(ctx *xpathContext) (xpathValue, error) {
+	a, err := e.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "or", "and":
+		// the right operand is only evaluated when needed
+		if xpathBoolean(a) == (e.op == "or") {
+			return e.op == "or", nil
+		}
+		b, err := e.right.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return xpathBoolean(b), nil
+	}
+
+	b, err := e.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "=", "!=", "<", "<=", ">", ">=":
+		return xpathCompare(e.op, a, b), nil
+	case "+":
+		return xpathNumber(a) + xpathNumber(b), nil
+	case "-":
+		return xpathNumber(a) - xpathNumber(b), nil
+	case "*":
+		return xpathNumber(a) * xpathNumber(b), nil
+	case "div":
+		return xpathNumber(a) / xpathNumber(b), nil
+	case "mod":
+		return math.Mod(xpathNumber(a), xpathNumber(b)), nil
+	case "|":
+		x, okA := a.(xpathNodeSet)
+		y, okB := b.(xpathNodeSet)
+		if !okA || !okB {
+			return nil, errors.New("union of values other than node-sets")
+		}
+		return ctx.doc.sortUnique(append(append(xpathNodeSet(nil), x...), y...)), nil
+	}
+	return nil, fmt.Errorf("unknown operator %q", e.op)
+}
+
+type xpathNegate struct{ expr xpathExpr }
+
+func (e xpathNegate) eval(ctx *xpathContext) (xpathValue, error) {
+	v, err := e.expr.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return -xpathNumber(v), nil
+}
+
+type xpathStep struct {
+	axis       string
+	test       string // a name, "*" or "node()", "text()"...
+	predicates []xpathExpr
+}
+
+// xpathPath is a location path, or a filter expression followed by steps if filter is set.
+type xpathPath struct {
+	absolute bool
+	filter   xpathExpr
+	steps    []xpathStep
+}
+
+func (e xpathPath) eval(ctx *xpathContext) (xpathValue, error) {
+	var current xpathNodeSet
+	switch {
+	case e.filter != nil:
+		v, err := e.filter.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(e.steps) == 0 {
+			return v, nil
+		}
+		set, ok := v.(xpathNodeSet)
+		if !ok {
+			return nil, errors.New("path applied to a value other than a node-set")
+		}
+		current = set
+	case e.absolute:
+		current = xpathNodeSet{{}}
+	default:
+		current = xpathNodeSet{ctx.node}
+	}
+
+	for _, step := range e.steps {
+		var next xpathNodeSet
+		for _, n := range current {
+			selected, err := step.apply(ctx.doc, n)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, selected...)
+		}
+		current = ctx.doc.sortUnique(next)
+	}
+	return current, nil
+}
+
+func (step xpathStep) apply(doc *xpathDocument, n xpathNode) (xpathNodeSet, error) {
+	candidates, err := doc.axis(step.axis, n)
+	if err != nil {
+		return nil, err
+	}
+	var nodes xpathNodeSet
+	for _, c := range candidates {
+		if step.matches(c) {
+			nodes = append(nodes, c)
+		}
+	}
+	for _, predicate := range step.predicates {
+		if nodes, err = filterNodes(doc, nodes, predicate); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+func (step xpathStep) matches(n xpathNode) bool {
+	switch step.test {
+	case "node()":
+		return true
+	case "text()", "comment()", "processing-instruction()":
+		return false
+	}
+	// the principal node type of the attribute axis are attributes, elements otherwise
+	if (step.axis == "attribute") != (n.attr != "") || n.node == nil {
+		return false
+	}
+	return step.test == "*" || step.test == n.name()
+}
+
+// filterNodes keeps the nodes for which predicate is true, nodes are in proximity order.
+func filterNodes(doc *xpathDocument, nodes xpathNodeSet, predicate xpathExpr) (xpathNodeSet, error) {
+	var kept xpathNodeSet
+	for i, n := range nodes {
+		v, err := predicate.eval(&xpathContext{node: n, position: i + 1, size: len(nodes), doc: doc})
+		if err != nil {
+			return nil, err
+		}
+		if f, ok := v.(float64); ok {
+			if f == float64(i+1) {
+				kept = append(kept, n)
+			}
+			continue
+		}
+		if xpathBoolean(v) {
+			kept = append(kept, n)
+		}
+	}
+	return kept, nil
+}
+
+type xpathFilter struct {
+	primary    xpathExpr
+	predicates []xpathExpr
+}
+
+func (e xpathFilter) eval(ctx *xpathContext) (xpathValue, error) {
+	v, err := e.primary.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	set, ok := v.(xpathNodeSet)
+	if !ok {
+		return nil, errors.New("predicate applied to a value other than a node-set")
+	}
+	for _, predicate := range e.predicates {
+		if set, err = filterNodes(ctx.doc, set, predicate); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+func (doc *xpathDocument) sortUnique(set xpathNodeSet) xpathNodeSet {
+	sort.SliceStable(set, func(i, j int) bool {
+		pi, ai := doc.position(set[i])
+		pj, aj := doc.position(set[j])
+		if pi != pj {
+			return pi < pj
+		}
+		return ai < aj
+	})
+	unique := set[:0]
+	for i, n := range set {
+		if i == 0 || n != set[i-1] {
+			unique = append(unique, n)
+		}
+	}
+	return unique
+}
+
+type xpathCall struct {
+	name string
+	args []xpathExpr
+}
+
+func (e xpathCall) eval(ctx *xpathContext) (xpathValue, error) {
+	args := make([]xpathValue, len(e.args))
+	for i, arg := range e.args {
+		v, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	// the functions defaulting to the context node
+	contextOr := func() xpathValue {
+		if len(args) != 0 {
+			return args[0]
+		}
+		return xpathNodeSet{ctx.node}
+	}
+
+	switch e.name {
+	case "last":
+		return float64(ctx.size), nil
+	case "position":
+		return float64(ctx.position), nil
+	case "count":
+		set, ok := args[0].(xpathNodeSet)
+		if !ok {
+			return nil, errors.New("count() of a value other than a node-set")
+		}
+		return float64(len(set)), nil
+	case "name", "local-name":
+		set, ok := contextOr().(xpathNodeSet)
+		if !ok {
+			return nil, fmt.Errorf("%s() of a value other than a node-set", e.name)
+		}
+		if len(set) == 0 {
+			return "", nil
+		}
+		return set[0].name(), nil
+	case "string":
+		return xpathString(contextOr()), nil
+	case "concat":
+		var b strings.Builder
+		for _, arg := range args {
+			b.WriteString(xpathString(arg))
+		}
+		return b.String(), nil
+	case "contains":
+		return strings.Contains(xpathString(args[0]), xpathString(args[1])), nil
+	case "starts-with":
+		return strings.HasPrefix(xpathString(args[0]), xpathString(args[1])), nil
+	case "ends-with":
+		return strings.HasSuffix(xpathString(args[0]), xpathString(args[1])), nil
+	case "string-length":
+		return float64(len([]rune(xpathString(contextOr())))), nil
+	case "normalize-space":
+		return strings.Join(strings.Fields(xpathString(contextOr())), " "), nil
+	case "lower-case":
+		return strings.ToLower(xpathString(args[0])), nil
+	case "upper-case":
+		return strings.ToUpper(xpathString(args[0])), nil
+	case "not":
+		return !xpathBoolean(args[0]), nil
+	case "boolean":
+		return xpathBoolean(args[0]), nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "number":
+		return xpathNumber(contextOr()), nil
+	case "floor":
+		return math.Floor(xpathNumber(args[0])), nil
+	case "ceiling":
+		return math.Ceil(xpathNumber(args[0])), nil
+	case "round":
+		return math.Floor(xpathNumber(args[0]) + 0.5), nil
+	}
+	return nil, fmt.Errorf("unknown function %s()", e.name)
+}
+
+// the number of arguments of the functions, -1 for any number
+var xpathFunctions = map[string][2]int{
+	"last": {0, 0}, "position": {0, 0}, "count": {1, 1},
+	"name": {0, 1}, "local-name": {0, 1},
+	"string": {0, 1}, "concat": {2, -1}, "contains": {2, 2}, "starts-with": {2, 2}, "ends-with": {2, 2},
+	"string-length": {0, 1}, "normalize-space": {0, 1}, "lower-case": {1, 1}, "upper-case": {1, 1},
+	"not": {1, 1}, "boolean": {1, 1}, "true": {0, 0}, "false": {0, 0},
+	"number": {0, 1}, "floor": {1, 1}, "ceiling": {1, 1}, "round": {1, 1},
+}
+
+var xpathAxes = map[string]bool{
+	"ancestor": true, "ancestor-or-self": true, "attribute": true, "child": true,
+	"descendant": true, "descendant-or-self": true, "following": true, "following-sibling": true,
+	"parent": true, "preceding": true, "preceding-sibling": true, "self": true,
+}
+
+// tokens
+
+type xpathTokenKind int
+
+const (
+	xpathTokenOperator xpathTokenKind = iota
+	xpathTokenName
+	xpathTokenLiteral
+	xpathTokenNumber
+)
+
+type xpathToken struct {
+	kind xpathTokenKind
+	text string
+}
+
+func xpathTokenize(s string) (tokens []xpathToken, err error) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, errors.New("unterminated string literal")
+			}
+			tokens = append(tokens, xpathToken{xpathTokenLiteral, s[i+1 : i+1+end]})
+			i += end + 2
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, xpathToken{xpathTokenNumber, s[i:j]})
+			i = j
+		case isXPathNameStart(rune(c)) || c >= 0x80:
+			j := i
+			for j < len(s) {
+				r := rune(s[j])
+				if !isXPathNameStart(r) && !(r >= '0' && r <= '9') && r != '-' && r != '.' && r < 0x80 {
+					break
+				}
+				j++
+			}
+			tokens = append(tokens, xpathToken{xpathTokenName, s[i:j]})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"//", "::", "..", "!=", "<=", ">=", "/", "(", ")", "[", "]", ".", "@", ",", "|", "+", "-", "=", "<", ">", "*"} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			tokens = append(tokens, xpathToken{xpathTokenOperator, op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+func isXPathNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+// parser
+
+type xpathParser struct {
+	tokens []xpathToken
+	pos    int
+}
+
+func (p *xpathParser) peek() (xpathToken, bool) {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos], true
+	}
+	return xpathToken{}, false
+}
+
+func (p *xpathParser) peekAt(offset int) (xpathToken, bool) {
+	if p.pos+offset < len(p.tokens) {
+		return p.tokens[p.pos+offset], true
+	}
+	return xpathToken{}, false
+}
+
+// isOperator reports whether the next token is the operator op.
+func (p *xpathParser) isOperator(op string) bool {
+	t, ok := p.peek()
+	if !ok || t.text != op || t.kind == xpathTokenLiteral || t.kind == xpathTokenNumber {
+		return false
+	}
+	if t.kind == xpathTokenName || op == "*" {
+		return p.isOperatorToken(p.pos)
+	}
+	return true
+}
+
+// isOperatorToken tells apart "*" and the names "and", "or", "div" and "mod" as operators
+// from name tests, following the lexical rules of XPath: they are operators if they follow
+// a token other than "@", "::", "(", "[", "," or another operator.
+func (p *xpathParser) isOperatorToken(i int) bool {
+	t := p.tokens[i]
+	switch t.kind {
+	case xpathTokenLiteral, xpathTokenNumber:
+		return false
+	case xpathTokenName:
+		switch t.text {
+		case "and", "or", "div", "mod":
+		default:
+			return false
+		}
+	case xpathTokenOperator:
+		switch t.text {
+		case "*":
+		case "/", "//", "|", "+", "-", "=", "!=", "<", "<=", ">", ">=":
+			return true
+		default:
+			return false
+		}
+	}
+	if i == 0 {
+		return false
+	}
+	prev := p.tokens[i-1]
+	if prev.kind == xpathTokenOperator {
+		switch prev.text {
+		case "@", "::", "(", "[", ",":
+			return false
+		}
+	}
+	return !p.isOperatorToken(i - 1)
+}
+
+func (p *xpathParser) accept(op string) bool {
+	if p.isOperator(op) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *xpathParser) expect(op string) error {
+	if t, ok := p.peek(); ok && t.text == op && t.kind == xpathTokenOperator {
+		p.pos++
+		return nil
+	}
+	if t, ok := p.peek(); ok {
+		return fmt.Errorf("expected %q, got %q", op, t.text)
+	}
+	return fmt.Errorf("expected %q at the end", op)
+}
+
+func (p *xpathParser) parseExpr() (xpathExpr, error) {
+	return p.parseBinary(0)
+}
+
+var xpathPrecedence = [][]string{
+	{"or"},
+	{"and"},
+	{"=", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "div", "mod"},
+}
+
+func (p *xpathParser) parseBinary(level int) (xpathExpr, error) {
+	if level == len(xpathPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range xpathPrecedence[level] {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = xpathBinary{op: op, left: left, right: right}
+	}
+}
+
+func (p *xpathParser) parseUnary() (xpathExpr, error) {
+	if t, ok := p.peek(); ok && t.kind == xpathTokenOperator && t.text == "-" {
+		p.pos++
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return xpathNegate{e}, nil
+	}
+	left, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("|") {
+		right, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		left = xpathBinary{op: "|", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *xpathParser) parsePath() (xpathExpr, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("unexpected end of expression")
+	}
+
+	// a filter expression starts with a literal, number, parenthesis or function call
+	isFilter := t.kind == xpathTokenLiteral || t.kind == xpathTokenNumber || t.kind == xpathTokenOperator && t.text == "("
+	if t.kind == xpathTokenName {
+		if next, ok := p.peekAt(1); ok && next.text == "(" && !isXPathNodeType(t.text) {
+			isFilter = true
+		}
+	}
+	if !isFilter {
+		return p.parseLocationPath()
+	}
+
+	primary, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	filter := xpathFilter{primary: primary}
+	for p.isBracket() {
+		predicate, err := p.parsePredicate()
+		if err != nil {
+			return nil, err
+		}
+		filter.predicates = append(filter.predicates, predicate)
+	}
+	var expr xpathExpr = filter
+	if len(filter.predicates) == 0 {
+		expr = primary
+	}
+
+	path := xpathPath{filter: expr}
+	if err = p.parseRelativeSteps(&path, true); err != nil {
+		return nil, err
+	}
+	if len(path.steps) == 0 {
+		return expr, nil
+	}
+	return path, nil
+}
+
+func (p *xpathParser) isBracket() bool {
+	t, ok := p.peek()
+	return ok && t.kind == xpathTokenOperator && t.text == "["
+}
+
+func isXPathNodeType(name string) bool {
+	switch name {
+	case "node", "text", "comment", "processing-instruction":
+		return true
+	}
+	return false
+}
+
+func (p *xpathParser) parsePrimary() (xpathExpr, error) {
+	t, _ := p.peek()
+	p.pos++
+	switch t.kind {
+	case xpathTokenLiteral:
+		return xpathLiteral{t.text}, nil
+	case xpathTokenNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return xpathLiteral{f}, nil
+	case xpathTokenOperator:
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+
+	arity, ok := xpathFunctions[t.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s()", t.text)
+	}
+	call := xpathCall{name: t.text}
+	p.pos++ // "("
+	if next, ok := p.peek(); !ok || next.text != ")" || next.kind != xpathTokenOperator {
+		for {
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if next, ok := p.peek(); ok && next.kind == xpathTokenOperator && next.text == "," {
+				p.pos++
+				continue
+			}
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if len(call.args) < arity[0] || arity[1] >= 0 && len(call.args) > arity[1] {
+		return nil, fmt.Errorf("wrong number of arguments for %s()", call.name)
+	}
+	return call, nil
+}
+
+func (p *xpathParser) parseLocationPath() (xpathExpr, error) {
+	var path xpathPath
+	t, _ := p.peek()
+	if t.kind == xpathTokenOperator && (t.text == "/" || t.text == "//") {
+		path.absolute = true
+		if t.text == "/" {
+			p.pos++
+			// "/" alone selects the document
+			if !p.startsStep() {
+				return path, nil
+			}
+		}
+	}
+	// "//" is consumed as separator of the first step
+	if err := p.parseRelativeSteps(&path, t.text == "//" && t.kind == xpathTokenOperator); err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+func (p *xpathParser) startsStep() bool {
+	t, ok := p.peek()
+	if !ok {
+		return false
+	}
+	switch t.kind {
+	case xpathTokenName:
+		return true
+	case xpathTokenOperator:
+		switch t.text {
+		case ".", "..", "@", "*":
+			return true
+		}
+	}
+	return false
+}
+
+// parseRelativeSteps parses steps separated by "/" or "//",
+// if leadingSeparator is set the first step has to be preceded by one.
+func (p *xpathParser) parseRelativeSteps(path *xpathPath, leadingSeparator bool) error {
+	first := true
+	for {
+		if !first || leadingSeparator {
+			t, ok := p.peek()
+			if !ok || t.kind != xpathTokenOperator || t.text != "/" && t.text != "//" {
+				return nil
+			}
+			p.pos++
+			if t.text == "//" {
+				path.steps = append(path.steps, xpathStep{axis: "descendant-or-self", test: "node()"})
+			}
+		}
+		first = false
+
+		step, err := p.parseStep()
+		if err != nil {
+			return err
+		}
+		path.steps = append(path.steps, step)
+	}
+}
+
+func (p *xpathParser) parseStep() (step xpathStep, err error) {
+	t, ok := p.peek()
+	if !ok {
+		return step, errors.New("expected a location step")
+	}
+	step.axis = "child"
+	switch {
+	case t.kind == xpathTokenOperator && t.text == ".":
+		p.pos++
+		return xpathStep{axis: "self", test: "node()"}, nil
+	case t.kind == xpathTokenOperator && t.text == "..":
+		p.pos++
+		return xpathStep{axis: "parent", test: "node()"}, nil
+	case t.kind == xpathTokenOperator && t.text == "@":
+		p.pos++
+		step.axis = "attribute"
+	case t.kind == xpathTokenName:
+		if next, ok := p.peekAt(1); ok && next.text == "::" {
+			if !xpathAxes[t.text] {
+				return step, fmt.Errorf("unsupported axis %q", t.text)
+			}
+			step.axis = t.text
+			p.pos += 2
+		}
+	}
+
+	if t, ok = p.peek(); !ok {
+		return step, errors.New("expected a node test")
+	}
+	switch {
+	case t.kind == xpathTokenOperator && t.text == "*":
+		step.test = "*"
+		p.pos++
+	case t.kind == xpathTokenName:
+		p.pos++
+		step.test = t.text
+		if isXPathNodeType(t.text) {
+			if err = p.expect("("); err != nil {
+				return step, err
+			}
+			if err = p.expect(")"); err != nil {
+				return step, err
+			}
+			step.test = t.text + "()"
+		}
+	default:
+		return step, fmt.Errorf("expected a node test, got %q", t.text)
+	}
+
+	for p.isBracket() {
+		predicate, err := p.parsePredicate()
+		if err != nil {
+			return step, err
+		}
+		step.predicates = append(step.predicates, predicate)
+	}
+	return step, nil
+}
+
+func (p *xpathParser) parsePredicate() (xpathExpr, error) {
+	p.pos++ // "["
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return e, p.expect("]")
+}
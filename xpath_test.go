@@ -0,0 +1,141 @@
+package gwda
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestXPath_Select(t *testing.T) {
+	h, err := ParseHierarchy(testXMLSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		xpath string
+		names []string
+	}{
+		{`//XCUIElementTypeButton`, []string{"General", "Privacy"}},
+		{`/XCUIElementTypeApplication/XCUIElementTypeWindow/*[2]`, []string{"Privacy"}},
+		{`//XCUIElementTypeButton[@name="General"]`, []string{"General"}},
+		{`//*[@enabled='false' or @visible='false']`, []string{"Privacy", "Airplane Mode"}},
+		{`//*[contains(@label, '&') and @type='XCUIElementTypeButton']`, []string{"Privacy"}},
+		{`//*[starts-with(@name, 'Air')]`, []string{"Airplane Mode"}},
+		{`//XCUIElementTypeButton[last()]`, []string{"Privacy"}},
+		{`(//XCUIElementTypeButton | //XCUIElementTypeSwitch)[position() > 1]`, []string{"Privacy", "Airplane Mode"}},
+		{`//*[@y > 120 and @y < 500]`, []string{"Privacy"}},
+		{`//*[@y * 2 div 2 = 100]`, []string{"General"}},
+		{`//XCUIElementTypeButton[1]/following-sibling::*`, []string{"Privacy", "Airplane Mode"}},
+		{`//XCUIElementTypeSwitch/preceding-sibling::*[1]`, []string{"Privacy"}},
+		{`//XCUIElementTypeSwitch/..`, []string{""}},
+		{`//XCUIElementTypeSwitch/ancestor::XCUIElementTypeApplication`, []string{"Settings"}},
+		{`//*[not(@name)]`, []string{""}},
+		{`//*[count(*) = 3]`, []string{""}},
+		{`//*[@value]/@value/..`, []string{"Airplane Mode"}},
+		{`//XCUIElementTypeCell`, nil},
+
+		// axes
+		{`//XCUIElementTypeWindow/child::*`, []string{"General", "Privacy", "Airplane Mode"}},
+		{`/XCUIElementTypeApplication/descendant::XCUIElementTypeButton`, []string{"General", "Privacy"}},
+		{`/XCUIElementTypeApplication/descendant-or-self::*[@name]`, []string{"Settings", "General", "Privacy", "Airplane Mode"}},
+		{`//XCUIElementTypeButton/self::*[@name='General']`, []string{"General"}},
+		{`//XCUIElementTypeButton/self::XCUIElementTypeSwitch`, nil},
+		{`//XCUIElementTypeSwitch/parent::XCUIElementTypeWindow`, []string{""}},
+		{`//XCUIElementTypeSwitch/ancestor::*`, []string{"Settings", ""}},
+		{`//XCUIElementTypeSwitch/ancestor-or-self::*[@name]`, []string{"Settings", "Airplane Mode"}},
+		{`//XCUIElementTypeButton[@name='General']/following::*`, []string{"Privacy", "Airplane Mode"}},
+		{`//XCUIElementTypeSwitch/preceding::*`, []string{"General", "Privacy"}},
+		{`//XCUIElementTypeButton[@name='Privacy']/following-sibling::*[1]`, []string{"Airplane Mode"}},
+		{`//XCUIElementTypeWindow//XCUIElementTypeButton`, []string{"General", "Privacy"}},
+		{`//XCUIElementTypeWindow/./*[1]`, []string{"General"}},
+		{`//*[@name='General']/../*[@name='Privacy']`, []string{"Privacy"}},
+		{`//node()[@name='General']`, []string{"General"}},
+
+		// positions
+		{`//XCUIElementTypeWindow/*[3]`, []string{"Airplane Mode"}},
+		{`//XCUIElementTypeWindow/*[4]`, nil},
+		{`//XCUIElementTypeWindow/*[position() = last()]`, []string{"Airplane Mode"}},
+		{`//XCUIElementTypeWindow/*[position() < last()]`, []string{"General", "Privacy"}},
+		{`//XCUIElementTypeWindow/*[last() - 1]`, []string{"Privacy"}},
+		{`//XCUIElementTypeWindow/*[position() mod 2 = 1]`, []string{"General", "Airplane Mode"}},
+		{`(//XCUIElementTypeWindow/*)[last()]`, []string{"Airplane Mode"}},
+		{`//XCUIElementTypeWindow/*[@enabled='true'][2]`, []string{"Airplane Mode"}},
+		{`//*[@y <= 144.5][@y >= 100]`, []string{"General", "Privacy"}},
+
+		// functions
+		{`//*[ends-with(@name, 'Mode')]`, []string{"Airplane Mode"}},
+		{`//*[string-length(@name) = 7]`, []string{"General", "Privacy"}},
+		{`//*[normalize-space(concat('  ', @name, '  ')) = 'General']`, []string{"General"}},
+		{`//*[lower-case(@name) = 'privacy']`, []string{"Privacy"}},
+		{`//*[upper-case(@label) = 'AIRPLANE MODE']`, []string{"Airplane Mode"}},
+		{`//*[concat(@name, '/', @value) = 'Airplane Mode/1']`, []string{"Airplane Mode"}},
+		{`//*[contains(string(@label), 'Security')]`, []string{"Privacy"}},
+		{`//*[name() = 'XCUIElementTypeSwitch']`, []string{"Airplane Mode"}},
+		{`//*[local-name() = 'XCUIElementTypeWindow']`, []string{""}},
+		{`//*[number(@value) = 1]`, []string{"Airplane Mode"}},
+		{`//*[floor(@y) = 144]`, []string{"Privacy"}},
+		{`//*[ceiling(@y) = 145]`, []string{"Privacy"}},
+		{`//*[round(@y) = 145]`, []string{"Privacy"}},
+		{`//*[boolean(@value)]`, []string{"Airplane Mode"}},
+		{`//XCUIElementTypeButton[true() and not(false())]`, []string{"General", "Privacy"}},
+
+		// operators
+		{`//*[@x = 16 and -@y = -100]`, []string{"General"}},
+		{`//*[@y mod 200 = 100]`, []string{"General", "Airplane Mode"}},
+		{`//*[@y + @height >= 900]`, []string{"Airplane Mode"}},
+		{`//*[@y - 44.5 = 100]`, []string{"Privacy"}},
+		{`//*[@name != 'General']`, []string{"Settings", "Privacy", "Airplane Mode"}},
+
+		// unions are in document order without duplicates
+		{`//XCUIElementTypeSwitch | //XCUIElementTypeButton`, []string{"General", "Privacy", "Airplane Mode"}},
+		{`//XCUIElementTypeButton | //XCUIElementTypeButton[1]`, []string{"General", "Privacy"}},
+		{`//XCUIElementTypeSwitch | //XCUIElementTypeButton[1] | //XCUIElementTypeWindow`, []string{"", "General", "Airplane Mode"}},
+	}
+	for _, tt := range tests {
+		nodes, err := h.Select(tt.xpath)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.xpath, err)
+		}
+		var names []string
+		for _, n := range nodes {
+			names = append(names, n.Name)
+		}
+		if len(names) != len(tt.names) {
+			t.Fatalf("%s: got %q, want %q", tt.xpath, names, tt.names)
+		}
+		for i := range names {
+			if names[i] != tt.names[i] {
+				t.Fatalf("%s: got %q, want %q", tt.xpath, names, tt.names)
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		xpath string
+		err   string
+	}{
+		{`//`, "expected a location step"},
+		{`//*[`, "unexpected end of expression"},
+		{`//*[@name='x]`, "unterminated string literal"},
+		{`//*[@name='x']]`, `unexpected "]"`},
+		{`//*[@name = 'x'] extra`, `unexpected "extra"`},
+		{`(//*`, `expected ")"`},
+		{`//*[@name =]`, "expected a node test"},
+		{`//*[@name='x' and]`, "expected a node test"},
+		{`//@`, "expected a node test"},
+		{`//*[$var]`, "unexpected character '$'"},
+		{`//bogus::*`, `unsupported axis "bogus"`},
+		{`//*[unknown()]`, "unknown()"},
+		{`//*[concat('a')]`, "wrong number of arguments for concat()"},
+		{`//*[contains(@name)]`, "wrong number of arguments for contains()"},
+		{`//*[position(1)]`, "wrong number of arguments for position()"},
+		{`//*[count(1)]`, "count() of a value other than a node-set"},
+		{`//*[name(1)]`, "name() of a value other than a node-set"},
+		{`//*/@name`, "nodes other than elements"},
+		{`count(//*)`, "result is not a node-set"},
+	} {
+		if _, err := h.Select(tt.xpath); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: got error %v, want %q", tt.xpath, err, tt.err)
+		}
+	}
+}